@@ -0,0 +1,305 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"sphere.software/objstore/cluster"
+	"sphere.software/objstore/journal"
+)
+
+// RangeHash is a digest of journal entries with keys sharing the same prefix.
+type RangeHash journal.RangeHash
+
+// AntiEntropyStatus reports the progress of periodic journal reconciliation with peers.
+type AntiEntropyStatus struct {
+	Rounds     int    `json:"rounds"`
+	LastPeer   string `json:"last_peer"`
+	StartedAt  int64  `json:"started_at"`
+	FinishedAt int64  `json:"finished_at"`
+	// Compared is the count of ranges compared in the last round.
+	Compared int `json:"compared"`
+	// Fetched is the count of entries fetched from the peer in the last round.
+	Fetched  int   `json:"fetched"`
+	Repaired int64 `json:"repaired"`
+	Failed   int64 `json:"failed"`
+}
+
+const (
+	// antiEntropyLeafSize is the max amount of entries in a range that is compared
+	// entry by entry, instead of descending to the child ranges.
+	antiEntropyLeafSize = 128
+	// antiEntropyBatch is the max amount of ranges requested from a peer at once.
+	antiEntropyBatch = 256
+)
+
+type antiEntropy struct {
+	mux    *sync.Mutex
+	status AntiEntropyStatus
+}
+
+func newAntiEntropy() *antiEntropy {
+	return &antiEntropy{
+		mux: new(sync.Mutex),
+	}
+}
+
+func (a *antiEntropy) update(fn func(status *AntiEntropyStatus)) {
+	a.mux.Lock()
+	fn(&a.status)
+	a.mux.Unlock()
+}
+
+func (a *antiEntropy) Status() *AntiEntropyStatus {
+	a.mux.Lock()
+	status := a.status
+	a.mux.Unlock()
+	return &status
+}
+
+// reconcile periodically compares journals with a random peer, so announcements
+// missed by this node after the startup sync are eventually repaired. A node that has been
+// out of sync longer than the retention period, e.g. partitioned, does a full resync instead.
+func (o *objStore) reconcile(interval, timeout time.Duration) {
+	for {
+		time.Sleep(interval)
+		if !o.IsReady() {
+			continue
+		}
+		if o.checkStale() {
+			// the node is not ready until the resync completes, its journal can't be trusted
+			for !o.sync(timeout) && o.resyncPending() {
+				time.Sleep(2 * time.Second)
+			}
+			continue
+		}
+		nodes, err := o.cluster.ListNodes()
+		if err != nil {
+			log.Println("[WARN] list nodes failed:", err)
+			continue
+		}
+		var peers []string
+		for _, id := range nodeIDs(nodes) {
+			if id != o.nodeID {
+				peers = append(peers, id)
+			}
+		}
+		if len(peers) == 0 {
+			// a single node is the source of truth, unless it has lost the peers it knows
+			if !hasOtherPeers(o.nodeID, o.hints.Peers()) {
+				o.markSynced()
+			}
+			continue
+		}
+		peer := peers[rand.Intn(len(peers))]
+		if err := o.reconcileWith(peer, timeout); err != nil {
+			log.Println("[WARN] anti-entropy with", peer, "failed:", err)
+			continue
+		}
+		o.markSynced()
+	}
+}
+
+func hasOtherPeers(nodeID string, peers []string) bool {
+	for _, id := range peers {
+		if id != nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileWith walks the Merkle trees of this node and the peer from the root, descending only
+// into the ranges that differ. The entries of small differing ranges are fetched from the peer,
+// and repaired using the regular event handling. Entries missing on the peer are not pushed,
+// the peer repairs them during its own round.
+func (o *objStore) reconcileWith(peer string, timeout time.Duration) error {
+	o.antiEntropy.update(func(status *AntiEntropyStatus) {
+		status.Rounds++
+		status.LastPeer = peer
+		status.StartedAt = time.Now().UnixNano()
+		status.FinishedAt = 0
+		status.Compared = 0
+		status.Fetched = 0
+	})
+	defer o.antiEntropy.update(func(status *AntiEntropyStatus) {
+		status.FinishedAt = time.Now().UnixNano()
+	})
+	ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
+	defer cancelFn()
+
+	var leaves []string
+	pending := []string{""}
+	for len(pending) > 0 {
+		var next []string
+		for len(pending) > 0 {
+			batch := pending
+			if len(batch) > antiEntropyBatch {
+				batch = batch[:antiEntropyBatch]
+			}
+			pending = pending[len(batch):]
+			remote, err := o.cluster.HashRanges(ctx, peer, batch)
+			if err != nil {
+				return err
+			}
+			local, err := o.journals.HashRanges(batch)
+			if err != nil {
+				return err
+			}
+			for _, prefix := range batch {
+				diff := diffRanges(local[prefix], remote[prefix])
+				o.antiEntropy.update(func(status *AntiEntropyStatus) {
+					status.Compared += len(diff.compared)
+				})
+				leaves = append(leaves, diff.leaves...)
+				next = append(next, diff.nodes...)
+			}
+		}
+		pending = next
+	}
+	for len(leaves) > 0 {
+		batch := leaves
+		if len(batch) > antiEntropyBatch {
+			batch = batch[:antiEntropyBatch]
+		}
+		leaves = leaves[len(batch):]
+		if err := o.repairRanges(ctx, peer, batch, timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type rangesDiff struct {
+	compared []string
+	// nodes are differing ranges to descend into.
+	nodes []string
+	// leaves are differing ranges to compare entry by entry.
+	leaves []string
+}
+
+func diffRanges(local, remote []*journal.RangeHash) rangesDiff {
+	var diff rangesDiff
+	localSet := make(map[string]*journal.RangeHash, len(local))
+	for _, r := range local {
+		localSet[r.Prefix] = r
+	}
+	for _, r := range remote {
+		diff.compared = append(diff.compared, r.Prefix)
+		l, ok := localSet[r.Prefix]
+		if ok && bytes.Equal(l.Hash, r.Hash) {
+			continue
+		}
+		count := r.Count
+		if ok && l.Count > count {
+			count = l.Count
+		}
+		if count <= antiEntropyLeafSize {
+			// small enough to be fetched, large ranges missing locally are descended into as well
+			diff.leaves = append(diff.leaves, r.Prefix)
+			continue
+		}
+		diff.nodes = append(diff.nodes, r.Prefix)
+	}
+	return diff
+}
+
+// repairRanges fetches the entries of ranges from the peer and applies the ones that differ.
+func (o *objStore) repairRanges(ctx context.Context, peer string, prefixes []string, timeout time.Duration) error {
+	remote, err := o.cluster.ExportRanges(ctx, peer, prefixes)
+	if err != nil {
+		return err
+	}
+	local, err := o.journals.ExportRanges(prefixes)
+	if err != nil {
+		return err
+	}
+	o.antiEntropy.update(func(status *AntiEntropyStatus) {
+		status.Fetched += len(remote)
+	})
+	localSet := make(map[string]*journal.FileMeta, len(local))
+	for _, meta := range local {
+		localSet[meta.ID] = meta
+	}
+	for _, meta := range remote {
+		event := remoteEvent(meta, localSet[meta.ID])
+		if event == nil {
+			continue
+		}
+		if o.debug {
+			log.Println("[INFO] anti-entropy repair:", event.Type, meta)
+		}
+		if err := o.handleEvent(event, timeout); err != nil {
+			log.Println("[WARN] anti-entropy repair failed:", err)
+			o.antiEntropy.update(func(status *AntiEntropyStatus) {
+				status.Failed++
+			})
+			continue
+		}
+		o.antiEntropy.update(func(status *AntiEntropyStatus) {
+			status.Repaired++
+		})
+	}
+	return nil
+}
+
+// remoteEvent returns the event to apply the remote entry locally, nil if the local entry
+// is up to date. Deleted entries missing locally are added as well, to record the deletion.
+func remoteEvent(remote, local *journal.FileMeta) *EventAnnounce {
+	switch {
+	case local == nil:
+		return &EventAnnounce{
+			Type:     cluster.EventFileAdded,
+			FileMeta: remote,
+		}
+	case !remote.Supersedes(local):
+		return nil
+	case remote.IsDeleted && !local.IsDeleted:
+		return &EventAnnounce{
+			Type:     cluster.EventFileDeleted,
+			FileMeta: remote,
+		}
+	case !remote.IsDeleted:
+		// the object has been put again
+		return &EventAnnounce{
+			Type:     cluster.EventFileAdded,
+			FileMeta: remote,
+		}
+	}
+	return nil
+}
+
+func (o *objStore) HashRanges(prefixes []string) (map[string][]*RangeHash, error) {
+	if o.checkStale() {
+		return nil, ErrResyncPending
+	}
+	ranges, err := o.journals.HashRanges(prefixes)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]*RangeHash, len(ranges))
+	for prefix, children := range ranges {
+		list := make([]*RangeHash, 0, len(children))
+		for _, r := range children {
+			list = append(list, (*RangeHash)(r))
+		}
+		result[prefix] = list
+	}
+	return result, nil
+}
+
+func (o *objStore) ExportRanges(prefixes []string) (FileMetaList, error) {
+	if o.checkStale() {
+		return nil, ErrResyncPending
+	}
+	list, err := o.journals.ExportRanges(prefixes)
+	return (FileMetaList)(list), err
+}
+
+func (o *objStore) AntiEntropyStatus() *AntiEntropyStatus {
+	return o.antiEntropy.Status()
+}
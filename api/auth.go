@@ -0,0 +1,333 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Permission is a set of operations allowed with an API key.
+type Permission int
+
+const (
+	PermissionRead Permission = 1 << iota
+	PermissionWrite
+	PermissionDelete
+)
+
+var permissionNames = map[string]Permission{
+	"read":   PermissionRead,
+	"write":  PermissionWrite,
+	"delete": PermissionDelete,
+}
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrForbidden          = errors.New("operation not permitted")
+	ErrReplayed           = errors.New("request has been replayed")
+)
+
+// Principal is the requester authenticated by an API key.
+type Principal struct {
+	KeyID       string
+	Permissions Permission
+	// Prefixes limit the objects accessible with the key to IDs having any of them,
+	// if empty all objects are accessible.
+	Prefixes []string
+}
+
+// Allows reports whether the operation is permitted on the object, operations not related
+// to an object have empty ID and are not permitted with keys bound to prefixes.
+func (p *Principal) Allows(perm Permission, id string) bool {
+	if p.Permissions&perm != perm {
+		return false
+	} else if len(p.Prefixes) == 0 {
+		return true
+	}
+	return len(id) > 0 && p.Covers(id)
+}
+
+// Covers reports whether the object ID or key has any of the prefixes of the key, all objects
+// are covered if there are none. Permissions are not checked.
+func (p *Principal) Covers(id string) bool {
+	if len(p.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range p.Prefixes {
+		if strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator verifies credentials of public API requests. Returns ErrNoCredentials
+// if the request carries none.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthConfig is the config file with API keys.
+type AuthConfig struct {
+	Keys []*APIKeyConfig `json:"keys"`
+	// MaxSkew limits the difference between the date of signed requests and the server time, 5m by default.
+	MaxSkew string `json:"max_skew"`
+}
+
+type APIKeyConfig struct {
+	ID string `json:"id"`
+	// KeyHash is the hex-encoded SHA-256 of the static API key passed in X-API-Key header.
+	KeyHash string `json:"key_hash"`
+	// Secret is used to verify HMAC-signed requests, keep the config file private.
+	Secret      string   `json:"secret"`
+	Permissions []string `json:"permissions"`
+	Prefixes    []string `json:"prefixes"`
+}
+
+type apiKey struct {
+	principal *Principal
+	secret    []byte
+}
+
+// KeyStore authenticates requests by static API keys or HMAC signatures.
+type KeyStore struct {
+	byID    map[string]*apiKey
+	byHash  map[string]*apiKey
+	maxSkew time.Duration
+
+	// nonces remembers nonces of signed requests until their date is out of the skew window,
+	// so a captured request can't be replayed.
+	nonces       map[string]time.Time
+	noncesPurged time.Time
+	noncesMux    sync.Mutex
+}
+
+// LoadKeyStore reads API keys from a JSON config file.
+func LoadKeyStore(path string) (*KeyStore, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config AuthConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		err = fmt.Errorf("api: failed to parse auth config: %v", err)
+		return nil, err
+	}
+	return NewKeyStore(&config)
+}
+
+func NewKeyStore(config *AuthConfig) (*KeyStore, error) {
+	k := &KeyStore{
+		byID:    make(map[string]*apiKey, len(config.Keys)),
+		byHash:  make(map[string]*apiKey, len(config.Keys)),
+		maxSkew: 5 * time.Minute,
+		nonces:  make(map[string]time.Time),
+	}
+	if len(config.MaxSkew) > 0 {
+		d, err := time.ParseDuration(config.MaxSkew)
+		if err != nil {
+			err = fmt.Errorf("api: invalid max skew: %v", err)
+			return nil, err
+		}
+		k.maxSkew = d
+	}
+	for _, kc := range config.Keys {
+		if len(kc.ID) == 0 {
+			return nil, errors.New("api: API key has no ID")
+		} else if _, ok := k.byID[kc.ID]; ok {
+			return nil, fmt.Errorf("api: duplicate API key %s", kc.ID)
+		}
+		key := &apiKey{
+			principal: &Principal{
+				KeyID:    kc.ID,
+				Prefixes: kc.Prefixes,
+			},
+			secret: []byte(kc.Secret),
+		}
+		for _, name := range kc.Permissions {
+			perm, ok := permissionNames[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("api: unknown permission %s of API key %s", name, kc.ID)
+			}
+			key.principal.Permissions |= perm
+		}
+		k.byID[kc.ID] = key
+		if len(kc.KeyHash) > 0 {
+			k.byHash[strings.ToLower(kc.KeyHash)] = key
+		}
+	}
+	return k, nil
+}
+
+const (
+	apiKeyHeader      = "X-API-Key"
+	dateHeader        = "X-Date"
+	nonceHeader       = "X-Nonce"
+	contentHashHeader = "X-Content-SHA256"
+	hmacAuthType      = "OBJSTORE-HMAC-SHA256"
+	hmacKeyID         = "KeyId="
+	hmacSignature     = "Signature="
+)
+
+func (k *KeyStore) Authenticate(r *http.Request) (*Principal, error) {
+	if v := r.Header.Get(apiKeyHeader); len(v) > 0 {
+		sum := sha256.Sum256([]byte(v))
+		key, ok := k.byHash[hex.EncodeToString(sum[:])]
+		if !ok {
+			return nil, ErrInvalidCredentials
+		}
+		return key.principal, nil
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, hmacAuthType+" ") {
+		return nil, ErrNoCredentials
+	}
+	var keyID, signature string
+	for _, part := range strings.Split(strings.TrimPrefix(auth, hmacAuthType+" "), ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case strings.HasPrefix(part, hmacKeyID):
+			keyID = strings.TrimPrefix(part, hmacKeyID)
+		case strings.HasPrefix(part, hmacSignature):
+			signature = strings.TrimPrefix(part, hmacSignature)
+		}
+	}
+	key, ok := k.byID[keyID]
+	if !ok || len(key.secret) == 0 {
+		return nil, ErrInvalidCredentials
+	}
+	date, err := time.Parse(time.RFC3339, r.Header.Get(dateHeader))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header: %v", dateHeader, err)
+	} else if skew := time.Since(date); skew > k.maxSkew || skew < -k.maxSkew {
+		return nil, fmt.Errorf("request date is skewed by %v", skew)
+	}
+	nonce := r.Header.Get(nonceHeader)
+	if len(nonce) == 0 {
+		return nil, fmt.Errorf("no %s header", nonceHeader)
+	}
+	contentHash, err := hex.DecodeString(r.Header.Get(contentHashHeader))
+	if err != nil || len(contentHash) != sha256.Size {
+		return nil, fmt.Errorf("invalid %s header", contentHashHeader)
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, signRequest(r, key.secret)) {
+		return nil, ErrInvalidCredentials
+	}
+	if !k.useNonce(keyID+"/"+nonce, date) {
+		return nil, ErrReplayed
+	}
+	// the body is verified while it's read, the reader fails with ErrBadDigest at the end
+	if r.Body != nil {
+		r.Body = &verifiedBody{
+			digestReader: digestReader{
+				r:      r.Body,
+				hashes: []hash.Hash{sha256.New()},
+				sums:   [][]byte{contentHash},
+			},
+			Closer: r.Body,
+		}
+	}
+	return key.principal, nil
+}
+
+// useNonce records the nonce of a request dated by date, returns false if it has been used already.
+func (k *KeyStore) useNonce(nonce string, date time.Time) bool {
+	k.noncesMux.Lock()
+	defer k.noncesMux.Unlock()
+	now := time.Now()
+	if now.Sub(k.noncesPurged) > k.maxSkew {
+		for n, ts := range k.nonces {
+			if now.Sub(ts) > k.maxSkew {
+				delete(k.nonces, n)
+			}
+		}
+		k.noncesPurged = now
+	}
+	if _, ok := k.nonces[nonce]; ok {
+		return false
+	}
+	k.nonces[nonce] = date
+	return true
+}
+
+type verifiedBody struct {
+	digestReader
+	io.Closer
+}
+
+// SignRequest signs the request with HMAC-SHA256 using the secret of the API key. The method, path,
+// query, date, nonce, SHA-256 of the body and X-Meta-* headers are signed. Set the headers before signing,
+// the body is hashed unless X-Content-SHA256 is set, so it must be re-readable via GetBody.
+func SignRequest(r *http.Request, keyID, secret string) error {
+	if len(r.Header.Get(dateHeader)) == 0 {
+		r.Header.Set(dateHeader, time.Now().UTC().Format(time.RFC3339))
+	}
+	if len(r.Header.Get(nonceHeader)) == 0 {
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		r.Header.Set(nonceHeader, hex.EncodeToString(nonce))
+	}
+	if len(r.Header.Get(contentHashHeader)) == 0 {
+		h := sha256.New()
+		if r.Body != nil && r.Body != http.NoBody {
+			if r.GetBody == nil {
+				return fmt.Errorf("api: body can't be re-read, set %s header", contentHashHeader)
+			}
+			body, err := r.GetBody()
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(h, body)
+			body.Close()
+			if err != nil {
+				return err
+			}
+		}
+		r.Header.Set(contentHashHeader, hex.EncodeToString(h.Sum(nil)))
+	}
+	signature := hex.EncodeToString(signRequest(r, []byte(secret)))
+	r.Header.Set("Authorization", fmt.Sprintf("%s %s%s, %s%s",
+		hmacAuthType, hmacKeyID, keyID, hmacSignature, signature))
+	return nil
+}
+
+func signRequest(r *http.Request, secret []byte) []byte {
+	var metaHeaders []string
+	for k, v := range r.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-meta-") {
+			metaHeaders = append(metaHeaders, k+":"+strings.Join(v, ","))
+		}
+	}
+	sort.Strings(metaHeaders)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s\n%s\n%s", r.Method, r.URL.EscapedPath(), r.URL.RawQuery,
+		r.Header.Get(dateHeader), r.Header.Get(nonceHeader), strings.ToLower(r.Header.Get(contentHashHeader)),
+		strings.Join(metaHeaders, "\n"))
+	return mac.Sum(nil)
+}
+
+// secretOf finds the API key by ID for authentication schemes that sign requests differently,
+// e.g. the S3 gateway. Keys having no secret are not found.
+func (k *KeyStore) secretOf(keyID string) (*Principal, []byte, bool) {
+	key, ok := k.byID[keyID]
+	if !ok || len(key.secret) == 0 {
+		return nil, nil, false
+	}
+	return key.principal, key.secret, true
+}
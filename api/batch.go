@@ -0,0 +1,175 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sphere.software/objstore"
+	"sphere.software/objstore/journal"
+)
+
+const (
+	// maxBatchOps limits the amount of operations in a batch request.
+	maxBatchOps = 1000
+	// maxBatchSize limits the size of a batch request, bodies of objects included.
+	maxBatchSize = 64 * 1024 * 1024
+)
+
+type BatchRequest struct {
+	Ops []*BatchOp `json:"ops"`
+}
+
+type BatchOp struct {
+	// Op is one of get_meta, put or delete.
+	Op string `json:"op"`
+	// ID of the object, a new one is generated for puts if not set.
+	ID string `json:"id"`
+	// Name, UserMeta, Consistency and Replicas are meta data of the object being put,
+	// the consistency level of the namespace is used unless specified.
+	Name        string            `json:"name"`
+	UserMeta    map[string]string `json:"user_meta"`
+	Consistency *int              `json:"consistency"`
+	Replicas    int               `json:"replicas"`
+	// Data is the body of the object being put, base64-encoded.
+	Data []byte `json:"data"`
+}
+
+// BatchResult is the outcome of an operation, Status is the HTTP status the operation
+// would have if requested separately.
+type BatchResult struct {
+	ID     string             `json:"id"`
+	Status int                `json:"status"`
+	Error  string             `json:"error,omitempty"`
+	Meta   *objstore.FileMeta `json:"meta,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []*BatchResult `json:"results"`
+}
+
+// BatchHandler applies many operations at once, puts and deletes are applied in one journal
+// transaction and announced as one event. Results are reported per operation, in the order of ops.
+func (p *PublicServer) BatchHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchSize)
+		var req BatchRequest
+		if err := c.BindJSON(&req); err != nil {
+			return
+		}
+		if len(req.Ops) > maxBatchOps {
+			c.String(400, "error: too many operations, %d at most", maxBatchOps)
+			return
+		}
+		var defaultLevel objstore.ConsistencyLevel
+		if v, ok := c.Get(namespaceKey); ok {
+			defaultLevel = v.(*objstore.Namespace).Consistency
+		}
+		results := make([]*BatchResult, len(req.Ops))
+		var ops []*objstore.BatchOp
+		var opResults []*BatchResult
+		for i, op := range req.Ops {
+			result := &BatchResult{
+				ID: op.ID,
+			}
+			results[i] = result
+			var perm Permission
+			switch op.Op {
+			case "get_meta":
+				perm = PermissionRead
+			case "put":
+				perm = PermissionWrite
+				if len(op.ID) == 0 {
+					op.ID = objstore.GenerateID()
+					result.ID = op.ID
+				}
+			case "delete":
+				perm = PermissionDelete
+			default:
+				result.fail(400, fmt.Errorf("unknown operation: %s", op.Op))
+				continue
+			}
+			if !objstore.CheckID(op.ID) {
+				result.fail(400, fmt.Errorf("objstore: not a valid ULID: %s", op.ID))
+				continue
+			} else if !p.permits(c, perm, op.ID) {
+				result.fail(403, ErrForbidden)
+				continue
+			}
+			id := journal.JoinID(nsName(c), op.ID)
+			result.ID = id
+			switch op.Op {
+			case "get_meta":
+				// meta of deleted objects is reported along with 404
+				meta, err := store.HeadObject(id)
+				result.Meta = meta
+				if err == objstore.ErrNotFound {
+					result.fail(404, err)
+				} else if err != nil {
+					result.fail(500, err)
+				} else {
+					result.Status = 200
+				}
+			case "put":
+				level := defaultLevel
+				if op.Consistency != nil {
+					level = (objstore.ConsistencyLevel)(*op.Consistency)
+				}
+				consistency, err := level.Check()
+				if err != nil {
+					result.fail(400, err)
+					continue
+				} else if op.Replicas < 0 {
+					result.fail(400, fmt.Errorf("invalid replication factor: %d", op.Replicas))
+					continue
+				}
+				ops = append(ops, &objstore.BatchOp{
+					Meta: &objstore.FileMeta{
+						ID:          id,
+						Name:        op.Name,
+						UserMeta:    op.UserMeta,
+						Timestamp:   time.Now().UnixNano(),
+						Consistency: consistency,
+						Replicas:    op.Replicas,
+					},
+					Body: op.Data,
+				})
+				opResults = append(opResults, result)
+			case "delete":
+				ops = append(ops, &objstore.BatchOp{
+					Delete: true,
+					Meta: &objstore.FileMeta{
+						ID: id,
+					},
+				})
+				opResults = append(opResults, result)
+			}
+		}
+		if len(ops) > 0 {
+			for i, r := range store.Batch(ops) {
+				result := opResults[i]
+				switch r.Err {
+				case nil:
+					result.Status = 200
+					result.Meta = r.Meta
+				case objstore.ErrNotFound:
+					result.fail(404, r.Err)
+				case objstore.ErrQuotaExceeded:
+					result.fail(507, r.Err)
+				default:
+					result.fail(500, r.Err)
+				}
+			}
+		}
+		c.JSON(200, BatchResponse{
+			Results: results,
+		})
+	}
+}
+
+func (r *BatchResult) fail(status int, err error) {
+	r.Status = status
+	r.Error = err.Error()
+}
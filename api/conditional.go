@@ -0,0 +1,173 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sphere.software/objstore"
+	"sphere.software/objstore/journal"
+)
+
+// etag identifies the version of the object by its ID and the clock of the last mutation,
+// so it's the same on all nodes and doesn't require reading the content.
+func etag(meta *objstore.FileMeta) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", meta.ID, meta.Clock)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// matchETag reports whether the list of entity tags of a conditional header matches the tag.
+// The weak comparison ignores the W/ prefix, the strong one doesn't match weak tags at all,
+// as required for If-Match.
+func matchETag(header, tag string, weak bool) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if strings.HasPrefix(v, "W/") {
+			if !weak {
+				continue
+			}
+			v = strings.TrimPrefix(v, "W/")
+		}
+		if v == "*" || v == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified checks If-None-Match and If-Modified-Since of GET requests against the object,
+// responds with 304 if the copy cached by the client is still valid.
+func notModified(c *gin.Context, meta *objstore.FileMeta) bool {
+	tag := etag(meta)
+	ts := time.Unix(0, meta.Timestamp)
+	if inm := c.Request.Header.Get("If-None-Match"); len(inm) > 0 {
+		if !matchETag(inm, tag, true) {
+			return false
+		}
+	} else if ims := c.Request.Header.Get("If-Modified-Since"); len(ims) > 0 && meta.Timestamp > 0 {
+		t, err := http.ParseTime(ims)
+		if err != nil || ts.Truncate(time.Second).After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+	c.Header("ETag", tag)
+	if meta.Timestamp > 0 {
+		c.Header("Last-Modified", ts.UTC().Format(http.TimeFormat))
+	}
+	c.Status(304)
+	return true
+}
+
+// isConditionalPut reports whether the put is conditional, i.e. it either creates
+// the object only if there is none, or replaces only the specified version.
+func isConditionalPut(c *gin.Context) bool {
+	return len(c.Request.Header.Get("If-Match")) > 0 || len(c.Request.Header.Get("If-None-Match")) > 0
+}
+
+// putAllowed checks If-Match and If-None-Match of puts against the current version of the object,
+// nil if there is no live object. Responds with 412 if the conditions are not met.
+func putAllowed(c *gin.Context, current *objstore.FileMeta) bool {
+	var tag string
+	if current != nil {
+		tag = etag(current)
+	}
+	if im := c.Request.Header.Get("If-Match"); len(im) > 0 {
+		if current == nil || !matchETag(im, tag, false) {
+			c.String(412, "error: object does not match %s", im)
+			return false
+		}
+	}
+	if inm := c.Request.Header.Get("If-None-Match"); len(inm) > 0 {
+		if current != nil && matchETag(inm, tag, true) {
+			c.String(412, "error: object matches %s", inm)
+			return false
+		}
+	}
+	return true
+}
+
+// currentObject gets the live version of the object for checking conditional writes, the nodes chosen
+// by placement for the object are asked as well. Responds with 500 on errors.
+func currentObject(c *gin.Context, store objstore.Store, id string, replicas int) (*objstore.FileMeta, bool) {
+	current, err := store.HeadLatest(c, id, replicas)
+	if err == objstore.ErrNotFound || (err == nil && current.IsDeleted) {
+		return nil, true
+	} else if err != nil {
+		c.String(500, "error: %v", err)
+		return nil, false
+	}
+	return current, true
+}
+
+// lockObjects locks writeLocks of the objects given by their IDs within namespaces, so writes
+// of an object are serialized whether it's referenced by ID or by key. Objects are locked
+// in a fixed order, so writes locking several objects don't deadlock. Returns the function to unlock them.
+func lockObjects(ids ...string) func() {
+	sort.Strings(ids)
+	var unlocks []func()
+	for i, id := range ids {
+		if i > 0 && id == ids[i-1] {
+			continue
+		}
+		unlocks = append(unlocks, writeLocks.Lock("id:"+id))
+	}
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+// lockKey locks writeLocks of the object key in the namespace, so the object the key is mapped to
+// doesn't change until the object put by the key replaces it. Must be locked before objects are.
+func lockKey(ns, key string) func() {
+	return writeLocks.Lock("key:" + journal.JoinID(ns, key))
+}
+
+// writeLocks serializes conditional puts of the same object received by the node, so the
+// conditions hold until the object is put. Writes received by other nodes are not serialized,
+// so the compare-and-swap holds only for writes sent to the same node.
+var writeLocks = &keyLocks{
+	locks: make(map[string]*keyLock),
+}
+
+type keyLocks struct {
+	mux   sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock locks the key and returns the function to unlock it.
+func (k *keyLocks) Lock(key string) func() {
+	k.mux.Lock()
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = new(keyLock)
+		k.locks[key] = lock
+	}
+	lock.refs++
+	k.mux.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		k.mux.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mux.Unlock()
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"sphere.software/objstore"
+	"sphere.software/objstore/journal"
+)
+
+const namespaceKey = "namespace"
+
+// namespace resolves the namespace of /api/v1/ns/:ns routes, responds with 404 if there is no such namespace.
+func (p *PublicServer) namespace(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ns, ok := store.Namespace(c.Param("ns"))
+		if !ok {
+			c.String(404, "error: namespace not found: %s", c.Param("ns"))
+			c.Abort()
+			return
+		}
+		c.Set(namespaceKey, ns)
+	}
+}
+
+// nsName is the name of the namespace of the request, empty for the default namespace.
+func nsName(c *gin.Context) string {
+	if v, ok := c.Get(namespaceKey); ok {
+		return v.(*objstore.Namespace).Name
+	}
+	return ""
+}
+
+// permitsNamespace checks that the API key is permitted to access the namespace of the request.
+func permitsNamespace(c *gin.Context, principal *Principal) bool {
+	if v, ok := c.Get(namespaceKey); ok {
+		return v.(*objstore.Namespace).Permits(principal.KeyID)
+	}
+	return true
+}
+
+// checkID responds with 400 unless the ID given by the client is a plain ULID. IDs are placed into
+// namespaces by routes only, so objects of a namespace can't be reached via routes of another one.
+func checkID(c *gin.Context, id string) bool {
+	if !objstore.CheckID(id) {
+		c.String(400, "error: objstore: not a valid ULID: %s", id)
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// checkKey responds with 400 unless the object key given by the client is valid in the namespace of the request.
+func checkKey(c *gin.Context, store objstore.Store, key string) bool {
+	if err := keyError(store, nsName(c), key); err != nil {
+		c.String(400, "error: %v", err)
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// keyError checks that the object key of the namespace can't be taken for a key of another namespace.
+// Keys must not contain the namespace separator, and keys of the default namespace must not start
+// with a namespace name, as namespaces without their own buckets keep objects under their names
+// in the default bucket.
+func keyError(store objstore.Store, ns, key string) error {
+	if strings.Contains(key, journal.NamespaceSeparator) {
+		return fmt.Errorf("object key must not contain %q: %s", journal.NamespaceSeparator, key)
+	} else if len(ns) > 0 {
+		return nil
+	}
+	if i := strings.IndexByte(key, '/'); i >= 0 {
+		if _, ok := store.Namespace(key[:i]); ok {
+			return fmt.Errorf("object key must not start with the namespace name %s: %s", key[:i], key)
+		}
+	}
+	return nil
+}
+
+type UsageResponse struct {
+	Namespace string `json:"namespace"`
+	Bytes     int64  `json:"bytes"`
+	Quota     int64  `json:"quota"`
+}
+
+func (p *PublicServer) UsageHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := nsName(c)
+		bytes, err := store.NamespaceUsage(name)
+		if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		ns, _ := store.Namespace(name)
+		c.JSON(200, UsageResponse{
+			Namespace: name,
+			Bytes:     bytes,
+			Quota:     ns.Quota,
+		})
+	}
+}
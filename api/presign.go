@@ -0,0 +1,133 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sphere.software/objstore"
+	"sphere.software/objstore/journal"
+)
+
+// maxPresignExpiry limits the lifetime of presigned URLs.
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+var ErrExpired = errors.New("signature expired")
+
+// Presigner signs URLs granting access to a single object with a single method until
+// the expiry time. All nodes must share the key to validate URLs issued by each other.
+type Presigner struct {
+	key []byte
+}
+
+func NewPresigner(key string) *Presigner {
+	return &Presigner{
+		key: []byte(key),
+	}
+}
+
+// Sign returns the hex-encoded signature of the method and the object ID valid until exp.
+func (p *Presigner) Sign(method, id string, exp time.Time) string {
+	mac := hmac.New(sha256.New, p.key)
+	fmt.Fprintf(mac, "%s\n%s\n%d", method, id, exp.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and expiry passed in query of a presigned URL.
+func (p *Presigner) Verify(method, id, exp, sig string) error {
+	ts, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrInvalidCredentials
+	}
+	expected, err := hex.DecodeString(p.Sign(method, id, time.Unix(ts, 0)))
+	if err != nil {
+		return err
+	}
+	actual, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(actual, expected) {
+		return ErrInvalidCredentials
+	} else if time.Now().Unix() > ts {
+		return ErrExpired
+	}
+	return nil
+}
+
+// SetPresignKey enables presigned URLs, the key must be the same on all nodes.
+func (p *PublicServer) SetPresignKey(key string) {
+	p.presigner = NewPresigner(key)
+}
+
+type PresignRequest struct {
+	ID string `json:"id"`
+	// Method is either GET or PUT.
+	Method string `json:"method"`
+	// Expires is the lifetime of the URL, e.g. 1h, 15m by default.
+	Expires string `json:"expires"`
+}
+
+type PresignResponse struct {
+	// URL is the path with query, relative to the public API address.
+	URL     string `json:"url"`
+	Expires int64  `json:"expires"`
+}
+
+func (p *PublicServer) PresignHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p.presigner == nil {
+			c.String(501, "error: presigned URLs are not enabled")
+			return
+		}
+		var req PresignRequest
+		if err := c.BindJSON(&req); err != nil {
+			return
+		}
+		if !objstore.CheckID(req.ID) {
+			c.String(400, "error: not a valid ULID: %s", req.ID)
+			return
+		}
+		expires := 15 * time.Minute
+		if len(req.Expires) > 0 {
+			d, err := time.ParseDuration(req.Expires)
+			if err != nil || d <= 0 || d > maxPresignExpiry {
+				c.String(400, "error: invalid expiry: %s", req.Expires)
+				return
+			}
+			expires = d
+		}
+		var perm Permission
+		query := make(url.Values)
+		path := "/api/v1"
+		if ns := nsName(c); len(ns) > 0 {
+			path = path + "/ns/" + ns
+		}
+		switch req.Method {
+		case "GET":
+			perm = PermissionRead
+			path = path + "/get/" + req.ID
+		case "PUT":
+			perm = PermissionWrite
+			path = path + "/put"
+			query.Set("id", req.ID)
+		default:
+			c.String(400, "error: method must be GET or PUT: %s", req.Method)
+			return
+		}
+		if !p.allowed(c, perm, req.ID) {
+			return
+		}
+		exp := time.Now().Add(expires)
+		query.Set("exp", strconv.FormatInt(exp.Unix(), 10))
+		query.Set("sig", p.presigner.Sign(req.Method, journal.JoinID(nsName(c), req.ID), exp))
+		c.JSON(200, PresignResponse{
+			URL:     path + "?" + query.Encode(),
+			Expires: exp.Unix(),
+		})
+	}
+}
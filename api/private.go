@@ -1,6 +1,7 @@
 package api
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -21,6 +23,8 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"sphere.software/objstore"
+	"sphere.software/objstore/cluster"
+	"sphere.software/objstore/journal"
 )
 
 type PrivateServer struct {
@@ -30,6 +34,9 @@ type PrivateServer struct {
 	nodeID string
 	debug  bool
 	tags   []string
+
+	tlsConfig *tls.Config
+	secret    []byte
 }
 
 func NewPrivateServer(nodeID string, tags ...string) *PrivateServer {
@@ -68,8 +75,15 @@ func (p *PrivateServer) ListenAndServe(addr string) error {
 	// start a HTTP server using node's private listener
 	go http.Serve(listener, p.mux)
 
-	if err = p.router.ListenAndServe("tcp4", addr); err == nil {
-		p.router.Join("tcp4", addr)
+	if !p.isSecure() {
+		log.Println("[WARN] private network is not authenticated, any peer knowing the cluster tag may join")
+		if err = p.router.ListenAndServe("tcp4", addr); err == nil {
+			p.router.Join("tcp4", addr)
+		}
+		return err
+	}
+	if err = p.listen(addr); err == nil {
+		p.join(addr)
 	}
 	return err
 }
@@ -83,7 +97,7 @@ func (p *PrivateServer) JoinCluster(nodes []string) error {
 		if _, _, err := net.SplitHostPort(nodeAddr); err != nil {
 			nodeAddr = nodeAddr + ":" + defaultPort
 		}
-		if err := p.router.Join("tcp4", nodeAddr); err != nil {
+		if err := p.join(nodeAddr); err != nil {
 			failed = append(failed, nodeAddr)
 		}
 	}
@@ -115,6 +129,9 @@ func (p *PrivateServer) ExposeAPI(addr string) error {
 		Director: func(req *http.Request) {
 			req.URL.Scheme = "http"
 			req.URL.Host = "objstore-" + p.nodeID
+			// external tools get JSON
+			req.Header.Set("Accept", cluster.ContentTypeJSON)
+			req.Header.Del("Accept-Encoding")
 		},
 	}
 	return http.ListenAndServe(addr, privateProxy)
@@ -166,13 +183,19 @@ func getAddr(host uint64, port uint32) string {
 
 func (p *PrivateServer) RouteAPI(store objstore.Store) {
 	r := gin.Default()
+	r.Use(advertiseCodec)
 	r.GET("/private/v1/ping", p.PingHandler())
 	r.GET("/private/v1/nodes", p.ListNodesHandler())
 	r.POST("/private/v1/announce", p.AnnounceHandler(store))
 	r.GET("/private/v1/get/:id", p.GetHandler(store))
+	r.GET("/private/v1/meta/:id", p.MetaHandler(store))
 	r.POST("/private/v1/message", p.MessageHandler(store))
 	r.POST("/private/v1/put", p.PutHandler(store))
 	r.POST("/private/v1/sync", p.SyncHandler(store))
+	r.POST("/private/v1/sync/chunk", p.SyncChunkHandler(store))
+	r.POST("/private/v2/sync", p.SyncChangesHandler(store))
+	r.POST("/private/v1/merkle", p.MerkleHandler(store))
+	r.POST("/private/v1/ranges", p.RangesHandler(store))
 	r.POST("/private/v1/delete/:id", p.DeleteHandler(store))
 	p.mux = r
 }
@@ -203,11 +226,11 @@ func (p *PrivateServer) ListNodesHandler() gin.HandlerFunc {
 
 func (p *PrivateServer) AnnounceHandler(store objstore.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var event *objstore.EventAnnounce
-		if err := c.BindJSON(&event); err != nil {
+		var event cluster.EventAnnounce
+		if !bind(c, &event) {
 			return
 		}
-		store.ReceiveEventAnnounce(event)
+		store.ReceiveEventAnnounce((*objstore.EventAnnounce)(&event))
 		c.Status(200)
 	}
 }
@@ -239,8 +262,26 @@ func (p *PrivateServer) GetHandler(store objstore.Store) gin.HandlerFunc {
 	}
 }
 
+func (p *PrivateServer) MetaHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		meta, err := store.HeadObject(c.Param("id"))
+		if err == objstore.ErrNotFound {
+			c.Status(404)
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		render(c, 200, (*journal.FileMeta)(meta))
+	}
+}
+
 func serveMeta(c *gin.Context, meta *objstore.FileMeta) {
 	c.Header("X-Meta-ID", meta.ID)
+	c.Header("ETag", etag(meta))
+	if len(meta.Key) > 0 {
+		c.Header("X-Meta-Key", meta.Key)
+	}
 	if len(meta.Name) > 0 {
 		c.Header("X-Meta-Name", meta.Name)
 	}
@@ -249,6 +290,9 @@ func serveMeta(c *gin.Context, meta *objstore.FileMeta) {
 		c.Header("X-Meta-UserMeta", string(user))
 	}
 	c.Header("X-Meta-ConsistencyLevel", strconv.Itoa(int(meta.Consistency)))
+	if meta.Replicas > 0 {
+		c.Header("X-Meta-Replicas", strconv.Itoa(meta.Replicas))
+	}
 	if meta.IsSymlink {
 		c.Header("X-Meta-Symlink", "true")
 	}
@@ -269,6 +313,9 @@ func serveObject(c *gin.Context, r io.ReadCloser, meta *objstore.FileMeta) {
 	}
 	// actually do all the work http.ServeContent does, but without support
 	// of ranges and partial reads due to lack of io.Seeker interface.
+	if notModified(c, meta) {
+		return
+	}
 	if !ts.IsZero() {
 		c.Header("Last-Modified", ts.UTC().Format(http.TimeFormat))
 	}
@@ -285,75 +332,248 @@ func (p *PrivateServer) PutHandler(store objstore.Store) gin.HandlerFunc {
 }
 
 func putObject(c *gin.Context, store objstore.Store) {
-	userMeta := func(data string) map[string]string {
-		if len(data) == 0 {
-			return nil
-		}
-		var v map[string]string
-		json.Unmarshal([]byte(data), &v)
-		return v
-	}
 	size, _ := strconv.ParseInt(c.Request.Header.Get("Content-Length"), 10, 64)
+	key := keyParam(c)
+	if !checkKey(c, store, key) {
+		return
+	}
+	if isConditionalPut(c) && len(key) > 0 {
+		defer lockKey(nsName(c), key)()
+	}
 	meta := &objstore.FileMeta{
-		ID:        c.Request.Header.Get("X-Meta-ID"),
+		ID:        putID(c),
+		Key:       key,
 		Name:      c.Request.Header.Get("X-Meta-Name"),
 		UserMeta:  userMeta(c.Request.Header.Get("X-Meta-UserMeta")),
 		Timestamp: time.Now().UnixNano(),
 		Size:      size,
 	}
+	var prev *objstore.FileMeta
+	if len(key) > 0 {
+		// objects put by keys get new IDs, unless specified, and replace objects previously put by the same keys
+		var err error
+		if prev, err = store.LookupKey(nsName(c), key); err != nil && err != objstore.ErrNotFound {
+			c.String(500, "error: %v", err)
+			return
+		}
+		if len(meta.ID) == 0 {
+			meta.ID = objstore.GenerateID()
+		}
+		if len(meta.Name) == 0 {
+			meta.Name = path.Base(key)
+		}
+	}
 	if len(meta.ID) == 0 {
 		c.String(400, "error: ID not specified, use /id to get one")
 		return
-	} else if !objstore.CheckID(meta.ID) {
-		err := fmt.Errorf("objstore: not a valid ULID: %s", meta.ID)
+	} else if !putOptions(c, meta) {
+		return
+	}
+	if isConditionalPut(c) {
+		// the object being put and the one the key is mapped to are locked, as writes by ID may change either
+		ids := []string{meta.ID}
+		if prev != nil {
+			ids = append(ids, prev.ID)
+		}
+		defer lockObjects(ids...)()
+		// objects put by keys are checked by the version of the object the key is mapped to
+		var current *objstore.FileMeta
+		var ok bool
+		if len(key) == 0 {
+			current, ok = currentObject(c, store, meta.ID, meta.Replicas)
+		} else if prev != nil {
+			current, ok = currentObject(c, store, prev.ID, prev.Replicas)
+		} else {
+			ok = true
+		}
+		if !ok || !putAllowed(c, current) {
+			return
+		}
+	}
+	if _, err := store.PutObject(c.Request.Body, meta); err == objstore.ErrQuotaExceeded {
+		c.String(507, "error: %v", err)
+		return
+	} else if err != nil {
 		c.String(400, "error: %v", err)
 		return
 	}
+	if prev != nil && prev.ID != meta.ID {
+		if _, err := store.DeleteObject(prev.ID); err != nil && err != objstore.ErrNotFound {
+			log.Println("[WARN] failed to delete replaced object:", err)
+		}
+	}
+	c.Header("X-Meta-ID", meta.ID)
+	c.Header("ETag", etag(meta))
+	c.Status(200)
+}
+
+func userMeta(data string) map[string]string {
+	if len(data) == 0 {
+		return nil
+	}
+	var v map[string]string
+	json.Unmarshal([]byte(data), &v)
+	return v
+}
+
+// putOptions checks the ID of the object being put and places it into the namespace of the request,
+// sets the consistency level and replication factor from headers. Responds with 400 if they are invalid.
+func putOptions(c *gin.Context, meta *objstore.FileMeta) bool {
+	if !objstore.CheckID(meta.ID) {
+		err := fmt.Errorf("objstore: not a valid ULID: %s", meta.ID)
+		c.String(400, "error: %v", err)
+		return false
+	}
+	var defaultLevel objstore.ConsistencyLevel
+	if v, ok := c.Get(namespaceKey); ok {
+		ns := v.(*objstore.Namespace)
+		meta.ID = journal.JoinID(ns.Name, meta.ID)
+		defaultLevel = ns.Consistency
+	}
 	levelData := c.Request.Header.Get("X-Meta-ConsistencyLevel")
 	if len(levelData) == 0 {
-		level, _ := (objstore.ConsistencyLevel)(0).Check()
+		level, _ := defaultLevel.Check()
 		meta.Consistency = level
 	} else {
 		n, _ := strconv.Atoi(levelData)
 		level, err := (objstore.ConsistencyLevel)(n).Check()
 		if err != nil {
 			c.String(400, "error: %v", err)
-			return
+			return false
 		}
 		meta.Consistency = level
 	}
-	if _, err := store.PutObject(c.Request.Body, meta); err != nil {
-		c.String(400, "error: %v", err)
-		return
+	if replicasData := c.Request.Header.Get("X-Meta-Replicas"); len(replicasData) > 0 {
+		n, err := strconv.Atoi(replicasData)
+		if err != nil || n < 0 {
+			c.String(400, "error: invalid replication factor: %s", replicasData)
+			return false
+		}
+		meta.Replicas = n
 	}
-	c.Status(200)
-}
-
-type SyncResponse struct {
-	Added   objstore.FileMetaList `json:"list_added"`
-	Deleted objstore.FileMetaList `json:"list_deleted"`
+	return true
 }
 
 func (p *PrivateServer) SyncHandler(store objstore.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var list objstore.FileMetaList
-		if err := c.BindJSON(&list); err != nil {
+		var list journal.FileMetaList
+		if !bind(c, &list) {
 			return
 		}
-		added, deleted, err := store.Diff(list)
-		if err != nil {
+		added, deleted, changed, err := store.Diff((objstore.FileMetaList)(list))
+		if err == objstore.ErrResyncPending {
+			c.String(503, "error: %v", err)
+			return
+		} else if err != nil {
 			c.String(400, "error: %v", err)
 			return
 		}
-		c.JSON(200, SyncResponse{
-			Added:   added,
-			Deleted: deleted,
+		for _, change := range changed {
+			// the requester has a newer version of the entry
+			if !change.Prev.Supersedes(change.Next) {
+				continue
+			}
+			event := &objstore.EventAnnounce{
+				Type:     objstore.EventFileAdded,
+				FileMeta: change.Prev,
+			}
+			if change.Prev.IsDeleted {
+				event.Type = objstore.EventFileDeleted
+			}
+			store.ReceiveEventAnnounce(event)
+		}
+		render(c, 200, &cluster.SyncResponse{
+			Added:   (journal.FileMetaList)(added),
+			Deleted: (journal.FileMetaList)(deleted),
+			Changed: (journal.FileMetaChangeList)(changed),
 		})
 	}
 }
 
+func (p *PrivateServer) SyncChunkHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req cluster.SyncChunkRequest
+		if !bind(c, &req) {
+			return
+		}
+		diff, err := store.DiffChunk(req.After, (objstore.FileMetaList)(req.List), req.Last)
+		if err == objstore.ErrResyncPending {
+			c.String(503, "error: %v", err)
+			return
+		} else if err != nil {
+			c.String(400, "error: %v", err)
+			return
+		}
+		render(c, 200, (*journal.ChunkDiff)(diff))
+	}
+}
+
+func (p *PrivateServer) SyncChangesHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req cluster.SyncChangesRequest
+		if !bind(c, &req) {
+			return
+		}
+		changes, err := store.Changes(req.Watermarks, req.Limit, req.Resync)
+		if err == objstore.ErrResyncPending {
+			c.String(503, "error: %v", err)
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		render(c, 200, (*cluster.SyncChanges)(changes))
+	}
+}
+
+func (p *PrivateServer) MerkleHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req cluster.RangesRequest
+		if !bind(c, &req) {
+			return
+		}
+		ranges, err := store.HashRanges(req.Prefixes)
+		if err == objstore.ErrResyncPending {
+			c.String(503, "error: %v", err)
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		resp := &cluster.HashRangesResponse{
+			Ranges: make(map[string][]*journal.RangeHash, len(ranges)),
+		}
+		for prefix, children := range ranges {
+			list := make([]*journal.RangeHash, 0, len(children))
+			for _, r := range children {
+				list = append(list, (*journal.RangeHash)(r))
+			}
+			resp.Ranges[prefix] = list
+		}
+		render(c, 200, resp)
+	}
+}
+
+func (p *PrivateServer) RangesHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req cluster.RangesRequest
+		if !bind(c, &req) {
+			return
+		}
+		list, err := store.ExportRanges(req.Prefixes)
+		if err == objstore.ErrResyncPending {
+			c.String(503, "error: %v", err)
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		render(c, 200, (journal.FileMetaList)(list))
+	}
+}
+
 func deleteObject(c *gin.Context, store objstore.Store) {
-	meta, err := store.DeleteObject(c.Param("id"))
+	meta, err := store.DeleteObject(journal.JoinID(nsName(c), c.Param("id")))
 	if err == objstore.ErrNotFound {
 		c.Status(404)
 		return
@@ -372,3 +592,33 @@ func (p *PrivateServer) DeleteHandler(store objstore.Store) gin.HandlerFunc {
 		deleteObject(c, store)
 	}
 }
+
+// advertiseCodec lets peers know that request bodies may be sent as msgpack, optionally compressed.
+func advertiseCodec(c *gin.Context) {
+	cluster.AdvertiseCodec(c.Writer.Header())
+	c.Next()
+}
+
+// bind decodes the request body according to its content type, responds with 400 on failure.
+func bind(c *gin.Context, v interface{}) bool {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	c.Request.Body.Close()
+	if err == nil {
+		err = cluster.Decode(c.Request.Header, body, v)
+	}
+	if err != nil {
+		c.String(400, "error: %v", err)
+		return false
+	}
+	return true
+}
+
+// render encodes the response body using the best codec accepted by the requester.
+func render(c *gin.Context, code int, v interface{}) {
+	body, err := cluster.AcceptedCodec(c.Request.Header).Encode(c.Writer.Header(), v)
+	if err != nil {
+		c.String(500, "error: %v", err)
+		return
+	}
+	c.Data(code, c.Writer.Header().Get("Content-Type"), body)
+}
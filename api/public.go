@@ -1,16 +1,28 @@
 package api
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"sphere.software/objstore"
+	"sphere.software/objstore/journal"
 )
 
 type PublicServer struct {
 	nodeID string
 
+	auth      Authenticator
+	presigner *Presigner
+	accessLog *log.Logger
+
 	mux *gin.Engine
 }
 
@@ -20,23 +32,232 @@ func NewPublicServer(nodeID string) *PublicServer {
 	}
 }
 
+// SetAuthenticator enables authentication of requests, otherwise the API is open to anyone.
+func (p *PublicServer) SetAuthenticator(auth Authenticator) {
+	p.auth = auth
+}
+
+// SetAccessLog enables the access log, where each request is recorded with the API key used.
+// Unauthorized attempts are recorded in the standard log, unless the access log is set.
+func (p *PublicServer) SetAccessLog(w io.Writer) {
+	p.accessLog = log.New(w, "", log.LstdFlags)
+}
+
 func (p *PublicServer) ListenAndServe(addr string) error {
 	return p.mux.Run(addr)
 }
 
 func (p *PublicServer) RouteAPI(store objstore.Store) {
 	r := gin.Default()
-	r.GET("/api/v1/get/:id", p.GetHandler(store))
-	r.GET("/api/v1/meta/:id", p.MetaHandler(store))
-	r.POST("/api/v1/put", p.PutHandler(store))
-	r.POST("/api/v1/delete/:id", p.DeleteHandler(store))
+	if p.auth == nil {
+		log.Println("[WARN] public API is not authenticated")
+	}
+	r.Use(p.logAccess)
+	p.routeObjects(r.Group("/api/v1"), store)
+	ns := r.Group("/api/v1/ns/:ns", p.namespace(store))
+	p.routeObjects(ns, store)
+	ns.GET("/usage", p.authorize(PermissionRead, "", noID), p.UsageHandler(store))
 	r.GET("/api/v1/id", p.IDHandler())
 	r.GET("/api/v1/version", p.VersionHandler())
 	r.GET("/api/v1/ping", p.PingHandler())
-	r.GET("/api/v1/stats", p.StatsHandler(store))
+	r.GET("/api/v1/stats", p.authorize(PermissionRead, "", noID), p.StatsHandler(store))
+	r.GET("/api/v1/rebalance", p.authorize(PermissionRead, "", noID), p.RebalanceHandler(store))
+	r.GET("/api/v1/antientropy", p.authorize(PermissionRead, "", noID), p.AntiEntropyHandler(store))
 	p.mux = r
 }
 
+// routeObjects routes object operations, either of the default namespace or of the namespace
+// specified in the path of the group.
+func (p *PublicServer) routeObjects(r *gin.RouterGroup, store objstore.Store) {
+	// the catch-all parameter serves both /get/:id and /get/by-key/*path
+	r.GET("/get/*id", p.authorize(PermissionRead, "GET", getID), p.GetHandler(store))
+	r.GET("/meta/:id", p.authorize(PermissionRead, "", idParam), p.MetaHandler(store))
+	r.PATCH("/meta/:id", p.authorize(PermissionWrite, "", idParam), p.UpdateMetaHandler(store))
+	r.POST("/put", p.authorize(PermissionWrite, "PUT", putID), p.PutHandler(store))
+	r.PUT("/put", p.authorize(PermissionWrite, "PUT", putID), p.PutHandler(store))
+	r.POST("/put/by-key/*key", p.authorize(PermissionWrite, "", keyParam), p.PutHandler(store))
+	r.PUT("/put/by-key/*key", p.authorize(PermissionWrite, "", keyParam), p.PutHandler(store))
+	r.POST("/delete/:id", p.authorize(PermissionDelete, "", idParam), p.DeleteHandler(store))
+	r.POST("/copy/:id", p.authorize(PermissionRead, "", idParam), p.CopyHandler(store))
+	r.GET("/list", p.authorize(PermissionRead, "", nil), p.ListHandler(store))
+	r.GET("/query", p.authorize(PermissionRead, "", nil), p.QueryHandler(store))
+	r.POST("/presign", p.authenticate, p.PresignHandler())
+	r.POST("/batch", p.authenticate, p.BatchHandler(store))
+	r.POST("/uploads", p.authorize(PermissionWrite, "", nil), p.InitiateUploadHandler(store))
+	r.GET("/uploads/:upload", p.authenticate, p.GetUploadHandler(store))
+	r.PUT("/uploads/:upload/:part", p.authenticate, p.UploadPartHandler(store))
+	r.POST("/uploads/:upload/complete", p.authenticate, p.CompleteUploadHandler(store))
+	r.DELETE("/uploads/:upload", p.authenticate, p.AbortUploadHandler(store))
+}
+
+const (
+	principalKey = "principal"
+	authErrorKey = "auth_error"
+)
+
+func idParam(c *gin.Context) string {
+	return c.Param("id")
+}
+
+const byKeyPrefix = "by-key/"
+
+// getTarget gets ID of the object to get, or its key for /api/v1/get/by-key/*path requests.
+func getTarget(c *gin.Context) (id, key string) {
+	id = strings.TrimPrefix(c.Param("id"), "/")
+	if strings.HasPrefix(id, byKeyPrefix) {
+		return "", strings.TrimPrefix(id, byKeyPrefix)
+	}
+	return id, ""
+}
+
+// getID is the ID of the object to get, or its key, as keys bound to prefixes
+// are matched against object keys when objects are accessed by keys.
+func getID(c *gin.Context) string {
+	id, key := getTarget(c)
+	if len(key) > 0 {
+		return key
+	}
+	return id
+}
+
+func keyParam(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("key"), "/")
+}
+
+// putID gets ID of the object being uploaded from X-Meta-ID header,
+// or from the query of a presigned URL.
+func putID(c *gin.Context) string {
+	if id := c.Request.Header.Get("X-Meta-ID"); len(id) > 0 {
+		return id
+	}
+	return c.Query("id")
+}
+
+func noID(c *gin.Context) string {
+	return ""
+}
+
+// authorize checks that the requester is allowed to do the operation on the object. Requests
+// to presigned URLs of the method are authorized by the URL signature instead. Operations on
+// many objects have no idOf, they are authorized by the permission only and handlers must leave
+// out objects not covered by the key, see covered.
+func (p *PublicServer) authorize(perm Permission, presignMethod string,
+	idOf func(c *gin.Context) string) gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		if p.auth == nil {
+			return
+		}
+		if sig := c.Query("sig"); len(sig) > 0 && len(presignMethod) > 0 {
+			p.verifyPresigned(c, presignMethod, journal.JoinID(nsName(c), idOf(c)), sig)
+			return
+		}
+		if p.authenticate(c); c.IsAborted() {
+			return
+		} else if idOf != nil {
+			p.allowed(c, perm, idOf(c))
+			return
+		}
+		v, _ := c.Get(principalKey)
+		if principal := v.(*Principal); principal.Permissions&perm != perm || !permitsNamespace(c, principal) {
+			p.deny(c, 403, ErrForbidden)
+		}
+	}
+}
+
+// authenticate identifies the requester, responds with 401 if credentials are missing or invalid.
+func (p *PublicServer) authenticate(c *gin.Context) {
+	if p.auth == nil {
+		return
+	}
+	principal, err := p.auth.Authenticate(c.Request)
+	if err != nil {
+		p.deny(c, 401, err)
+		return
+	}
+	c.Set(principalKey, principal)
+}
+
+// allowed checks the permission of the authenticated requester, responds with 403 if not allowed.
+func (p *PublicServer) allowed(c *gin.Context, perm Permission, id string) bool {
+	if p.permits(c, perm, id) {
+		return true
+	}
+	p.deny(c, 403, ErrForbidden)
+	return false
+}
+
+// permits reports whether the authenticated requester has the permission on the object.
+func (p *PublicServer) permits(c *gin.Context, perm Permission, id string) bool {
+	if p.auth == nil {
+		return true
+	}
+	v, ok := c.Get(principalKey)
+	return ok && v.(*Principal).Allows(perm, id) && permitsNamespace(c, v.(*Principal))
+}
+
+// covered leaves out objects of the list not covered by the prefixes of the authenticated requester,
+// objects are covered either by their plain IDs or by their keys.
+func (p *PublicServer) covered(c *gin.Context, list objstore.FileMetaList) objstore.FileMetaList {
+	v, ok := c.Get(principalKey)
+	if p.auth == nil || !ok || len(v.(*Principal).Prefixes) == 0 {
+		return list
+	}
+	principal := v.(*Principal)
+	filtered := list[:0]
+	for _, meta := range list {
+		_, id := journal.SplitID(meta.ID)
+		if principal.Covers(id) || (len(meta.Key) > 0 && principal.Covers(meta.Key)) {
+			filtered = append(filtered, meta)
+		}
+	}
+	return filtered
+}
+
+func (p *PublicServer) verifyPresigned(c *gin.Context, method, id, sig string) {
+	if p.presigner == nil {
+		p.deny(c, 401, errors.New("presigned URLs are not enabled"))
+		return
+	}
+	if err := p.presigner.Verify(method, id, c.Query("exp"), sig); err != nil {
+		p.deny(c, 401, err)
+		return
+	}
+	c.Set(principalKey, &Principal{
+		KeyID: "presigned",
+	})
+}
+
+func (p *PublicServer) deny(c *gin.Context, code int, err error) {
+	c.Set(authErrorKey, err)
+	c.String(code, "error: %v", err)
+	c.Abort()
+}
+
+// logAccess records the request in the access log, along with the reason of denial if any.
+func (p *PublicServer) logAccess(c *gin.Context) {
+	ts := time.Now()
+	c.Next()
+	authErr, denied := c.Get(authErrorKey)
+	if p.accessLog == nil {
+		if denied {
+			log.Printf("[WARN] unauthorized request from %s: %s %s: %v",
+				c.ClientIP(), c.Request.Method, c.Request.URL.Path, authErr)
+		}
+		return
+	}
+	keyID := "-"
+	if v, ok := c.Get(principalKey); ok {
+		keyID = v.(*Principal).KeyID
+	}
+	line := fmt.Sprintf("%s %s %s %s %d %v", c.ClientIP(), keyID,
+		c.Request.Method, c.Request.URL.Path, c.Writer.Status(), time.Since(ts))
+	if denied {
+		line = fmt.Sprintf("%s denied: %v", line, authErr)
+	}
+	p.accessLog.Println(line)
+}
+
 func (p *PublicServer) PingHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.String(200, p.nodeID)
@@ -79,7 +300,10 @@ type DiskStats struct {
 }
 
 type Stats struct {
-	DiskStats *DiskStats `json:"disk_stats"`
+	DiskStats     *DiskStats           `json:"disk_stats"`
+	HintStats     *objstore.HintStats  `json:"hint_stats"`
+	InboundQueue  *objstore.QueueStats `json:"inbound_queue"`
+	OutboundQueue *objstore.QueueStats `json:"outbound_queue"`
 	// TODO: other stats
 }
 
@@ -100,10 +324,24 @@ func (p *PublicServer) StatsHandler(store objstore.Store) gin.HandlerFunc {
 			stats.DiskStats.GBytesUsed = float64(ds.BytesUsed) / GB
 			stats.DiskStats.GBytesFree = float64(ds.BytesFree) / GB
 		}
+		stats.HintStats = store.HintStats()
+		stats.InboundQueue, stats.OutboundQueue = store.QueueStats()
 		c.JSON(200, stats)
 	}
 }
 
+func (p *PublicServer) RebalanceHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, store.RebalanceStatus())
+	}
+}
+
+func (p *PublicServer) AntiEntropyHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, store.AntiEntropyStatus())
+	}
+}
+
 func (p *PublicServer) GetHandler(store objstore.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var fetch bool
@@ -111,7 +349,33 @@ func (p *PublicServer) GetHandler(store objstore.Store) gin.HandlerFunc {
 		if strings.ToLower(fetchOption) == "true" || fetchOption == "1" {
 			fetch = true
 		}
-		r, meta, err := store.FindObject(c, c.Param("id"), fetch)
+		id, key := getTarget(c)
+		if len(key) > 0 && !checkKey(c, store, key) {
+			return
+		} else if len(key) == 0 && !checkID(c, id) {
+			return
+		}
+		id = journal.JoinID(nsName(c), id)
+		if len(key) > 0 {
+			meta, err := store.LookupKey(nsName(c), key)
+			if err == nil {
+				id = meta.ID
+			} else if err != objstore.ErrNotFound {
+				c.String(500, "error: %v", err)
+				return
+			} else if !fetch {
+				c.Status(404)
+				return
+			} else {
+				// the key is not known on the cluster, try to fetch by key from the remote storage
+				id = journal.JoinID(nsName(c), key)
+			}
+		}
+		// revalidate cached copies before the body is read, maybe from other nodes
+		if meta, err := store.HeadObject(id); err == nil && !meta.IsDeleted && notModified(c, meta) {
+			return
+		}
+		r, meta, err := store.FindObject(c, id, fetch)
 		if err == objstore.ErrNotFound {
 			if meta != nil {
 				serveMeta(c, meta)
@@ -128,7 +392,10 @@ func (p *PublicServer) GetHandler(store objstore.Store) gin.HandlerFunc {
 
 func (p *PublicServer) MetaHandler(store objstore.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		meta, err := store.HeadObject(c.Param("id"))
+		if !checkID(c, c.Param("id")) {
+			return
+		}
+		meta, err := store.HeadObject(journal.JoinID(nsName(c), c.Param("id")))
 		if err == objstore.ErrNotFound {
 			if meta != nil {
 				serveMeta(c, meta)
@@ -143,6 +410,97 @@ func (p *PublicServer) MetaHandler(store objstore.Store) gin.HandlerFunc {
 	}
 }
 
+// UpdateMetaHandler changes name and user meta data of the object given as JSON, fields not set
+// are left unchanged. Honours If-Match and If-None-Match like puts do.
+func (p *PublicServer) UpdateMetaHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkID(c, c.Param("id")) {
+			return
+		}
+		var update objstore.MetaUpdate
+		if err := c.BindJSON(&update); err != nil {
+			return
+		}
+		id := journal.JoinID(nsName(c), c.Param("id"))
+		if isConditionalPut(c) {
+			defer lockObjects(id)()
+			current, ok := currentObject(c, store, id, 0)
+			if !ok || !putAllowed(c, current) {
+				return
+			}
+		}
+		meta, err := store.UpdateMeta(id, &update)
+		if err == objstore.ErrNotFound {
+			c.String(404, "error: %v", err)
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		c.Header("ETag", etag(meta))
+		c.JSON(200, meta)
+	}
+}
+
+// CopyHandler creates a new object having the body of the object, the new object takes meta data
+// from the same headers as puts do, unset fields are taken from the source object. A new ID is
+// generated unless specified in X-Meta-ID.
+func (p *PublicServer) CopyHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkID(c, c.Param("id")) {
+			return
+		}
+		src, err := store.HeadObject(journal.JoinID(nsName(c), c.Param("id")))
+		if err == objstore.ErrNotFound || (err == nil && src.IsDeleted) {
+			c.String(404, "error: %v", objstore.ErrNotFound)
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		meta := &objstore.FileMeta{
+			ID:        putID(c),
+			Name:      src.Name,
+			UserMeta:  src.UserMeta,
+			Timestamp: time.Now().UnixNano(),
+			Replicas:  src.Replicas,
+		}
+		if len(meta.ID) == 0 {
+			meta.ID = objstore.GenerateID()
+		}
+		if !p.allowed(c, PermissionWrite, meta.ID) {
+			return
+		}
+		if name := c.Request.Header.Get("X-Meta-Name"); len(name) > 0 {
+			meta.Name = name
+		}
+		if data := c.Request.Header.Get("X-Meta-UserMeta"); len(data) > 0 {
+			meta.UserMeta = userMeta(data)
+		}
+		if !putOptions(c, meta) {
+			return
+		} else if len(c.Request.Header.Get("X-Meta-ConsistencyLevel")) == 0 {
+			meta.Consistency = src.Consistency
+		}
+		meta, err = store.CopyObject(c, src.ID, meta)
+		switch err {
+		case nil:
+		case objstore.ErrNotFound:
+			c.String(404, "error: %v", err)
+			return
+		case objstore.ErrQuotaExceeded:
+			c.String(507, "error: %v", err)
+			return
+		default:
+			c.String(500, "error: %v", err)
+			return
+		}
+		c.Header("X-Meta-ID", meta.ID)
+		c.Header("ETag", etag(meta))
+		c.JSON(200, meta)
+	}
+}
+
 func (p *PublicServer) PutHandler(store objstore.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		putObject(c, store)
@@ -151,6 +509,159 @@ func (p *PublicServer) PutHandler(store objstore.Store) gin.HandlerFunc {
 
 func (p *PublicServer) DeleteHandler(store objstore.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if !checkID(c, c.Param("id")) {
+			return
+		}
 		deleteObject(c, store)
 	}
 }
+
+// ListResponse is a page of objects, Next is the token of the next page if there is one.
+type ListResponse struct {
+	Objects objstore.FileMetaList `json:"objects"`
+	Next    string                `json:"next,omitempty"`
+}
+
+// ListHandler lists objects in the order of IDs, i.e. in the order of upload time. Deleted objects
+// are not listed unless deleted=true or deleted=any is set, since and until bound upload time.
+func (p *PublicServer) ListHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := &objstore.ListFilter{
+			Namespace: nsName(c),
+		}
+		var err error
+		if filter.IsDeleted, err = boolFilter(c.DefaultQuery("deleted", "false")); err != nil {
+			c.String(400, "error: invalid deleted filter: %v", err)
+			return
+		} else if filter.IsSymlink, err = boolFilter(c.Query("symlink")); err != nil {
+			c.String(400, "error: invalid symlink filter: %v", err)
+			return
+		}
+		if v := c.Query("consistency"); len(v) > 0 {
+			n, _ := strconv.Atoi(v)
+			level, err := (objstore.ConsistencyLevel)(n).Check()
+			if err != nil {
+				c.String(400, "error: %v", err)
+				return
+			}
+			filter.Consistency = &level
+		}
+		if v := c.Query("since"); len(v) > 0 {
+			t, err := parseTime(v)
+			if err != nil {
+				c.String(400, "error: invalid since: %v", err)
+				return
+			}
+			filter.Since = journal.JoinID(filter.Namespace, journal.ULIDBound(t))
+		}
+		if v := c.Query("until"); len(v) > 0 {
+			t, err := parseTime(v)
+			if err != nil {
+				c.String(400, "error: invalid until: %v", err)
+				return
+			}
+			filter.Until = journal.JoinID(filter.Namespace, journal.ULIDBound(t))
+		}
+		limit, ok := listLimit(c)
+		if !ok {
+			return
+		}
+		list, next, err := store.ListObjects(c.Query("start"), limit, filter)
+		if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		// pages of keys bound to prefixes may have fewer objects, the listing goes on until next is empty
+		list = p.covered(c, list)
+		if list == nil {
+			list = objstore.FileMetaList{}
+		}
+		c.JSON(200, ListResponse{
+			Objects: list,
+			Next:    next,
+		})
+	}
+}
+
+// QueryHandler lists live objects by the prefix of names and exact values of user meta,
+// e.g. name_prefix=report&meta.project=X, in the order of the index used. At least one of
+// the user meta keys must be indexed unless the name prefix is set.
+func (p *PublicServer) QueryHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := &objstore.Query{
+			NamePrefix: c.Query("name_prefix"),
+			Meta:       make(map[string]string),
+		}
+		for k, v := range c.Request.URL.Query() {
+			if strings.HasPrefix(k, "meta.") && len(v) > 0 {
+				q.Meta[strings.TrimPrefix(k, "meta.")] = v[0]
+			}
+		}
+		start, err := base64.RawURLEncoding.DecodeString(c.Query("start"))
+		if err != nil {
+			c.String(400, "error: invalid start: %v", err)
+			return
+		}
+		limit, ok := listLimit(c)
+		if !ok {
+			return
+		}
+		list, next, err := store.QueryObjects(nsName(c), q, string(start), limit)
+		if err == objstore.ErrNotIndexed {
+			c.String(400, "error: %v", err)
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		list = p.covered(c, list)
+		if list == nil {
+			list = objstore.FileMetaList{}
+		}
+		c.JSON(200, ListResponse{
+			Objects: list,
+			Next:    base64.RawURLEncoding.EncodeToString([]byte(next)),
+		})
+	}
+}
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// listLimit parses the page size, responds with 400 if it's invalid.
+func listLimit(c *gin.Context) (int, bool) {
+	v := c.Query("limit")
+	if len(v) == 0 {
+		return defaultListLimit, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		c.String(400, "error: invalid limit: %s", v)
+		return 0, false
+	} else if n > maxListLimit {
+		return maxListLimit, true
+	}
+	return n, true
+}
+
+// boolFilter parses an optional boolean filter, empty and "any" values match anything.
+func boolFilter(v string) (*bool, error) {
+	if len(v) == 0 || v == "any" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// parseTime accepts either RFC 3339 time or Unix time in seconds.
+func parseTime(v string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
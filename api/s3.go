@@ -0,0 +1,640 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sphere.software/objstore"
+	"sphere.software/objstore/journal"
+)
+
+// S3Server implements the core of the Amazon S3 REST API on top of the store, so S3 clients
+// can use the cluster directly. There is the only bucket, objects are stored under S3 keys
+// mapped onto object IDs, user metadata is kept as FileMeta.UserMeta.
+type S3Server struct {
+	bucket string
+	keys   *KeyStore
+
+	mux *gin.Engine
+}
+
+func NewS3Server(bucket string) *S3Server {
+	return &S3Server{
+		bucket: bucket,
+	}
+}
+
+// SetKeyStore enables SigV4 authentication, the access key ID is the ID of an API key
+// and the secret access key is its secret.
+func (s *S3Server) SetKeyStore(keys *KeyStore) {
+	s.keys = keys
+}
+
+func (s *S3Server) ListenAndServe(addr string) error {
+	return s.mux.Run(addr)
+}
+
+func (s *S3Server) RouteAPI(store objstore.Store) {
+	r := gin.Default()
+	if s.keys == nil {
+		log.Println("[WARN] S3 API is not authenticated")
+	}
+	r.Use(s.authenticate)
+	r.Any("/*path", s.Handler(store))
+	s.mux = r
+}
+
+const (
+	s3Namespace  = "http://s3.amazonaws.com/doc/2006-03-01/"
+	s3TimeFormat = "2006-01-02T15:04:05.000Z"
+	s3MetaPrefix = "X-Amz-Meta-"
+	s3MaxKeys    = 1000
+	// sigV4Key is the context key of the verified request signature.
+	sigV4Key = "sigv4"
+)
+
+// s3Unsupported lists subresources of buckets and objects that are not implemented.
+var s3Unsupported = []string{"acl", "cors", "lifecycle", "policy", "tagging",
+	"uploads", "uploadId", "versioning", "versions", "website", "delete"}
+
+// Handler dispatches S3 requests, both path-style and virtual-hosted-style.
+func (s *S3Server) Handler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bucket, key := s.resolve(c.Request)
+		keyErr := keyError(store, "", key)
+		for _, sub := range s3Unsupported {
+			if _, ok := c.Request.URL.Query()[sub]; ok {
+				s3Fail(c, 501, "NotImplemented", "The subresource is not supported: "+sub)
+				return
+			}
+		}
+		switch {
+		case len(bucket) == 0:
+			if c.Request.Method != "GET" {
+				s3Fail(c, 405, "MethodNotAllowed", "The method is not allowed against this resource.")
+				return
+			}
+			s.listBuckets(c)
+		case bucket != s.bucket:
+			s3Fail(c, 404, "NoSuchBucket", "The specified bucket does not exist.")
+		case len(key) == 0:
+			switch c.Request.Method {
+			case "HEAD":
+				c.Status(200)
+			case "GET":
+				if c.Query("list-type") != "2" {
+					s3Fail(c, 501, "NotImplemented", "Only ListObjectsV2 is supported.")
+					return
+				}
+				s.listObjects(c, store)
+			default:
+				s3Fail(c, 501, "NotImplemented", "Bucket operations are not supported.")
+			}
+		case keyErr != nil:
+			// such keys would be taken for keys of namespaces in the remote storage
+			s3Fail(c, 400, "InvalidArgument", keyErr.Error())
+		default:
+			switch c.Request.Method {
+			case "GET":
+				s.getObject(c, store, key)
+			case "HEAD":
+				s.headObject(c, store, key)
+			case "PUT":
+				if len(c.Request.Header.Get("X-Amz-Copy-Source")) > 0 {
+					s.copyObject(c, store, key)
+					return
+				}
+				s.putObject(c, store, key)
+			case "DELETE":
+				s.deleteObject(c, store, key)
+			default:
+				s3Fail(c, 405, "MethodNotAllowed", "The method is not allowed against this resource.")
+			}
+		}
+	}
+}
+
+// resolve finds the bucket and the key of the request, the bucket is either
+// the first segment of the path, or a subdomain of the host.
+func (s *S3Server) resolve(r *http.Request) (bucket, key string) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	if strings.HasPrefix(host, s.bucket+".") {
+		return s.bucket, p
+	}
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
+
+func (s *S3Server) authenticate(c *gin.Context) {
+	c.Header("X-Amz-Request-Id", objstore.GenerateID())
+	if s.keys == nil {
+		return
+	}
+	principal, sig, err := verifySigV4(s.keys, c.Request)
+	if err != nil {
+		log.Printf("[WARN] unauthorized S3 request from %s: %s %s: %v",
+			c.ClientIP(), c.Request.Method, c.Request.URL.Path, err)
+		switch err {
+		case ErrInvalidCredentials:
+			s3Fail(c, 403, "SignatureDoesNotMatch", "The request signature does not match.")
+		case ErrSkewed:
+			s3Fail(c, 403, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.")
+		case ErrNoCredentials, ErrExpired:
+			s3Fail(c, 403, "AccessDenied", err.Error())
+		default:
+			s3Fail(c, 400, "AuthorizationHeaderMalformed", err.Error())
+		}
+		return
+	}
+	c.Set(principalKey, principal)
+	c.Set(sigV4Key, sig)
+}
+
+// allowed checks the permission of the requester on the key, keys bound
+// to prefixes are matched against S3 keys rather than object IDs.
+func (s *S3Server) allowed(c *gin.Context, perm Permission, key string) bool {
+	if s.keys == nil {
+		return true
+	}
+	if v, ok := c.Get(principalKey); ok && v.(*Principal).Allows(perm, key) {
+		return true
+	}
+	s3Fail(c, 403, "AccessDenied", "Access Denied")
+	return false
+}
+
+type s3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+func s3Fail(c *gin.Context, code int, errCode, message string) {
+	c.XML(code, &s3Error{
+		Code:      errCode,
+		Message:   message,
+		Resource:  c.Request.URL.Path,
+		RequestID: c.Writer.Header().Get("X-Amz-Request-Id"),
+	})
+	c.Abort()
+}
+
+func s3Time(meta *objstore.FileMeta) time.Time {
+	return time.Unix(0, meta.Timestamp).UTC()
+}
+
+func serveS3Meta(c *gin.Context, meta *objstore.FileMeta) {
+	c.Header("ETag", etag(meta))
+	c.Header("Last-Modified", s3Time(meta).Format(http.TimeFormat))
+	c.Header("Accept-Ranges", "bytes")
+	ctype := mime.TypeByExtension(path.Ext(meta.Name))
+	if len(ctype) == 0 {
+		ctype = "application/octet-stream"
+	}
+	c.Header("Content-Type", ctype)
+	for k, v := range meta.UserMeta {
+		c.Header(s3MetaPrefix+k, v)
+	}
+}
+
+func s3UserMeta(h http.Header) map[string]string {
+	var userMeta map[string]string
+	for k, v := range h {
+		if !strings.HasPrefix(k, s3MetaPrefix) || len(v) == 0 {
+			continue
+		}
+		if userMeta == nil {
+			userMeta = make(map[string]string)
+		}
+		userMeta[strings.ToLower(strings.TrimPrefix(k, s3MetaPrefix))] = v[0]
+	}
+	return userMeta
+}
+
+// find finds the object by key, responds with NoSuchKey if the key is not mapped to an object,
+// keys are never taken for IDs. The body is returned unless it's a HEAD request.
+func (s *S3Server) find(c *gin.Context, store objstore.Store, key string) (io.ReadCloser, *objstore.FileMeta) {
+	meta, err := store.LookupKey("", key)
+	if err == objstore.ErrNotFound {
+		s3Fail(c, 404, "NoSuchKey", "The specified key does not exist.")
+		return nil, nil
+	} else if err != nil {
+		s3Fail(c, 500, "InternalError", err.Error())
+		return nil, nil
+	}
+	if c.Request.Method == "HEAD" {
+		return nil, meta
+	}
+	r, meta, err := store.FindObject(c, meta.ID, true)
+	if err == objstore.ErrNotFound {
+		s3Fail(c, 404, "NoSuchKey", "The specified key does not exist.")
+		return nil, nil
+	} else if err != nil {
+		s3Fail(c, 500, "InternalError", err.Error())
+		return nil, nil
+	}
+	return r, meta
+}
+
+func (s *S3Server) headObject(c *gin.Context, store objstore.Store, key string) {
+	if !s.allowed(c, PermissionRead, key) {
+		return
+	}
+	_, meta := s.find(c, store, key)
+	if meta == nil {
+		return
+	}
+	serveS3Meta(c, meta)
+	c.Header("Content-Length", strconv.FormatInt(meta.Size, 10))
+	c.Status(200)
+}
+
+func (s *S3Server) getObject(c *gin.Context, store objstore.Store, key string) {
+	if !s.allowed(c, PermissionRead, key) {
+		return
+	}
+	r, found := s.find(c, store, key)
+	if r == nil {
+		return
+	}
+	defer r.Close()
+	serveS3Meta(c, found)
+	if seekable, ok := r.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, found.Name, s3Time(found), seekable)
+		return
+	}
+	spec := c.Request.Header.Get("Range")
+	if len(spec) == 0 {
+		c.Header("Content-Length", strconv.FormatInt(found.Size, 10))
+		c.Status(200)
+		io.CopyN(c.Writer, r, found.Size)
+		return
+	}
+	start, length, ok := parseRange(spec, found.Size)
+	if !ok {
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", found.Size))
+		s3Fail(c, 416, "InvalidRange", "The requested range is not satisfiable.")
+		return
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, start); err != nil {
+		s3Fail(c, 500, "InternalError", err.Error())
+		return
+	}
+	c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, found.Size))
+	c.Header("Content-Length", strconv.FormatInt(length, 10))
+	c.Status(206)
+	io.CopyN(c.Writer, r, length)
+}
+
+// parseRange parses a single byte range of the Range header, multiple ranges are not supported.
+func parseRange(spec string, size int64) (start, length int64, ok bool) {
+	if !strings.HasPrefix(spec, "bytes=") || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	spec = strings.TrimSpace(strings.TrimPrefix(spec, "bytes="))
+	i := strings.IndexByte(spec, '-')
+	if i < 0 {
+		return 0, 0, false
+	}
+	first, last := spec[:i], spec[i+1:]
+	if len(first) == 0 {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		} else if n > size {
+			n = size
+		}
+		return size - n, n, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	} else if len(last) == 0 {
+		return start, size - start, true
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, false
+	} else if end >= size {
+		end = size - 1
+	}
+	return start, end - start + 1, true
+}
+
+// putObject stores the body as a new object under the key, the object previously stored
+// under the key is deleted afterwards, so objects are never overwritten in place.
+func (s *S3Server) putObject(c *gin.Context, store objstore.Store, key string) {
+	if !s.allowed(c, PermissionWrite, key) {
+		return
+	}
+	var sig *sigV4
+	if v, ok := c.Get(sigV4Key); ok {
+		sig = v.(*sigV4)
+	}
+	body, size, err := s3Payload(c.Request, sig)
+	if err != nil {
+		s3Fail(c, 400, "InvalidRequest", err.Error())
+		return
+	} else if size < 0 {
+		s3Fail(c, 411, "MissingContentLength", "You must provide the Content-Length HTTP header.")
+		return
+	}
+	prev, err := store.LookupKey("", key)
+	if err != nil && err != objstore.ErrNotFound {
+		s3Fail(c, 500, "InternalError", err.Error())
+		return
+	}
+	meta := &objstore.FileMeta{
+		ID:          objstore.GenerateID(),
+		Key:         key,
+		Name:        path.Base(key),
+		UserMeta:    s3UserMeta(c.Request.Header),
+		Timestamp:   time.Now().UnixNano(),
+		Size:        size,
+		Consistency: journal.ConsistencyS3,
+	}
+	if prev != nil {
+		meta.Consistency = prev.Consistency
+		meta.Replicas = prev.Replicas
+	}
+	s.store(c, store, ioutil.NopCloser(body), meta, prev)
+	if !c.IsAborted() {
+		c.Header("ETag", etag(meta))
+		c.Status(200)
+	}
+}
+
+func (s *S3Server) store(c *gin.Context, store objstore.Store,
+	r io.ReadCloser, meta, prev *objstore.FileMeta) {
+
+	if _, err := store.PutObject(r, meta); err != nil {
+		if strings.Contains(err.Error(), ErrBadDigest.Error()) {
+			s3Fail(c, 400, "BadDigest", "The payload doesn't match the specified digest.")
+			return
+		} else if strings.Contains(err.Error(), ErrChunkSignature.Error()) {
+			s3Fail(c, 403, "SignatureDoesNotMatch", "The chunk signature does not match.")
+			return
+		}
+		s3Fail(c, 500, "InternalError", err.Error())
+		return
+	}
+	if prev != nil {
+		if _, err := store.DeleteObject(prev.ID); err != nil && err != objstore.ErrNotFound {
+			log.Println("[WARN] failed to delete replaced object:", err)
+		}
+	}
+}
+
+func (s *S3Server) deleteObject(c *gin.Context, store objstore.Store, key string) {
+	if !s.allowed(c, PermissionDelete, key) {
+		return
+	}
+	meta, err := store.LookupKey("", key)
+	if err == nil {
+		_, err = store.DeleteObject(meta.ID)
+	}
+	if err != nil && err != objstore.ErrNotFound {
+		s3Fail(c, 500, "InternalError", err.Error())
+		return
+	}
+	c.Status(204)
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
+func (s *S3Server) copyObject(c *gin.Context, store objstore.Store, key string) {
+	source := c.Request.Header.Get("X-Amz-Copy-Source")
+	if i := strings.IndexByte(source, '?'); i >= 0 {
+		source = source[:i]
+	}
+	source, err := url.PathUnescape(strings.TrimPrefix(source, "/"))
+	if err != nil {
+		s3Fail(c, 400, "InvalidArgument", "Invalid copy source encoding.")
+		return
+	}
+	parts := strings.SplitN(source, "/", 2)
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		s3Fail(c, 400, "InvalidArgument", "Copy source must specify a bucket and a key.")
+		return
+	} else if err := keyError(store, "", parts[1]); err != nil {
+		s3Fail(c, 400, "InvalidArgument", err.Error())
+		return
+	} else if parts[0] != s.bucket {
+		s3Fail(c, 404, "NoSuchBucket", "The specified bucket does not exist.")
+		return
+	}
+	replace := c.Request.Header.Get("X-Amz-Metadata-Directive") == "REPLACE"
+	if parts[1] == key && !replace {
+		s3Fail(c, 400, "InvalidRequest", "The copy request is illegal without changing the metadata.")
+		return
+	}
+	if !s.allowed(c, PermissionRead, parts[1]) || !s.allowed(c, PermissionWrite, key) {
+		return
+	}
+	prev, err := store.LookupKey("", key)
+	if err != nil && err != objstore.ErrNotFound {
+		s3Fail(c, 500, "InternalError", err.Error())
+		return
+	}
+	r, src := s.find(c, store, parts[1])
+	if r == nil {
+		return
+	}
+	meta := &objstore.FileMeta{
+		ID:          objstore.GenerateID(),
+		Key:         key,
+		Name:        path.Base(key),
+		UserMeta:    src.UserMeta,
+		Timestamp:   time.Now().UnixNano(),
+		Size:        src.Size,
+		Consistency: src.Consistency,
+		Replicas:    src.Replicas,
+	}
+	if replace {
+		meta.UserMeta = s3UserMeta(c.Request.Header)
+	}
+	s.store(c, store, r, meta, prev)
+	if !c.IsAborted() {
+		c.XML(200, &copyObjectResult{
+			LastModified: s3Time(meta).Format(s3TimeFormat),
+			ETag:         etag(meta),
+		})
+	}
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name     `xml:"ListBucketResult"`
+	Xmlns                 string       `xml:"xmlns,attr"`
+	Name                  string       `xml:"Name"`
+	Prefix                string       `xml:"Prefix"`
+	Delimiter             string       `xml:"Delimiter,omitempty"`
+	StartAfter            string       `xml:"StartAfter,omitempty"`
+	ContinuationToken     string       `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string       `xml:"NextContinuationToken,omitempty"`
+	EncodingType          string       `xml:"EncodingType,omitempty"`
+	KeyCount              int          `xml:"KeyCount"`
+	MaxKeys               int          `xml:"MaxKeys"`
+	IsTruncated           bool         `xml:"IsTruncated"`
+	Contents              []s3Object   `xml:"Contents"`
+	CommonPrefixes        []s3Prefixes `xml:"CommonPrefixes"`
+}
+
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3Prefixes struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listObjects implements ListObjectsV2, the continuation token is the encoded key to continue after.
+// Keys sharing a common prefix up to the delimiter are rolled up and count as a single key.
+func (s *S3Server) listObjects(c *gin.Context, store objstore.Store) {
+	prefix := c.Query("prefix")
+	delimiter := c.Query("delimiter")
+	if !s.allowed(c, PermissionRead, prefix) {
+		return
+	}
+	maxKeys := s3MaxKeys
+	if v := c.Query("max-keys"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			s3Fail(c, 400, "InvalidArgument", "Invalid max-keys.")
+			return
+		} else if n < maxKeys {
+			maxKeys = n
+		}
+	}
+	after := c.Query("start-after")
+	token := c.Query("continuation-token")
+	if len(token) > 0 {
+		data, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			s3Fail(c, 400, "InvalidArgument", "The continuation token provided is incorrect.")
+			return
+		}
+		after = string(data)
+	}
+	escape := func(s string) string { return s }
+	if c.Query("encoding-type") == "url" {
+		escape = url.QueryEscape
+	}
+	result := &listBucketResult{
+		Xmlns:             s3Namespace,
+		Name:              s.bucket,
+		Prefix:            escape(prefix),
+		Delimiter:         escape(delimiter),
+		StartAfter:        escape(c.Query("start-after")),
+		ContinuationToken: token,
+		EncodingType:      c.Query("encoding-type"),
+		MaxKeys:           maxKeys,
+	}
+	var done bool
+	for !done && result.KeyCount < maxKeys {
+		limit := maxKeys - result.KeyCount
+		list, err := store.ListKeys("", prefix, after, limit)
+		if err != nil {
+			s3Fail(c, 500, "InternalError", err.Error())
+			return
+		}
+		done = len(list) < limit
+		for _, meta := range list {
+			if i := strings.Index(meta.Key[len(prefix):], delimiter); len(delimiter) > 0 && i >= 0 {
+				common := meta.Key[:len(prefix)+i+len(delimiter)]
+				result.CommonPrefixes = append(result.CommonPrefixes, s3Prefixes{
+					Prefix: escape(common),
+				})
+				result.KeyCount++
+				// keys are UTF-8 strings, so none of them contains 0xff
+				after = common + "\xff"
+				done = false
+				break
+			}
+			result.Contents = append(result.Contents, s3Object{
+				Key:          escape(meta.Key),
+				LastModified: s3Time((*objstore.FileMeta)(meta)).Format(s3TimeFormat),
+				ETag:         etag((*objstore.FileMeta)(meta)),
+				Size:         meta.Size,
+				StorageClass: "STANDARD",
+			})
+			result.KeyCount++
+			after = meta.Key
+		}
+	}
+	if !done {
+		list, err := store.ListKeys("", prefix, after, 1)
+		if err != nil {
+			s3Fail(c, 500, "InternalError", err.Error())
+			return
+		}
+		if len(list) > 0 {
+			result.IsTruncated = true
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(after))
+		}
+	}
+	c.XML(200, result)
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Owner   s3Owner    `xml:"Owner"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+type s3Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type s3Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+func (s *S3Server) listBuckets(c *gin.Context) {
+	if !s.allowed(c, PermissionRead, "") {
+		return
+	}
+	c.XML(200, &listAllMyBucketsResult{
+		Xmlns: s3Namespace,
+		Owner: s3Owner{
+			ID:          "objstore",
+			DisplayName: "objstore",
+		},
+		Buckets: []s3Bucket{{
+			Name:         s.bucket,
+			CreationDate: time.Unix(0, 0).UTC().Format(s3TimeFormat),
+		}},
+	})
+}
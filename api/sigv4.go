@@ -0,0 +1,408 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm   = "AWS4-HMAC-SHA256"
+	sigV4Terminator  = "aws4_request"
+	amzDateFormat    = "20060102T150405Z"
+	amzContentSHA256 = "X-Amz-Content-Sha256"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	streamingPayload = "STREAMING-"
+	// signedStreaming is the payload of aws-chunked bodies having a chain of chunk signatures
+	// seeded by the signature of the request.
+	signedStreaming   = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	unsignedStreaming = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	chunkAlgorithm    = "AWS4-HMAC-SHA256-PAYLOAD"
+)
+
+var (
+	ErrSkewed    = errors.New("request time is too skewed")
+	ErrBadDigest = errors.New("payload digest mismatch")
+	// ErrChunkSignature is returned by readers of streaming payloads having a chunk signed wrong.
+	ErrChunkSignature = errors.New("chunk signature mismatch")
+)
+
+// sigV4 is the AWS Signature Version 4 of a request, either from the Authorization header
+// or from query of a presigned URL.
+type sigV4 struct {
+	keyID         string
+	scope         string
+	date          time.Time
+	expires       time.Duration
+	signedHeaders []string
+	signature     []byte
+	presigned     bool
+	// key is the signing key derived from the secret, set once the signature is verified.
+	key []byte
+}
+
+// verifySigV4 authenticates S3 requests signed by AWS SDKs and CLI with secrets of API keys,
+// the access key ID is the ID of an API key. The payload is verified separately while it's read,
+// the returned signature seeds the verification of chunk signatures.
+func verifySigV4(keys *KeyStore, r *http.Request) (*Principal, *sigV4, error) {
+	sig, err := parseSigV4(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	principal, secret, ok := keys.secretOf(sig.keyID)
+	if !ok {
+		return nil, nil, ErrInvalidCredentials
+	}
+	now := time.Now()
+	if skew := now.Sub(sig.date); skew < -keys.maxSkew || (!sig.presigned && skew > keys.maxSkew) {
+		return nil, nil, ErrSkewed
+	} else if sig.presigned && now.After(sig.date.Add(sig.expires)) {
+		return nil, nil, ErrExpired
+	}
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		sig.date.Format(amzDateFormat),
+		sig.scope,
+		hexSHA256([]byte(canonicalRequest(r, sig))),
+	}, "\n")
+	key := []byte("AWS4" + string(secret))
+	for _, part := range strings.Split(sig.scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	if !hmac.Equal(sig.signature, hmacSHA256(key, stringToSign)) {
+		return nil, nil, ErrInvalidCredentials
+	}
+	sig.key = key
+	return principal, sig, nil
+}
+
+func parseSigV4(r *http.Request) (*sigV4, error) {
+	var credential, signedHeaders, signature, date string
+	sig := new(sigV4)
+	query := r.URL.Query()
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, sigV4Algorithm+" ") {
+		for _, part := range strings.Split(strings.TrimPrefix(auth, sigV4Algorithm+" "), ",") {
+			part = strings.TrimSpace(part)
+			switch {
+			case strings.HasPrefix(part, "Credential="):
+				credential = strings.TrimPrefix(part, "Credential=")
+			case strings.HasPrefix(part, "SignedHeaders="):
+				signedHeaders = strings.TrimPrefix(part, "SignedHeaders=")
+			case strings.HasPrefix(part, "Signature="):
+				signature = strings.TrimPrefix(part, "Signature=")
+			}
+		}
+		date = r.Header.Get("X-Amz-Date")
+		if len(date) == 0 {
+			t, err := http.ParseTime(r.Header.Get("Date"))
+			if err != nil {
+				return nil, errors.New("no request date")
+			}
+			date = t.UTC().Format(amzDateFormat)
+		}
+	} else if query.Get("X-Amz-Algorithm") == sigV4Algorithm {
+		credential = query.Get("X-Amz-Credential")
+		signedHeaders = query.Get("X-Amz-SignedHeaders")
+		signature = query.Get("X-Amz-Signature")
+		date = query.Get("X-Amz-Date")
+		expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+		if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignExpiry {
+			return nil, errors.New("invalid X-Amz-Expires")
+		}
+		sig.expires = time.Duration(expires) * time.Second
+		sig.presigned = true
+	} else {
+		return nil, ErrNoCredentials
+	}
+	parts := strings.SplitN(credential, "/", 2)
+	if len(parts) != 2 || strings.Count(parts[1], "/") != 3 ||
+		!strings.HasSuffix(parts[1], "/s3/"+sigV4Terminator) {
+		return nil, errors.New("malformed credential")
+	}
+	sig.keyID, sig.scope = parts[0], parts[1]
+	t, err := time.Parse(amzDateFormat, date)
+	if err != nil {
+		return nil, errors.New("invalid request date")
+	} else if !strings.HasPrefix(sig.scope, t.Format("20060102")+"/") {
+		return nil, errors.New("credential date doesn't match the request date")
+	}
+	sig.date = t
+	if sig.signature, err = hex.DecodeString(signature); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	sig.signedHeaders = strings.Split(signedHeaders, ";")
+	var hasHost bool
+	for _, name := range sig.signedHeaders {
+		hasHost = hasHost || name == "host"
+	}
+	if !hasHost {
+		return nil, errors.New("host header is not signed")
+	}
+	return sig, nil
+}
+
+func canonicalRequest(r *http.Request, sig *sigV4) string {
+	headers := make([]string, 0, len(sig.signedHeaders))
+	for _, name := range sig.signedHeaders {
+		values := r.Header[http.CanonicalHeaderKey(name)]
+		if name == "host" {
+			values = []string{r.Host}
+		}
+		trimmed := make([]string, 0, len(values))
+		for _, v := range values {
+			trimmed = append(trimmed, strings.Join(strings.Fields(v), " "))
+		}
+		headers = append(headers, name+":"+strings.Join(trimmed, ","))
+	}
+	payloadHash := unsignedPayload
+	if !sig.presigned {
+		if v := r.Header.Get(amzContentSHA256); len(v) > 0 {
+			payloadHash = v
+		} else {
+			payloadHash = hexSHA256(nil)
+		}
+	}
+	return strings.Join([]string{
+		r.Method,
+		awsEscape(r.URL.Path, true),
+		canonicalQuery(r.URL.Query(), sig.presigned),
+		strings.Join(headers, "\n") + "\n",
+		strings.Join(sig.signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+func canonicalQuery(query url.Values, presigned bool) string {
+	type pair struct {
+		k, v string
+	}
+	var pairs []pair
+	for k, values := range query {
+		if presigned && k == "X-Amz-Signature" {
+			continue
+		}
+		for _, v := range values {
+			pairs = append(pairs, pair{awsEscape(k, false), awsEscape(v, false)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].k == pairs[j].k {
+			return pairs[i].v < pairs[j].v
+		}
+		return pairs[i].k < pairs[j].k
+	})
+	parts := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		parts = append(parts, p.k+"="+p.v)
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes all bytes except unreserved characters, as AWS does.
+func awsEscape(s string, keepSlash bool) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', keepSlash && c == '/':
+			buf.WriteByte(c)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// s3Payload prepares the body of an S3 request for reading: decodes aws-chunked bodies and verifies
+// the SHA-256 and MD5 digests declared in headers, the reader fails with ErrBadDigest at the end.
+// Chunk signatures are verified against sig, which is nil if requests are not authenticated.
+// Returns the size of the decoded payload, or -1 if unknown.
+func s3Payload(r *http.Request, sig *sigV4) (io.Reader, int64, error) {
+	body := io.Reader(r.Body)
+	size := r.ContentLength
+	contentSHA256 := r.Header.Get(amzContentSHA256)
+	if strings.HasPrefix(contentSHA256, streamingPayload) {
+		decoded, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil {
+			return nil, 0, errors.New("invalid X-Amz-Decoded-Content-Length")
+		}
+		chunked := &awsChunkedReader{r: bufio.NewReader(body)}
+		switch contentSHA256 {
+		case signedStreaming:
+			if sig != nil {
+				if sig.presigned {
+					return nil, 0, errors.New("streaming payload can't be presigned")
+				}
+				chunked.sig = sig
+				chunked.prev = hex.EncodeToString(sig.signature)
+				chunked.hash = sha256.New()
+			}
+		case unsignedStreaming:
+		default:
+			return nil, 0, fmt.Errorf("unsupported %s: %s", amzContentSHA256, contentSHA256)
+		}
+		body = chunked
+		size = decoded
+	}
+	v := &digestReader{r: body}
+	if len(contentSHA256) == sha256.Size*2 {
+		sum, err := hex.DecodeString(contentSHA256)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid %s", amzContentSHA256)
+		}
+		v.hashes = append(v.hashes, sha256.New())
+		v.sums = append(v.sums, sum)
+	}
+	if contentMD5 := r.Header.Get("Content-MD5"); len(contentMD5) > 0 {
+		sum, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil || len(sum) != md5.Size {
+			return nil, 0, errors.New("invalid Content-MD5")
+		}
+		v.hashes = append(v.hashes, md5.New())
+		v.sums = append(v.sums, sum)
+	}
+	if len(v.hashes) == 0 {
+		return body, size, nil
+	}
+	return v, size, nil
+}
+
+type digestReader struct {
+	r      io.Reader
+	hashes []hash.Hash
+	sums   [][]byte
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	for _, h := range d.hashes {
+		h.Write(p[:n])
+	}
+	if err == io.EOF {
+		for i, h := range d.hashes {
+			if !hmac.Equal(h.Sum(nil), d.sums[i]) {
+				return n, ErrBadDigest
+			}
+		}
+	}
+	return n, err
+}
+
+// awsChunkedReader decodes bodies streamed by AWS SDKs in chunks, each chunk is prefixed by
+// its hex size and signature. Trailing headers after the last chunk are ignored.
+// If sig is set, the signature of each chunk is verified once the chunk is read, signatures are
+// chained starting from the signature of the request, so chunks can't be altered or reordered.
+type awsChunkedReader struct {
+	r    *bufio.Reader
+	left int64
+	done bool
+
+	sig *sigV4
+	// prev is the hex signature of the previous chunk, signature is the one of the current chunk.
+	prev      string
+	signature string
+	hash      hash.Hash
+}
+
+var errBadChunk = errors.New("malformed aws-chunked body")
+
+func (a *awsChunkedReader) Read(p []byte) (int, error) {
+	for a.left == 0 {
+		if a.done {
+			return 0, io.EOF
+		} else if err := a.next(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > a.left {
+		p = p[:a.left]
+	}
+	n, err := a.r.Read(p)
+	a.left -= int64(n)
+	if a.hash != nil {
+		a.hash.Write(p[:n])
+	}
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	} else if err == nil && a.left == 0 {
+		crlf := make([]byte, 2)
+		if _, err := io.ReadFull(a.r, crlf); err != nil || string(crlf) != "\r\n" {
+			return n, errBadChunk
+		}
+		if err := a.verify(); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+func (a *awsChunkedReader) next() error {
+	line, err := a.r.ReadString('\n')
+	if err != nil {
+		return errBadChunk
+	}
+	line = strings.TrimRight(line, "\r\n")
+	a.signature = ""
+	if i := strings.IndexByte(line, ';'); i >= 0 {
+		a.signature = strings.TrimPrefix(line[i+1:], "chunk-signature=")
+		line = line[:i]
+	}
+	size, err := strconv.ParseInt(line, 16, 64)
+	if err != nil || size < 0 {
+		return errBadChunk
+	} else if size == 0 {
+		// the final chunk is signed as well, so the body can't be truncated
+		a.done = true
+		return a.verify()
+	}
+	a.left = size
+	return nil
+}
+
+// verify checks the signature of the chunk just read and resets the hash for the next one.
+func (a *awsChunkedReader) verify() error {
+	if a.sig == nil {
+		return nil
+	}
+	stringToSign := strings.Join([]string{
+		chunkAlgorithm,
+		a.sig.date.Format(amzDateFormat),
+		a.sig.scope,
+		a.prev,
+		hexSHA256(nil),
+		hex.EncodeToString(a.hash.Sum(nil)),
+	}, "\n")
+	signature, err := hex.DecodeString(a.signature)
+	if err != nil || !hmac.Equal(signature, hmacSHA256(a.sig.key, stringToSign)) {
+		return ErrChunkSignature
+	}
+	a.prev = a.signature
+	a.hash.Reset()
+	return nil
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// SetTLSConfig enables mutual TLS for the virtual network transport, the config must have
+// the node certificate and the cluster CA set for both servers and clients.
+func (p *PrivateServer) SetTLSConfig(config *tls.Config) {
+	p.tlsConfig = config
+}
+
+// SetSecret enables authentication of peers by a pre-shared cluster secret. Unless TLS
+// is enabled as well, the transport is authenticated but not encrypted.
+func (p *PrivateServer) SetSecret(secret string) {
+	p.secret = []byte(secret)
+}
+
+func (p *PrivateServer) isSecure() bool {
+	return p.tlsConfig != nil || len(p.secret) > 0
+}
+
+const handshakeTimeout = 10 * time.Second
+
+// listen accepts TCP connections of peers for the virtual network transport,
+// peers are attached to the router only once authenticated.
+func (p *PrivateServer) listen(addr string) error {
+	listener, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return err
+	}
+	if p.tlsConfig != nil {
+		listener = tls.NewListener(listener, p.tlsConfig)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Println("[WARN] private listener stopped:", err)
+				return
+			}
+			go func() {
+				if err := p.handshake(conn, false); err != nil {
+					log.Println("[WARN] rejected peer from", conn.RemoteAddr(), err)
+					conn.Close()
+					return
+				}
+				log.Println("[INFO] peer joined from", conn.RemoteAddr())
+				p.router.Attach(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// join connects to a peer via TCP and attaches the connection once authenticated.
+func (p *PrivateServer) join(addr string) error {
+	if !p.isSecure() {
+		return p.router.Join("tcp4", addr)
+	}
+	conn, err := net.DialTimeout("tcp4", addr, handshakeTimeout)
+	if err != nil {
+		return err
+	}
+	if p.tlsConfig != nil {
+		config := p.tlsConfig.Clone()
+		if len(config.ServerName) == 0 {
+			// nodes are identified by certificates of the cluster CA, not by their addresses
+			config.InsecureSkipVerify = true
+			config.VerifyPeerCertificate = verifyChain(config.RootCAs)
+		}
+		conn = tls.Client(conn, config)
+	}
+	if err := p.handshake(conn, true); err != nil {
+		log.Println("[WARN] failed to join", addr, err)
+		conn.Close()
+		return err
+	}
+	if p.debug {
+		log.Println("[INFO] joined peer", addr)
+	}
+	p.router.Attach(conn)
+	return nil
+}
+
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no peer certificate")
+		}
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs = append(certs, cert)
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		return err
+	}
+}
+
+var (
+	errBadHandshake = errors.New("handshake failed")
+	handshakeMagic  = []byte("objstore-join-v1")
+)
+
+// handshake authenticates the peer, the TLS handshake verifies certificates of both sides,
+// then the sides prove knowledge of the cluster secret with HMAC over challenges of each other.
+func (p *PrivateServer) handshake(conn net.Conn, isClient bool) error {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+	}
+	if len(p.secret) == 0 {
+		return nil
+	}
+	challenge := make([]byte, len(handshakeMagic)+32)
+	copy(challenge, handshakeMagic)
+	if _, err := rand.Read(challenge[len(handshakeMagic):]); err != nil {
+		return err
+	}
+	peerChallenge := make([]byte, len(challenge))
+	peerProof := make([]byte, sha256.Size)
+	// the role is mixed into proofs, so a proof can't be reflected back
+	if isClient {
+		if _, err := conn.Write(challenge); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, peerChallenge); err != nil {
+			return err
+		} else if _, err := io.ReadFull(conn, peerProof); err != nil {
+			return err
+		} else if !hmac.Equal(peerProof, p.proof(challenge, false)) {
+			return errBadHandshake
+		}
+		_, err := conn.Write(p.proof(peerChallenge, true))
+		return err
+	}
+	if _, err := io.ReadFull(conn, peerChallenge); err != nil {
+		return err
+	} else if !bytes.HasPrefix(peerChallenge, handshakeMagic) {
+		return errBadHandshake
+	}
+	if _, err := conn.Write(append(challenge, p.proof(peerChallenge, false)...)); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(conn, peerProof); err != nil {
+		return err
+	} else if !hmac.Equal(peerProof, p.proof(challenge, true)) {
+		return errBadHandshake
+	}
+	return nil
+}
+
+func (p *PrivateServer) proof(challenge []byte, isClient bool) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	if isClient {
+		mac.Write([]byte("client"))
+	} else {
+		mac.Write([]byte("server"))
+	}
+	mac.Write(challenge)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"sphere.software/objstore"
+	"sphere.software/objstore/journal"
+)
+
+// InitiateUploadHandler starts a resumable upload, meta data of the object is taken from the same
+// headers as for puts. A new ID is generated unless specified in X-Meta-ID, keys bound to prefixes
+// must cover the ID either way.
+func (p *PublicServer) InitiateUploadHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		meta := &objstore.FileMeta{
+			ID:        putID(c),
+			Name:      c.Request.Header.Get("X-Meta-Name"),
+			UserMeta:  userMeta(c.Request.Header.Get("X-Meta-UserMeta")),
+			Timestamp: time.Now().UnixNano(),
+		}
+		if len(meta.ID) == 0 {
+			meta.ID = objstore.GenerateID()
+		}
+		if !p.allowed(c, PermissionWrite, meta.ID) || !putOptions(c, meta) {
+			return
+		}
+		upload, err := store.InitiateUpload(meta)
+		if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		c.JSON(200, upload)
+	}
+}
+
+// upload finds the upload session of the request and checks that the requester may put the object,
+// responds with 404 if there is no such upload in the namespace of the request.
+func (p *PublicServer) upload(c *gin.Context, store objstore.Store) (*objstore.Upload, bool) {
+	upload, err := store.GetUpload(c.Param("upload"))
+	if err == objstore.ErrNotFound {
+		c.String(404, "error: upload not found")
+		return nil, false
+	} else if err != nil {
+		c.String(500, "error: %v", err)
+		return nil, false
+	}
+	ns, id := journal.SplitID(upload.Meta.ID)
+	if ns != nsName(c) {
+		c.String(404, "error: upload not found")
+		return nil, false
+	} else if !p.allowed(c, PermissionWrite, id) {
+		return nil, false
+	}
+	return upload, true
+}
+
+// GetUploadHandler reports parts of the upload received so far.
+func (p *PublicServer) GetUploadHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if upload, ok := p.upload(c, store); ok {
+			c.JSON(200, upload)
+		}
+	}
+}
+
+// UploadPartHandler stores the body as the part numbered by the path, parts uploaded
+// partially are discarded, so they can be uploaded again.
+func (p *PublicServer) UploadPartHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := p.upload(c, store); !ok {
+			return
+		}
+		n, err := strconv.Atoi(c.Param("part"))
+		if err != nil {
+			c.String(400, "error: invalid part number: %s", c.Param("part"))
+			return
+		}
+		if _, err := store.UploadPart(c.Param("upload"), n, c.Request.Body); err == objstore.ErrNotFound {
+			c.String(404, "error: upload not found")
+			return
+		} else if err == objstore.ErrUploadCompleting {
+			c.String(409, "error: %v", err)
+			return
+		} else if err != nil {
+			c.String(400, "error: %v", err)
+			return
+		}
+		c.Status(200)
+	}
+}
+
+// CompleteUploadHandler assembles parts into the object, the upload session is discarded.
+// Completions are serialized with conditional writes of the object, a completion already
+// in progress fails the request with 409.
+func (p *PublicServer) CompleteUploadHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		upload, ok := p.upload(c, store)
+		if !ok {
+			return
+		}
+		defer lockObjects(upload.Meta.ID)()
+		meta, err := store.CompleteUpload(c.Param("upload"))
+		switch err {
+		case nil:
+		case objstore.ErrNotFound:
+			c.String(404, "error: upload not found")
+			return
+		case objstore.ErrUploadCompleting:
+			c.String(409, "error: %v", err)
+			return
+		case objstore.ErrIncompleteUpload:
+			c.String(400, "error: %v", err)
+			return
+		case objstore.ErrQuotaExceeded:
+			c.String(507, "error: %v", err)
+			return
+		default:
+			c.String(500, "error: %v", err)
+			return
+		}
+		c.Header("X-Meta-ID", meta.ID)
+		c.JSON(200, meta)
+	}
+}
+
+// AbortUploadHandler discards the upload session along with parts received so far.
+func (p *PublicServer) AbortUploadHandler(store objstore.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := p.upload(c, store); !ok {
+			return
+		}
+		if err := store.AbortUpload(c.Param("upload")); err == objstore.ErrNotFound {
+			c.String(404, "error: upload not found")
+			return
+		} else if err == objstore.ErrUploadCompleting {
+			c.String(409, "error: %v", err)
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		c.Status(200)
+	}
+}
@@ -0,0 +1,156 @@
+package objstore
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"sphere.software/objstore/cluster"
+	"sphere.software/objstore/journal"
+)
+
+// BatchOp is an operation of a batch, either a put of a small object with the body in memory,
+// or a delete of the object by Meta.ID.
+type BatchOp struct {
+	Delete bool
+	Meta   *FileMeta
+	Body   []byte
+}
+
+// BatchResult is the outcome of an operation of a batch, Err is nil if it succeeded.
+type BatchResult struct {
+	Meta *FileMeta
+	Err  error
+}
+
+// Batch applies puts and deletes at once: bodies are stored locally, then journals are updated
+// in one transaction and all the changes are announced as one event. Objects put with ConsistencyS3
+// or ConsistencyFull are uploaded to the remote storage afterwards. Results are in the order of ops.
+func (o *objStore) Batch(ops []*BatchOp) []*BatchResult {
+	results := make([]*BatchResult, len(ops))
+	var applied []int
+	for i, op := range ops {
+		results[i] = &BatchResult{
+			Meta: op.Meta,
+		}
+		if op.Delete {
+			applied = append(applied, i)
+			continue
+		}
+		op.Meta.Size = int64(len(op.Body))
+		if _, err := (ConsistencyLevel)(op.Meta.Consistency).Check(); err != nil {
+			results[i].Err = err
+			continue
+		} else if err := o.checkQuota(op.Meta); err != nil {
+			results[i].Err = err
+			continue
+		}
+		op.Meta.Clock = o.clock.Now()
+		if _, err := o.localStorage.Write(op.Meta.ID, bytes.NewReader(op.Body)); err != nil {
+			results[i].Err = fmt.Errorf("objstore: local store failed: %v", err)
+			continue
+		}
+		applied = append(applied, i)
+	}
+	journalID := journal.ID(o.nodeID)
+	deleted := make(map[int]*journal.FileMeta)
+	var journalOk bool
+	err := o.journals.ForEachUpdate(func(j journal.Journal, _ *journal.JournalMeta) error {
+		if journalID == j.ID() {
+			journalOk = true
+		}
+		for _, i := range applied {
+			id := ops[i].Meta.ID
+			if ops[i].Delete {
+				if _, ok := deleted[i]; ok {
+					continue
+				}
+				if m := j.Get(id); m != nil {
+					m.IsDeleted = true
+					m.Timestamp = time.Now().UnixNano()
+					m.Clock = o.clock.Now()
+					if err := j.Set(id, m); err != nil {
+						return err
+					}
+					deleted[i] = m
+				}
+				continue
+			}
+			if journalID == j.ID() {
+				if err := j.Set(id, (*journal.FileMeta)(ops[i].Meta)); err != nil {
+					return err
+				}
+			} else if err := j.Delete(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && !journalOk {
+		err = fmt.Errorf("objstore: journal not found: %v", journalID)
+	}
+	if err != nil {
+		err = fmt.Errorf("objstore: journal update failed: %v", err)
+		for _, i := range applied {
+			results[i].Err = err
+		}
+		return results
+	}
+	var batch journal.FileMetaList
+	for _, i := range applied {
+		if !ops[i].Delete {
+			batch = append(batch, (*journal.FileMeta)(ops[i].Meta))
+		} else if m, ok := deleted[i]; ok {
+			results[i].Meta = (*FileMeta)(m)
+			batch = append(batch, m)
+		} else {
+			results[i].Err = ErrNotFound
+		}
+	}
+	if len(batch) > 0 {
+		o.EmitEventAnnounce(&EventAnnounce{
+			Type:  cluster.EventBatch,
+			Batch: batch,
+		})
+	}
+	for _, i := range applied {
+		if results[i].Err != nil {
+			continue
+		} else if ops[i].Delete {
+			if err := o.localStorage.Delete(ops[i].Meta.ID); err != nil {
+				log.Println("[WARN] failed to delete local file:", err)
+			}
+			continue
+		}
+		meta := ops[i].Meta
+		if meta.Consistency == journal.ConsistencyLocal {
+			continue
+		}
+		remote, key := o.remote(meta)
+		if _, err := remote.PutObject(key, bytes.NewReader(ops[i].Body), (*journal.FileMeta)(meta).Map()); err != nil {
+			results[i].Err = fmt.Errorf("objstore: remote store failed: %v", err)
+		}
+	}
+	return results
+}
+
+// handleBatch applies entries of a batch event one by one, as if they were announced separately.
+func (o *objStore) handleBatch(ev *EventAnnounce, timeout time.Duration) error {
+	var failed error
+	for _, meta := range ev.Batch {
+		typ := cluster.EventFileAdded
+		if meta.IsDeleted {
+			typ = cluster.EventFileDeleted
+		}
+		if err := o.handleEvent(&EventAnnounce{
+			Type:     typ,
+			FileMeta: meta,
+			Clock:    ev.Clock,
+		}, timeout); err != nil {
+			log.Println("[WARN] failed to handle batched event:", err)
+			failed = err
+		}
+	}
+	return failed
+}
@@ -0,0 +1,127 @@
+package objstore
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"sphere.software/objstore/cluster"
+	"sphere.software/objstore/journal"
+)
+
+// SyncChanges is a page of journal changes since the watermark of the requester.
+type SyncChanges cluster.SyncChanges
+
+const (
+	syncChangesBatch    = 1000
+	syncChangesMaxBatch = 10000
+)
+
+// syncChanges pulls the changes of the peer's journal since the last sync with it, the watermark
+// is advanced after each page is applied. Returns ErrNotFound if the peer supports only full sync.
+// Upon full resync all the peer's entries are pulled, and their IDs are returned.
+func (o *objStore) syncChanges(ctx context.Context, peer string,
+	resync bool, timeout time.Duration) (seen []string, err error) {
+
+	watermarks := make(map[string]uint64)
+	if !resync {
+		if watermarks, err = o.journals.Watermarks(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		changes, err := o.cluster.SyncChanges(ctx, peer, &cluster.SyncChangesRequest{
+			Watermarks: watermarks,
+			Limit:      syncChangesBatch,
+			Resync:     resync,
+		})
+		if err == cluster.ErrNotFound {
+			return nil, ErrNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		if resync {
+			for _, meta := range changes.Changes {
+				seen = append(seen, meta.ID)
+			}
+		}
+		if o.debug {
+			log.Printf("[INFO] sync with %s: %d changes since %d", peer,
+				len(changes.Changes), watermarks[changes.Epoch])
+		}
+		if err := o.applyChanges(changes.Changes, timeout); err != nil {
+			return nil, err
+		}
+		if err := o.journals.SetWatermark(changes.Epoch, changes.Next); err != nil {
+			return nil, err
+		}
+		if !changes.More {
+			return seen, nil
+		}
+		watermarks = map[string]uint64{
+			changes.Epoch: changes.Next,
+		}
+	}
+}
+
+// applyChanges compares the changed entries of a peer with the local ones. Deletions are handled
+// right away, added objects are recorded as symlinks and queued to be replicated.
+func (o *objStore) applyChanges(list journal.FileMetaList, timeout time.Duration) error {
+	// peers are synced concurrently
+	o.applyMux.Lock()
+	defer o.applyMux.Unlock()
+
+	for _, meta := range list {
+		local, err := o.HeadObject(meta.ID)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		event := remoteEvent(meta, (*journal.FileMeta)(local))
+		if event == nil {
+			continue
+		}
+		if event.Type == cluster.EventFileAdded && !meta.IsDeleted {
+			// may replicate, i.e. handle the missing announce
+			meta.IsSymlink = true // temporarily, will be overridden once replicated
+			if err := o.journals.ForEachUpdate(func(j journal.Journal, _ *journal.JournalMeta) error {
+				if j.ID() == journal.ID(o.nodeID) {
+					return j.Set(meta.ID, meta)
+				}
+				return j.Delete(meta.ID)
+			}); err != nil {
+				return err
+			}
+			// queued after the journal transaction is committed, the queue is in the same DB
+			o.ReceiveEventAnnounce(event)
+			continue
+		}
+		if err := o.handleEvent(event, timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *objStore) Changes(watermarks map[string]uint64, limit int, resync bool) (*SyncChanges, error) {
+	if o.checkStale() && !resync {
+		return nil, ErrResyncPending
+	}
+	if limit <= 0 || limit > syncChangesMaxBatch {
+		limit = syncChangesBatch
+	}
+	epoch, err := o.journals.Epoch()
+	if err != nil {
+		return nil, err
+	}
+	// an unknown epoch means the requester has never synced with this DB
+	list, next, more, err := o.journals.Changes(watermarks[epoch], limit)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncChanges{
+		Epoch:   epoch,
+		Changes: list,
+		Next:    next,
+		More:    more,
+	}, nil
+}
@@ -105,3 +105,17 @@ func (p *PrivateClient) POST(ctx context.Context, nodeID, path string, body io.R
 	}
 	return p.cli.Do(req)
 }
+
+// Do sends a request with the specified headers to the node.
+func (p *PrivateClient) Do(ctx context.Context, method, nodeID, path string,
+	header http.Header, body io.Reader) (*http.Response, error) {
+
+	req, err := http.NewRequest(method, nodeURI(nodeID)+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return p.cli.Do(req.WithContext(ctx))
+}
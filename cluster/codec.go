@@ -0,0 +1,132 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/tinylib/msgp/msgp"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeMsgpack  = "application/msgpack"
+	ContentEncodingZstd = "zstd"
+)
+
+// compressThreshold is the minimal size of a body worth compressing.
+const compressThreshold = 1024
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(1<<30))
+)
+
+// Codec is the encoding of private API bodies. Nodes exchange msgpack when both sides support it,
+// JSON is kept for older nodes and for external tools using the debug proxy.
+type Codec struct {
+	Msgpack bool
+	Zstd    bool
+}
+
+// NativeCodec is the best encoding supported by this node.
+var NativeCodec = Codec{
+	Msgpack: true,
+	Zstd:    true,
+}
+
+// AdvertiseCodec sets response headers letting the requester know which request bodies
+// are accepted, the Accept-Encoding response header is defined by RFC 7694.
+func AdvertiseCodec(h http.Header) {
+	h.Set("Accept-Post", ContentTypeMsgpack+", "+ContentTypeJSON)
+	h.Set("Accept-Encoding", ContentEncodingZstd)
+}
+
+// AdvertisedCodec gets the encoding of request bodies accepted by the node from its response headers.
+func AdvertisedCodec(h http.Header) Codec {
+	return Codec{
+		Msgpack: headerHas(h, "Accept-Post", ContentTypeMsgpack),
+		Zstd:    headerHas(h, "Accept-Encoding", ContentEncodingZstd),
+	}
+}
+
+// AcceptedCodec gets the encoding of response bodies accepted by the requester from its request headers.
+func AcceptedCodec(h http.Header) Codec {
+	return Codec{
+		Msgpack: headerHas(h, "Accept", ContentTypeMsgpack),
+		Zstd:    headerHas(h, "Accept-Encoding", ContentEncodingZstd),
+	}
+}
+
+// SetAccept sets request headers asking for response bodies encoded with the codec.
+func (c Codec) SetAccept(h http.Header) {
+	if c.Msgpack {
+		h.Set("Accept", ContentTypeMsgpack+", "+ContentTypeJSON)
+	} else {
+		h.Set("Accept", ContentTypeJSON)
+	}
+	if c.Zstd {
+		h.Set("Accept-Encoding", ContentEncodingZstd)
+	}
+}
+
+// Encode marshals v using the codec and sets Content-Type and Content-Encoding headers accordingly.
+// Values having no msgpack codecs generated are encoded as JSON.
+func (c Codec) Encode(h http.Header, v interface{}) ([]byte, error) {
+	var body []byte
+	var err error
+	if m, ok := v.(msgp.Marshaler); ok && c.Msgpack {
+		h.Set("Content-Type", ContentTypeMsgpack)
+		body, err = m.MarshalMsg(nil)
+	} else {
+		h.Set("Content-Type", ContentTypeJSON)
+		body, err = json.Marshal(v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.Zstd && len(body) >= compressThreshold {
+		h.Set("Content-Encoding", ContentEncodingZstd)
+		body = zstdEncoder.EncodeAll(body, nil)
+	}
+	return body, nil
+}
+
+// Decode unmarshals the body into v according to Content-Type and Content-Encoding headers.
+func Decode(h http.Header, body []byte, v interface{}) error {
+	if strings.EqualFold(h.Get("Content-Encoding"), ContentEncodingZstd) {
+		var err error
+		if body, err = zstdDecoder.DecodeAll(body, nil); err != nil {
+			return err
+		}
+	}
+	if mediaType(h.Get("Content-Type")) == ContentTypeMsgpack {
+		u, ok := v.(msgp.Unmarshaler)
+		if !ok {
+			return fmt.Errorf("cluster: no msgpack codec for %T", v)
+		}
+		_, err := u.UnmarshalMsg(body)
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func headerHas(h http.Header, key, value string) bool {
+	for _, line := range h[http.CanonicalHeaderKey(key)] {
+		for _, v := range strings.Split(line, ",") {
+			if strings.EqualFold(mediaType(v), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func mediaType(v string) string {
+	if i := strings.IndexByte(v, ';'); i >= 0 {
+		v = v[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
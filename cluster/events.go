@@ -5,16 +5,24 @@ import "sphere.software/objstore/journal"
 type EventType int
 
 const (
-	EventUnknown      EventType = 0
-	EventFileAdded    EventType = 1
-	EventFileDeleted  EventType = 2
-	EventOpaqueData   EventType = 3
+	EventUnknown     EventType = 0
+	EventFileAdded   EventType = 1
+	EventFileDeleted EventType = 2
+	EventOpaqueData  EventType = 3
+	// EventBatch carries entries added or deleted together, deleted ones are marked as such.
+	EventBatch EventType = 4
+	// EventMetaUpdated carries the entry with mutable meta data changed, the body is unchanged.
+	EventMetaUpdated  EventType = 5
 	EventStopAnnounce EventType = 999
 )
 
 type EventAnnounce struct {
-	Type EventType `json:"type"`
+	Type EventType `msgp:"0" json:"type"`
 
-	FileMeta   *journal.FileMeta `json:"meta"`
-	OpaqueData []byte            `json:"data"`
+	FileMeta   *journal.FileMeta `msgp:"1" json:"meta"`
+	OpaqueData []byte            `msgp:"2" json:"data"`
+	// Clock is the HLC timestamp of the sender when the event has been emitted.
+	Clock journal.HLC `msgp:"3" json:"clock"`
+	// Batch lists entries of EventBatch events.
+	Batch journal.FileMetaList `msgp:"4" json:"batch"`
 }
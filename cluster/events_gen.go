@@ -0,0 +1,297 @@
+package cluster
+
+// NOTE: THIS FILE WAS PRODUCED BY THE
+// MSGP CODE GENERATION TOOL (github.com/tinylib/msgp)
+// DO NOT EDIT
+
+import (
+	"github.com/tinylib/msgp/msgp"
+	"sphere.software/objstore/journal"
+)
+
+// DecodeMsg implements msgp.Decodable
+func (z *EventAnnounce) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zrvk uint32
+	zrvk, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zrvk > 0 {
+		zrvk--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Type":
+			{
+				var zbad int
+				zbad, err = dc.ReadInt()
+				z.Type = EventType(zbad)
+			}
+			if err != nil {
+				return
+			}
+		case "FileMeta":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					return
+				}
+				z.FileMeta = nil
+			} else {
+				if z.FileMeta == nil {
+					z.FileMeta = new(journal.FileMeta)
+				}
+				err = z.FileMeta.DecodeMsg(dc)
+				if err != nil {
+					return
+				}
+			}
+		case "OpaqueData":
+			z.OpaqueData, err = dc.ReadBytes(z.OpaqueData)
+			if err != nil {
+				return
+			}
+		case "Clock":
+			err = z.Clock.DecodeMsg(dc)
+			if err != nil {
+				return
+			}
+		case "Batch":
+			err = z.Batch.DecodeMsg(dc)
+			if err != nil {
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *EventAnnounce) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 5
+	// write "Type"
+	err = en.Append(0x85, 0xa4, 0x54, 0x79, 0x70, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt(int(z.Type))
+	if err != nil {
+		return
+	}
+	// write "FileMeta"
+	err = en.Append(0xa8, 0x46, 0x69, 0x6c, 0x65, 0x4d, 0x65, 0x74, 0x61)
+	if err != nil {
+		return err
+	}
+	if z.FileMeta == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = z.FileMeta.EncodeMsg(en)
+		if err != nil {
+			return
+		}
+	}
+	// write "OpaqueData"
+	err = en.Append(0xaa, 0x4f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x44, 0x61, 0x74, 0x61)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBytes(z.OpaqueData)
+	if err != nil {
+		return
+	}
+	// write "Clock"
+	err = en.Append(0xa5, 0x43, 0x6c, 0x6f, 0x63, 0x6b)
+	if err != nil {
+		return err
+	}
+	err = z.Clock.EncodeMsg(en)
+	if err != nil {
+		return
+	}
+	// write "Batch"
+	err = en.Append(0xa5, 0x42, 0x61, 0x74, 0x63, 0x68)
+	if err != nil {
+		return err
+	}
+	err = z.Batch.EncodeMsg(en)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *EventAnnounce) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 5
+	// string "Type"
+	o = append(o, 0x85, 0xa4, 0x54, 0x79, 0x70, 0x65)
+	o = msgp.AppendInt(o, int(z.Type))
+	// string "FileMeta"
+	o = append(o, 0xa8, 0x46, 0x69, 0x6c, 0x65, 0x4d, 0x65, 0x74, 0x61)
+	if z.FileMeta == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o, err = z.FileMeta.MarshalMsg(o)
+		if err != nil {
+			return
+		}
+	}
+	// string "OpaqueData"
+	o = append(o, 0xaa, 0x4f, 0x70, 0x61, 0x71, 0x75, 0x65, 0x44, 0x61, 0x74, 0x61)
+	o = msgp.AppendBytes(o, z.OpaqueData)
+	// string "Clock"
+	o = append(o, 0xa5, 0x43, 0x6c, 0x6f, 0x63, 0x6b)
+	o, err = z.Clock.MarshalMsg(o)
+	if err != nil {
+		return
+	}
+	// string "Batch"
+	o = append(o, 0xa5, 0x42, 0x61, 0x74, 0x63, 0x68)
+	o, err = z.Batch.MarshalMsg(o)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *EventAnnounce) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zlkf uint32
+	zlkf, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zlkf > 0 {
+		zlkf--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Type":
+			{
+				var zfat int
+				zfat, bts, err = msgp.ReadIntBytes(bts)
+				z.Type = EventType(zfat)
+			}
+			if err != nil {
+				return
+			}
+		case "FileMeta":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.FileMeta = nil
+			} else {
+				if z.FileMeta == nil {
+					z.FileMeta = new(journal.FileMeta)
+				}
+				bts, err = z.FileMeta.UnmarshalMsg(bts)
+				if err != nil {
+					return
+				}
+			}
+		case "OpaqueData":
+			z.OpaqueData, bts, err = msgp.ReadBytesBytes(bts, z.OpaqueData)
+			if err != nil {
+				return
+			}
+		case "Clock":
+			bts, err = z.Clock.UnmarshalMsg(bts)
+			if err != nil {
+				return
+			}
+		case "Batch":
+			bts, err = z.Batch.UnmarshalMsg(bts)
+			if err != nil {
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *EventAnnounce) Msgsize() (s int) {
+	s = 1 + 5 + msgp.IntSize + 9
+	if z.FileMeta == nil {
+		s += msgp.NilSize
+	} else {
+		s += z.FileMeta.Msgsize()
+	}
+	s += 11 + msgp.BytesPrefixSize + len(z.OpaqueData) + 6 + z.Clock.Msgsize() + 6 + z.Batch.Msgsize()
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *EventType) DecodeMsg(dc *msgp.Reader) (err error) {
+	{
+		var zuty int
+		zuty, err = dc.ReadInt()
+		(*z) = EventType(zuty)
+	}
+	if err != nil {
+		return
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z EventType) EncodeMsg(en *msgp.Writer) (err error) {
+	err = en.WriteInt(int(z))
+	if err != nil {
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z EventType) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	o = msgp.AppendInt(o, int(z))
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *EventType) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	{
+		var ztcr int
+		ztcr, bts, err = msgp.ReadIntBytes(bts)
+		(*z) = EventType(ztcr)
+	}
+	if err != nil {
+		return
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z EventType) Msgsize() (s int) {
+	s = msgp.IntSize
+	return
+}
@@ -0,0 +1,423 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// HintStore keeps announcements that failed to reach their target nodes, so they
+// can be replayed once the nodes become reachable again. Hints older than TTL are
+// expired, and only a limited amount of hints is kept per node, the oldest are dropped first.
+// The store also remembers peers seen in the cluster, so hints are kept for nodes that have
+// dropped out of discovery.
+type HintStore interface {
+	// Add stores a hint for the target node.
+	Add(nodeID string, event *EventAnnounce) error
+	// AddPending stores a hint for the target node only if there are hints stored for it already,
+	// the check and the store are done at once, so the event is not sent ahead of the older ones.
+	AddPending(nodeID string, event *EventAnnounce) (bool, error)
+	// Replay calls fn for each hint stored for the target node in order, hints are deleted
+	// once fn succeeds. Replay stops on the first error and returns the count of replayed hints.
+	Replay(nodeID string, fn func(event *EventAnnounce) error) (int, error)
+	// Nodes lists IDs of nodes having hints stored.
+	Nodes() ([]string, error)
+	// Seen records the nodes as known peers.
+	Seen(nodeIDs []string) error
+	// Peers lists known peers, including the ones not seen recently.
+	Peers() []string
+	// Expire deletes all hints older than TTL and forgets peers not seen for TTL.
+	Expire() error
+	Stats() *HintStats
+}
+
+type HintStats struct {
+	Stored   int   `json:"stored"`
+	Nodes    int   `json:"nodes"`
+	Added    int64 `json:"added"`
+	Replayed int64 `json:"replayed"`
+	Expired  int64 `json:"expired"`
+	Dropped  int64 `json:"dropped"`
+}
+
+// NewHintStore creates a new hint store backed by a BoltDB bucket.
+func NewHintStore(db *bolt.DB, ttl time.Duration, maxPerNode int) (HintStore, error) {
+	peers := make(map[string]int64)
+	if err := db.Update(func(tx *bolt.Tx) error {
+		hints, err := tx.CreateBucketIfNotExists(hintsBucket)
+		if err != nil {
+			return err
+		}
+		counts, err := tx.CreateBucketIfNotExists(hintCountsBucket)
+		if err != nil {
+			return err
+		}
+		if err := hints.ForEach(func(nodeID, v []byte) error {
+			if v != nil || counts.Get(nodeID) != nil {
+				return nil
+			}
+			// hints stored before counts were kept
+			return setHintCount(tx, nodeID, hints.Bucket(nodeID).Stats().KeyN)
+		}); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucketIfNotExists(peersBucket)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(nodeID, v []byte) error {
+			peers[string(nodeID)] = int64(binary.BigEndian.Uint64(v))
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return &kvHintStore{
+		db:         db,
+		ttl:        ttl,
+		maxPerNode: maxPerNode,
+		peers:      peers,
+	}, nil
+}
+
+type kvHintStore struct {
+	db         *bolt.DB
+	ttl        time.Duration
+	maxPerNode int
+
+	// peers maps known peers to the time they have been seen last, as persisted.
+	peersMux sync.RWMutex
+	peers    map[string]int64
+
+	added    int64
+	replayed int64
+	expired  int64
+	dropped  int64
+}
+
+type hint struct {
+	CreatedAt int64          `json:"created_at"`
+	Event     *EventAnnounce `json:"event"`
+}
+
+var (
+	hintsBucket = []byte("hints")
+	// hintCountsBucket maps nodes to the amount of hints stored for them.
+	hintCountsBucket = []byte("hint_counts")
+	// peersBucket maps known peers to the time they have been seen last.
+	peersBucket = []byte("peers")
+)
+
+// peerTouchInterval is how often the time a peer has been seen last is persisted.
+const peerTouchInterval = time.Minute
+
+func hintCount(tx *bolt.Tx, nodeID []byte) int {
+	v := tx.Bucket(hintCountsBucket).Get(nodeID)
+	if v == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(v))
+}
+
+func setHintCount(tx *bolt.Tx, nodeID []byte, n int) error {
+	if n <= 0 {
+		return tx.Bucket(hintCountsBucket).Delete(nodeID)
+	}
+	return tx.Bucket(hintCountsBucket).Put(nodeID, seqKey(uint64(n)))
+}
+
+func (h *kvHintStore) Add(nodeID string, event *EventAnnounce) error {
+	_, err := h.add(nodeID, event, false)
+	return err
+}
+
+func (h *kvHintStore) AddPending(nodeID string, event *EventAnnounce) (bool, error) {
+	return h.add(nodeID, event, true)
+}
+
+func (h *kvHintStore) add(nodeID string, event *EventAnnounce, pendingOnly bool) (bool, error) {
+	data, err := json.Marshal(hint{
+		CreatedAt: time.Now().UnixNano(),
+		Event:     event,
+	})
+	if err != nil {
+		return false, err
+	}
+	var added bool
+	err = h.db.Update(func(tx *bolt.Tx) error {
+		hints := tx.Bucket(hintsBucket)
+		if pendingOnly && hints.Bucket([]byte(nodeID)) == nil {
+			return nil
+		}
+		b, err := hints.CreateBucketIfNotExists([]byte(nodeID))
+		if err != nil {
+			return err
+		}
+		n := hintCount(tx, []byte(nodeID))
+		if h.maxPerNode > 0 && n >= h.maxPerNode {
+			// drop the oldest hints to fit the new one
+			var oldest [][]byte
+			cur := b.Cursor()
+			for k, _ := cur.First(); k != nil && n-len(oldest) >= h.maxPerNode; k, _ = cur.Next() {
+				oldest = append(oldest, append([]byte{}, k...))
+			}
+			for _, k := range oldest {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+				atomic.AddInt64(&h.dropped, 1)
+			}
+			n -= len(oldest)
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := b.Put(seqKey(seq), data); err != nil {
+			return err
+		}
+		added = true
+		return setHintCount(tx, []byte(nodeID), n+1)
+	})
+	if err != nil {
+		return false, err
+	} else if added {
+		atomic.AddInt64(&h.added, 1)
+	}
+	return added, nil
+}
+
+const hintsReplayBatch = 100
+
+func (h *kvHintStore) Replay(nodeID string, fn func(event *EventAnnounce) error) (int, error) {
+	var replayed int
+	for {
+		var keys [][]byte
+		var hints []*hint
+		if err := h.db.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket(hintsBucket).Bucket([]byte(nodeID))
+			if b == nil {
+				return nil
+			}
+			cur := b.Cursor()
+			for k, v := cur.First(); k != nil && len(keys) < hintsReplayBatch; k, v = cur.Next() {
+				var hint *hint
+				if err := json.Unmarshal(v, &hint); err != nil {
+					return err
+				}
+				keys = append(keys, append([]byte{}, k...))
+				hints = append(hints, hint)
+			}
+			return nil
+		}); err != nil {
+			return replayed, err
+		}
+		if len(keys) == 0 {
+			return replayed, nil
+		}
+		deadline := time.Now().Add(-h.ttl).UnixNano()
+		var done int
+		var fnErr error
+		for _, hint := range hints {
+			if h.ttl > 0 && hint.CreatedAt < deadline {
+				atomic.AddInt64(&h.expired, 1)
+				done++
+				continue
+			}
+			if fnErr = fn(hint.Event); fnErr != nil {
+				break
+			}
+			atomic.AddInt64(&h.replayed, 1)
+			replayed++
+			done++
+		}
+		if err := h.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(hintsBucket).Bucket([]byte(nodeID))
+			if b == nil {
+				return nil
+			}
+			for _, k := range keys[:done] {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			if k, _ := b.Cursor().First(); k == nil {
+				if err := setHintCount(tx, []byte(nodeID), 0); err != nil {
+					return err
+				}
+				return tx.Bucket(hintsBucket).DeleteBucket([]byte(nodeID))
+			}
+			return setHintCount(tx, []byte(nodeID), hintCount(tx, []byte(nodeID))-done)
+		}); err != nil {
+			return replayed, err
+		}
+		if fnErr != nil {
+			return replayed, fnErr
+		}
+	}
+}
+
+func (h *kvHintStore) Nodes() ([]string, error) {
+	var nodes []string
+	err := h.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(hintsBucket).ForEach(func(k, v []byte) error {
+			if v == nil {
+				// nested bucket
+				nodes = append(nodes, string(k))
+			}
+			return nil
+		})
+	})
+	return nodes, err
+}
+
+func (h *kvHintStore) Seen(nodeIDs []string) error {
+	now := time.Now().UnixNano()
+	var touched []string
+	h.peersMux.RLock()
+	for _, nodeID := range nodeIDs {
+		if ts, ok := h.peers[nodeID]; !ok || now-ts > int64(peerTouchInterval) {
+			touched = append(touched, nodeID)
+		}
+	}
+	h.peersMux.RUnlock()
+	if len(touched) == 0 {
+		return nil
+	}
+	if err := h.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(peersBucket)
+		for _, nodeID := range touched {
+			if err := b.Put([]byte(nodeID), seqKey(uint64(now))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	h.peersMux.Lock()
+	for _, nodeID := range touched {
+		h.peers[nodeID] = now
+	}
+	h.peersMux.Unlock()
+	return nil
+}
+
+func (h *kvHintStore) Peers() []string {
+	h.peersMux.RLock()
+	peers := make([]string, 0, len(h.peers))
+	for nodeID := range h.peers {
+		peers = append(peers, nodeID)
+	}
+	h.peersMux.RUnlock()
+	return peers
+}
+
+func (h *kvHintStore) Expire() error {
+	if h.ttl <= 0 {
+		return nil
+	}
+	deadline := time.Now().Add(-h.ttl).UnixNano()
+	if err := h.forgetPeers(deadline); err != nil {
+		return err
+	}
+	return h.db.Update(func(tx *bolt.Tx) error {
+		hints := tx.Bucket(hintsBucket)
+		var empty [][]byte
+		if err := hints.ForEach(func(nodeID, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			b := hints.Bucket(nodeID)
+			var expired [][]byte
+			cur := b.Cursor()
+			for k, v := cur.First(); k != nil; k, v = cur.Next() {
+				var hint hint
+				if err := json.Unmarshal(v, &hint); err != nil {
+					return err
+				}
+				if hint.CreatedAt >= deadline {
+					// hints are ordered by time of creation
+					break
+				}
+				expired = append(expired, append([]byte{}, k...))
+			}
+			for _, k := range expired {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+				atomic.AddInt64(&h.expired, 1)
+			}
+			if err := setHintCount(tx, nodeID, hintCount(tx, nodeID)-len(expired)); err != nil {
+				return err
+			}
+			if k, _ := b.Cursor().First(); k == nil {
+				empty = append(empty, append([]byte{}, nodeID...))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, nodeID := range empty {
+			if err := hints.DeleteBucket(nodeID); err != nil {
+				return err
+			} else if err := setHintCount(tx, nodeID, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// forgetPeers forgets peers not seen since the deadline, hints for them would expire anyway.
+func (h *kvHintStore) forgetPeers(deadline int64) error {
+	var forgotten []string
+	h.peersMux.RLock()
+	for nodeID, ts := range h.peers {
+		if ts < deadline {
+			forgotten = append(forgotten, nodeID)
+		}
+	}
+	h.peersMux.RUnlock()
+	if len(forgotten) == 0 {
+		return nil
+	}
+	if err := h.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(peersBucket)
+		for _, nodeID := range forgotten {
+			if err := b.Delete([]byte(nodeID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	h.peersMux.Lock()
+	for _, nodeID := range forgotten {
+		delete(h.peers, nodeID)
+	}
+	h.peersMux.Unlock()
+	return nil
+}
+
+func (h *kvHintStore) Stats() *HintStats {
+	stats := &HintStats{
+		Added:    atomic.LoadInt64(&h.added),
+		Replayed: atomic.LoadInt64(&h.replayed),
+		Expired:  atomic.LoadInt64(&h.expired),
+		Dropped:  atomic.LoadInt64(&h.dropped),
+	}
+	h.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(hintCountsBucket).ForEach(func(nodeID, v []byte) error {
+			stats.Nodes++
+			stats.Stored += int(binary.BigEndian.Uint64(v))
+			return nil
+		})
+	})
+	return stats
+}
@@ -3,10 +3,11 @@ package cluster
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"sync"
 
 	"sphere.software/objstore/journal"
 )
@@ -15,8 +16,13 @@ type ClusterManager interface {
 	ListNodes() ([]*NodeInfo, error)
 	Announce(ctx context.Context, nodeID string, event *EventAnnounce) error
 	GetObject(ctx context.Context, nodeID string, id string) (io.ReadCloser, error)
-	Sync(ctx context.Context, nodeID string,
-		list journal.FileMetaList) (added, deleted journal.FileMetaList, err error)
+	HeadObject(ctx context.Context, nodeID string, id string) (*journal.FileMeta, error)
+	Sync(ctx context.Context, nodeID string, list journal.FileMetaList) (added, deleted journal.FileMetaList,
+		changed journal.FileMetaChangeList, err error)
+	SyncChanges(ctx context.Context, nodeID string, req *SyncChangesRequest) (*SyncChanges, error)
+	SyncChunk(ctx context.Context, nodeID string, req *SyncChunkRequest) (*journal.ChunkDiff, error)
+	HashRanges(ctx context.Context, nodeID string, prefixes []string) (map[string][]*journal.RangeHash, error)
+	ExportRanges(ctx context.Context, nodeID string, prefixes []string) (journal.FileMetaList, error)
 }
 
 type NodeInfo struct {
@@ -29,12 +35,19 @@ func NewClusterManager(cli *PrivateClient, nodeID string) ClusterManager {
 	return &clusterManager{
 		cli:    cli,
 		nodeID: nodeID,
+
+		codecs:   make(map[string]Codec),
+		codecMux: new(sync.RWMutex),
 	}
 }
 
 type clusterManager struct {
 	nodeID string
 	cli    *PrivateClient
+
+	// codecs keeps request encodings advertised by nodes
+	codecs   map[string]Codec
+	codecMux *sync.RWMutex
 }
 
 func (c *clusterManager) ListNodes() ([]*NodeInfo, error) {
@@ -53,21 +66,7 @@ func (c *clusterManager) ListNodes() ([]*NodeInfo, error) {
 }
 
 func (c *clusterManager) Announce(ctx context.Context, nodeID string, event *EventAnnounce) error {
-	body, _ := json.Marshal(event)
-	resp, err := c.cli.POST(ctx, nodeID, "/private/v1/announce", bytes.NewReader(body))
-	if err != nil {
-		return err
-	}
-	respBody, _ := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	if resp.StatusCode != 200 {
-		if len(respBody) > 0 {
-			err := errors.New(string(respBody))
-			return err
-		}
-		return errors.New(resp.Status)
-	}
-	return nil
+	return c.call(ctx, "POST", nodeID, "/private/v1/announce", event, nil)
 }
 
 var ErrNotFound = errors.New("not found")
@@ -93,31 +92,121 @@ func (c *clusterManager) GetObject(ctx context.Context, nodeID string, id string
 	return resp.Body, nil
 }
 
-type SyncResponse struct {
-	Added   journal.FileMetaList `json:"list_added"`
-	Deleted journal.FileMetaList `json:"list_deleted"`
+func (c *clusterManager) HeadObject(ctx context.Context, nodeID string, id string) (*journal.FileMeta, error) {
+	var meta journal.FileMeta
+	if err := c.call(ctx, "GET", nodeID, "/private/v1/meta/"+id, nil, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
 }
 
-func (c *clusterManager) Sync(ctx context.Context, nodeID string,
-	list journal.FileMetaList) (added, deleted journal.FileMetaList, err error) {
+// Sync sends the full journal to the node, and gets back the entries missing on this node as added,
+// the entries missing on the node as deleted, and the entries that differ as changed,
+// where Prev is the version of this node and Next is the version of the node.
+func (c *clusterManager) Sync(ctx context.Context, nodeID string, list journal.FileMetaList) (added, deleted journal.FileMetaList,
+	changed journal.FileMetaChangeList, err error) {
 
-	body, _ := json.Marshal(list)
-	resp, err := c.cli.POST(ctx, nodeID, "/private/v1/sync", bytes.NewReader(body))
+	var syncResp SyncResponse
+	if err := c.call(ctx, "POST", nodeID, "/private/v1/sync", list, &syncResp); err != nil {
+		return nil, nil, nil, err
+	}
+	return syncResp.Added, syncResp.Deleted, syncResp.Changed, nil
+}
+
+// SyncChanges gets changes from the peer's journal since the watermark. Returns ErrNotFound
+// if the peer doesn't support incremental sync.
+func (c *clusterManager) SyncChanges(ctx context.Context, nodeID string,
+	req *SyncChangesRequest) (*SyncChanges, error) {
+
+	var changes SyncChanges
+	if err := c.call(ctx, "POST", nodeID, "/private/v2/sync", req, &changes); err != nil {
+		return nil, err
+	}
+	return &changes, nil
+}
+
+// SyncChunk compares a chunk of the journal with the node's journal, the result has the same semantics
+// as Sync. If the result is not done, the rest of the chunk must be sent again after the Until key.
+// Returns ErrNotFound if the peer doesn't support chunked sync.
+func (c *clusterManager) SyncChunk(ctx context.Context, nodeID string,
+	req *SyncChunkRequest) (*journal.ChunkDiff, error) {
+
+	var diff journal.ChunkDiff
+	if err := c.call(ctx, "POST", nodeID, "/private/v1/sync/chunk", req, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+func (c *clusterManager) HashRanges(ctx context.Context, nodeID string,
+	prefixes []string) (map[string][]*journal.RangeHash, error) {
+
+	var rangesResp HashRangesResponse
+	if err := c.call(ctx, "POST", nodeID, "/private/v1/merkle", &RangesRequest{
+		Prefixes: prefixes,
+	}, &rangesResp); err != nil {
+		return nil, err
+	}
+	return rangesResp.Ranges, nil
+}
+
+func (c *clusterManager) ExportRanges(ctx context.Context, nodeID string,
+	prefixes []string) (journal.FileMetaList, error) {
+
+	var list journal.FileMetaList
+	if err := c.call(ctx, "POST", nodeID, "/private/v1/ranges", &RangesRequest{
+		Prefixes: prefixes,
+	}, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// call sends req to the node and decodes the response into v, both are optional. The request is encoded
+// with the best codec advertised by the node, JSON is used until the node has responded at least once.
+// Returns ErrNotFound if the node responds with 404.
+func (c *clusterManager) call(ctx context.Context, method, nodeID, path string, req, v interface{}) error {
+	header := make(http.Header)
+	var body io.Reader
+	if req != nil {
+		data, err := c.codecOf(nodeID).Encode(header, req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	NativeCodec.SetAccept(header)
+	resp, err := c.cli.Do(ctx, method, nodeID, path, header, body)
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
 	respBody, _ := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
-	if resp.StatusCode != 200 {
+	c.setCodec(nodeID, AdvertisedCodec(resp.Header))
+	if resp.StatusCode == 404 {
+		return ErrNotFound
+	} else if resp.StatusCode != 200 {
 		if len(respBody) > 0 {
 			err := errors.New(string(respBody))
-			return nil, nil, err
+			return err
 		}
-		return nil, nil, errors.New(resp.Status)
+		return errors.New(resp.Status)
 	}
-	var syncResp SyncResponse
-	if err := json.Unmarshal(respBody, &syncResp); err != nil {
-		return nil, nil, err
+	if v == nil {
+		return nil
 	}
-	return syncResp.Added, syncResp.Deleted, nil
+	return Decode(resp.Header, respBody, v)
+}
+
+func (c *clusterManager) codecOf(nodeID string) Codec {
+	c.codecMux.RLock()
+	codec := c.codecs[nodeID]
+	c.codecMux.RUnlock()
+	return codec
+}
+
+func (c *clusterManager) setCodec(nodeID string, codec Codec) {
+	c.codecMux.Lock()
+	c.codecs[nodeID] = codec
+	c.codecMux.Unlock()
 }
@@ -0,0 +1,67 @@
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// Placement decides which nodes of the cluster should hold an object.
+type Placement interface {
+	// Rank orders nodes by their preference to hold the object, most preferred first.
+	Rank(id string, nodes []*NodeInfo) []*NodeInfo
+	// Owners returns n most preferred nodes to hold the object, or all nodes if n is zero.
+	Owners(id string, nodes []*NodeInfo, n int) []*NodeInfo
+}
+
+// NewRendezvousPlacement returns a placement based on rendezvous (highest random weight) hashing.
+// All nodes agree on the owners of an object as long as they see the same list of nodes,
+// and only objects owned by a joined or departed node change their owners.
+func NewRendezvousPlacement() Placement {
+	return rendezvousPlacement{}
+}
+
+type rendezvousPlacement struct{}
+
+func (rendezvousPlacement) Rank(id string, nodes []*NodeInfo) []*NodeInfo {
+	ranked := make([]*NodeInfo, 0, len(nodes))
+	weights := make(map[string]uint64, len(nodes))
+	for _, node := range nodes {
+		if _, ok := weights[node.ID]; ok {
+			// the same node reachable via another upstream
+			continue
+		}
+		weights[node.ID] = rendezvousWeight(id, node.ID)
+		ranked = append(ranked, node)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		wi, wj := weights[ranked[i].ID], weights[ranked[j].ID]
+		if wi != wj {
+			return wi > wj
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+	return ranked
+}
+
+func (r rendezvousPlacement) Owners(id string, nodes []*NodeInfo, n int) []*NodeInfo {
+	ranked := r.Rank(id, nodes)
+	if n <= 0 || n >= len(ranked) {
+		return ranked
+	}
+	return ranked[:n]
+}
+
+func rendezvousWeight(id, nodeID string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(nodeID))
+	h.Write([]byte{0})
+	h.Write([]byte(id))
+	// finalize the hash to spread the weights, see MurmurHash3 fmix64
+	k := h.Sum64()
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb3fe1a85ec53
+	k ^= k >> 33
+	return k
+}
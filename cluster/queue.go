@@ -0,0 +1,255 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// EventQueue is a durable FIFO queue of events backed by BoltDB. Events are kept in the queue
+// until acknowledged, so events queued or being handled when the process stops are replayed
+// upon the next start.
+type EventQueue interface {
+	// Push appends an event to the queue.
+	Push(event *EventAnnounce) error
+	// Pop blocks until there is an event that hasn't been taken by other consumers yet.
+	// Returns ErrQueueClosed once the queue has been closed.
+	Pop() (*QueuedEvent, error)
+	// Ack deletes the event from the queue once it has been handled.
+	Ack(seq uint64) error
+	// Bury moves the event that has failed to be handled to the dead letters of the queue,
+	// so it doesn't hold the queue up. Dead letters are queued again upon the next start.
+	Bury(seq uint64) error
+	// Close wakes up all consumers, unacknowledged events are kept for the next start.
+	Close() error
+	Stats() *QueueStats
+}
+
+type QueuedEvent struct {
+	Seq      uint64         `json:"-"`
+	QueuedAt int64          `json:"queued_at"`
+	Event    *EventAnnounce `json:"event"`
+}
+
+type QueueStats struct {
+	Depth    int   `json:"depth"`
+	InFlight int   `json:"in_flight"`
+	Pushed   int64 `json:"pushed"`
+	Acked    int64 `json:"acked"`
+	// Dead is the amount of events that have failed to be handled, see Bury.
+	Dead int `json:"dead"`
+	// OldestQueuedAt is the time when the oldest event in the queue has been queued.
+	OldestQueuedAt int64 `json:"oldest_queued_at"`
+	// AgeSeconds is the age of the oldest event in the queue.
+	AgeSeconds float64 `json:"age_seconds"`
+}
+
+var ErrQueueClosed = errors.New("queue closed")
+
+// NewEventQueue creates a new queue or opens an existing one with the specified name.
+func NewEventQueue(db *bolt.DB, name string) (EventQueue, error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		queues, err := tx.CreateBucketIfNotExists(queuesBucket)
+		if err != nil {
+			return err
+		}
+		b, err := queues.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+		letters, err := tx.CreateBucketIfNotExists(deadLettersBucket)
+		if err != nil {
+			return err
+		}
+		dead, err := letters.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+		// retry the events that have failed before the restart
+		var keys [][]byte
+		if err := dead.ForEach(func(k, v []byte) error {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			keys = append(keys, k)
+			return b.Put(seqKey(seq), v)
+		}); err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := dead.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	mux := new(sync.Mutex)
+	return &kvEventQueue{
+		db:       db,
+		name:     []byte(name),
+		mux:      mux,
+		cond:     sync.NewCond(mux),
+		inFlight: make(map[uint64]bool),
+	}, nil
+}
+
+type kvEventQueue struct {
+	pushed int64
+	acked  int64
+
+	db   *bolt.DB
+	name []byte
+
+	mux      *sync.Mutex
+	cond     *sync.Cond
+	next     uint64
+	inFlight map[uint64]bool
+	closed   bool
+}
+
+var (
+	queuesBucket = []byte("queues")
+	// deadLettersBucket keeps events that have failed to be handled, per queue.
+	deadLettersBucket = []byte("dead_letters")
+)
+
+func (q *kvEventQueue) bucket(tx *bolt.Tx) *bolt.Bucket {
+	return tx.Bucket(queuesBucket).Bucket(q.name)
+}
+
+func (q *kvEventQueue) deadLetters(tx *bolt.Tx) *bolt.Bucket {
+	return tx.Bucket(deadLettersBucket).Bucket(q.name)
+}
+
+func (q *kvEventQueue) Push(event *EventAnnounce) error {
+	data, err := json.Marshal(QueuedEvent{
+		QueuedAt: time.Now().UnixNano(),
+		Event:    event,
+	})
+	if err != nil {
+		return err
+	}
+	if err := q.db.Update(func(tx *bolt.Tx) error {
+		b := q.bucket(tx)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(seqKey(seq), data)
+	}); err != nil {
+		return err
+	}
+	atomic.AddInt64(&q.pushed, 1)
+	q.mux.Lock()
+	q.cond.Signal()
+	q.mux.Unlock()
+	return nil
+}
+
+func (q *kvEventQueue) Pop() (*QueuedEvent, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	for !q.closed {
+		var item *QueuedEvent
+		if err := q.db.View(func(tx *bolt.Tx) error {
+			k, v := q.bucket(tx).Cursor().Seek(seqKey(q.next))
+			if k == nil {
+				return nil
+			}
+			item = new(QueuedEvent)
+			if err := json.Unmarshal(v, item); err != nil {
+				return err
+			}
+			item.Seq = binary.BigEndian.Uint64(k)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		if item != nil {
+			q.next = item.Seq + 1
+			q.inFlight[item.Seq] = true
+			return item, nil
+		}
+		q.cond.Wait()
+	}
+	return nil, ErrQueueClosed
+}
+
+func (q *kvEventQueue) Ack(seq uint64) error {
+	if err := q.db.Update(func(tx *bolt.Tx) error {
+		return q.bucket(tx).Delete(seqKey(seq))
+	}); err != nil {
+		return err
+	}
+	atomic.AddInt64(&q.acked, 1)
+	q.mux.Lock()
+	delete(q.inFlight, seq)
+	q.mux.Unlock()
+	return nil
+}
+
+func (q *kvEventQueue) Bury(seq uint64) error {
+	if err := q.db.Update(func(tx *bolt.Tx) error {
+		b := q.bucket(tx)
+		v := b.Get(seqKey(seq))
+		if v == nil {
+			return nil
+		}
+		if err := q.deadLetters(tx).Put(seqKey(seq), v); err != nil {
+			return err
+		}
+		return b.Delete(seqKey(seq))
+	}); err != nil {
+		return err
+	}
+	q.mux.Lock()
+	delete(q.inFlight, seq)
+	q.mux.Unlock()
+	return nil
+}
+
+func (q *kvEventQueue) Close() error {
+	q.mux.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mux.Unlock()
+	return nil
+}
+
+func (q *kvEventQueue) Stats() *QueueStats {
+	stats := &QueueStats{
+		Pushed: atomic.LoadInt64(&q.pushed),
+		Acked:  atomic.LoadInt64(&q.acked),
+	}
+	q.mux.Lock()
+	stats.InFlight = len(q.inFlight)
+	q.mux.Unlock()
+	q.db.View(func(tx *bolt.Tx) error {
+		b := q.bucket(tx)
+		stats.Depth = b.Stats().KeyN
+		stats.Dead = q.deadLetters(tx).Stats().KeyN
+		if _, v := b.Cursor().First(); v != nil {
+			var item QueuedEvent
+			if err := json.Unmarshal(v, &item); err == nil {
+				stats.OldestQueuedAt = item.QueuedAt
+				stats.AgeSeconds = time.Since(time.Unix(0, item.QueuedAt)).Seconds()
+			}
+		}
+		return nil
+	})
+	return stats
+}
+
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
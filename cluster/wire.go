@@ -0,0 +1,44 @@
+package cluster
+
+import "sphere.software/objstore/journal"
+
+// Bodies of the private API requests and responses, see codec.go for their encoding.
+
+type SyncResponse struct {
+	Added   journal.FileMetaList       `msgp:"0" json:"list_added"`
+	Deleted journal.FileMetaList       `msgp:"1" json:"list_deleted"`
+	Changed journal.FileMetaChangeList `msgp:"2" json:"list_changed"`
+}
+
+// SyncChangesRequest asks for changes of the journal since the last seen sequence.
+// Watermarks map epochs of peers to the last sequence seen, the peer picks its own epoch.
+// If the peer's epoch is unknown, changes are listed from the start of the log.
+// Resync is set by nodes doing a full resync after being out of sync too long.
+type SyncChangesRequest struct {
+	Watermarks map[string]uint64 `msgp:"0" json:"watermarks"`
+	Limit      int               `msgp:"1" json:"limit"`
+	Resync     bool              `msgp:"2" json:"resync"`
+}
+
+type SyncChanges struct {
+	Epoch   string               `msgp:"0" json:"epoch"`
+	Changes journal.FileMetaList `msgp:"1" json:"changes"`
+	Next    uint64               `msgp:"2" json:"next"`
+	More    bool                 `msgp:"3" json:"more"`
+}
+
+// SyncChunkRequest carries a chunk of the journal sorted by key, that covers the keys following After
+// up to the last key of the list, or all the remaining keys if Last is set.
+type SyncChunkRequest struct {
+	After string               `msgp:"0" json:"after"`
+	List  journal.FileMetaList `msgp:"1" json:"list"`
+	Last  bool                 `msgp:"2" json:"last"`
+}
+
+type RangesRequest struct {
+	Prefixes []string `msgp:"0" json:"prefixes"`
+}
+
+type HashRangesResponse struct {
+	Ranges map[string][]*journal.RangeHash `msgp:"0" json:"ranges"`
+}
@@ -0,0 +1,1028 @@
+package cluster
+
+// NOTE: THIS FILE WAS PRODUCED BY THE
+// MSGP CODE GENERATION TOOL (github.com/tinylib/msgp)
+// DO NOT EDIT
+
+import (
+	"github.com/tinylib/msgp/msgp"
+	"sphere.software/objstore/journal"
+)
+
+// DecodeMsg implements msgp.Decodable
+func (z *HashRangesResponse) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zegw uint32
+	zegw, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zegw > 0 {
+		zegw--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Ranges":
+			var zrbb uint32
+			zrbb, err = dc.ReadMapHeader()
+			if err != nil {
+				return
+			}
+			if z.Ranges == nil && zrbb > 0 {
+				z.Ranges = make(map[string][]*journal.RangeHash, zrbb)
+			} else if len(z.Ranges) > 0 {
+				for key := range z.Ranges {
+					delete(z.Ranges, key)
+				}
+			}
+			for zrbb > 0 {
+				zrbb--
+				var zrwh string
+				var zhka []*journal.RangeHash
+				zrwh, err = dc.ReadString()
+				if err != nil {
+					return
+				}
+				var zclz uint32
+				zclz, err = dc.ReadArrayHeader()
+				if err != nil {
+					return
+				}
+				if cap(zhka) >= int(zclz) {
+					zhka = (zhka)[:zclz]
+				} else {
+					zhka = make([]*journal.RangeHash, zclz)
+				}
+				for zjsf := range zhka {
+					if dc.IsNil() {
+						err = dc.ReadNil()
+						if err != nil {
+							return
+						}
+						zhka[zjsf] = nil
+					} else {
+						if zhka[zjsf] == nil {
+							zhka[zjsf] = new(journal.RangeHash)
+						}
+						err = zhka[zjsf].DecodeMsg(dc)
+						if err != nil {
+							return
+						}
+					}
+				}
+				z.Ranges[zrwh] = zhka
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *HashRangesResponse) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 1
+	// write "Ranges"
+	err = en.Append(0x81, 0xa6, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x73)
+	if err != nil {
+		return err
+	}
+	err = en.WriteMapHeader(uint32(len(z.Ranges)))
+	if err != nil {
+		return
+	}
+	for zrwh, zhka := range z.Ranges {
+		err = en.WriteString(zrwh)
+		if err != nil {
+			return
+		}
+		err = en.WriteArrayHeader(uint32(len(zhka)))
+		if err != nil {
+			return
+		}
+		for zjsf := range zhka {
+			if zhka[zjsf] == nil {
+				err = en.WriteNil()
+				if err != nil {
+					return
+				}
+			} else {
+				err = zhka[zjsf].EncodeMsg(en)
+				if err != nil {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *HashRangesResponse) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 1
+	// string "Ranges"
+	o = append(o, 0x81, 0xa6, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x73)
+	o = msgp.AppendMapHeader(o, uint32(len(z.Ranges)))
+	for zrwh, zhka := range z.Ranges {
+		o = msgp.AppendString(o, zrwh)
+		o = msgp.AppendArrayHeader(o, uint32(len(zhka)))
+		for zjsf := range zhka {
+			if zhka[zjsf] == nil {
+				o = msgp.AppendNil(o)
+			} else {
+				o, err = zhka[zjsf].MarshalMsg(o)
+				if err != nil {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *HashRangesResponse) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zelh uint32
+	zelh, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zelh > 0 {
+		zelh--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Ranges":
+			var zrdp uint32
+			zrdp, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if z.Ranges == nil && zrdp > 0 {
+				z.Ranges = make(map[string][]*journal.RangeHash, zrdp)
+			} else if len(z.Ranges) > 0 {
+				for key := range z.Ranges {
+					delete(z.Ranges, key)
+				}
+			}
+			for zrdp > 0 {
+				var zrwh string
+				var zhka []*journal.RangeHash
+				zrdp--
+				zrwh, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					return
+				}
+				var zzok uint32
+				zzok, bts, err = msgp.ReadArrayHeaderBytes(bts)
+				if err != nil {
+					return
+				}
+				if cap(zhka) >= int(zzok) {
+					zhka = (zhka)[:zzok]
+				} else {
+					zhka = make([]*journal.RangeHash, zzok)
+				}
+				for zjsf := range zhka {
+					if msgp.IsNil(bts) {
+						bts, err = msgp.ReadNilBytes(bts)
+						if err != nil {
+							return
+						}
+						zhka[zjsf] = nil
+					} else {
+						if zhka[zjsf] == nil {
+							zhka[zjsf] = new(journal.RangeHash)
+						}
+						bts, err = zhka[zjsf].UnmarshalMsg(bts)
+						if err != nil {
+							return
+						}
+					}
+				}
+				z.Ranges[zrwh] = zhka
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *HashRangesResponse) Msgsize() (s int) {
+	s = 1 + 7 + msgp.MapHeaderSize
+	if z.Ranges != nil {
+		for zrwh, zhka := range z.Ranges {
+			_ = zhka
+			s += msgp.StringPrefixSize + len(zrwh) + msgp.ArrayHeaderSize
+			for zjsf := range zhka {
+				if zhka[zjsf] == nil {
+					s += msgp.NilSize
+				} else {
+					s += zhka[zjsf].Msgsize()
+				}
+			}
+		}
+	}
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *RangesRequest) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zshn uint32
+	zshn, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zshn > 0 {
+		zshn--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Prefixes":
+			var ztez uint32
+			ztez, err = dc.ReadArrayHeader()
+			if err != nil {
+				return
+			}
+			if cap(z.Prefixes) >= int(ztez) {
+				z.Prefixes = (z.Prefixes)[:ztez]
+			} else {
+				z.Prefixes = make([]string, ztez)
+			}
+			for zmsg := range z.Prefixes {
+				z.Prefixes[zmsg], err = dc.ReadString()
+				if err != nil {
+					return
+				}
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *RangesRequest) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 1
+	// write "Prefixes"
+	err = en.Append(0x81, 0xa8, 0x50, 0x72, 0x65, 0x66, 0x69, 0x78, 0x65, 0x73)
+	if err != nil {
+		return err
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Prefixes)))
+	if err != nil {
+		return
+	}
+	for zmsg := range z.Prefixes {
+		err = en.WriteString(z.Prefixes[zmsg])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *RangesRequest) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 1
+	// string "Prefixes"
+	o = append(o, 0x81, 0xa8, 0x50, 0x72, 0x65, 0x66, 0x69, 0x78, 0x65, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Prefixes)))
+	for zmsg := range z.Prefixes {
+		o = msgp.AppendString(o, z.Prefixes[zmsg])
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *RangesRequest) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zkrv uint32
+	zkrv, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zkrv > 0 {
+		zkrv--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Prefixes":
+			var zqhv uint32
+			zqhv, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if cap(z.Prefixes) >= int(zqhv) {
+				z.Prefixes = (z.Prefixes)[:zqhv]
+			} else {
+				z.Prefixes = make([]string, zqhv)
+			}
+			for zmsg := range z.Prefixes {
+				z.Prefixes[zmsg], bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					return
+				}
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *RangesRequest) Msgsize() (s int) {
+	s = 1 + 9 + msgp.ArrayHeaderSize
+	for zmsg := range z.Prefixes {
+		s += msgp.StringPrefixSize + len(z.Prefixes[zmsg])
+	}
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *SyncChanges) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zqob uint32
+	zqob, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zqob > 0 {
+		zqob--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Epoch":
+			z.Epoch, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "Changes":
+			err = z.Changes.DecodeMsg(dc)
+			if err != nil {
+				return
+			}
+		case "Next":
+			z.Next, err = dc.ReadUint64()
+			if err != nil {
+				return
+			}
+		case "More":
+			z.More, err = dc.ReadBool()
+			if err != nil {
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *SyncChanges) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 4
+	// write "Epoch"
+	err = en.Append(0x84, 0xa5, 0x45, 0x70, 0x6f, 0x63, 0x68)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.Epoch)
+	if err != nil {
+		return
+	}
+	// write "Changes"
+	err = en.Append(0xa7, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x73)
+	if err != nil {
+		return err
+	}
+	err = z.Changes.EncodeMsg(en)
+	if err != nil {
+		return
+	}
+	// write "Next"
+	err = en.Append(0xa4, 0x4e, 0x65, 0x78, 0x74)
+	if err != nil {
+		return err
+	}
+	err = en.WriteUint64(z.Next)
+	if err != nil {
+		return
+	}
+	// write "More"
+	err = en.Append(0xa4, 0x4d, 0x6f, 0x72, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBool(z.More)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *SyncChanges) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 4
+	// string "Epoch"
+	o = append(o, 0x84, 0xa5, 0x45, 0x70, 0x6f, 0x63, 0x68)
+	o = msgp.AppendString(o, z.Epoch)
+	// string "Changes"
+	o = append(o, 0xa7, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x73)
+	o, err = z.Changes.MarshalMsg(o)
+	if err != nil {
+		return
+	}
+	// string "Next"
+	o = append(o, 0xa4, 0x4e, 0x65, 0x78, 0x74)
+	o = msgp.AppendUint64(o, z.Next)
+	// string "More"
+	o = append(o, 0xa4, 0x4d, 0x6f, 0x72, 0x65)
+	o = msgp.AppendBool(o, z.More)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *SyncChanges) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zkgv uint32
+	zkgv, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zkgv > 0 {
+		zkgv--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Epoch":
+			z.Epoch, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Changes":
+			bts, err = z.Changes.UnmarshalMsg(bts)
+			if err != nil {
+				return
+			}
+		case "Next":
+			z.Next, bts, err = msgp.ReadUint64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "More":
+			z.More, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *SyncChanges) Msgsize() (s int) {
+	s = 1 + 6 + msgp.StringPrefixSize + len(z.Epoch) + 8 + z.Changes.Msgsize() + 5 + msgp.Uint64Size + 5 + msgp.BoolSize
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *SyncChangesRequest) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var znva uint32
+	znva, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for znva > 0 {
+		znva--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Watermarks":
+			var zxim uint32
+			zxim, err = dc.ReadMapHeader()
+			if err != nil {
+				return
+			}
+			if z.Watermarks == nil && zxim > 0 {
+				z.Watermarks = make(map[string]uint64, zxim)
+			} else if len(z.Watermarks) > 0 {
+				for key := range z.Watermarks {
+					delete(z.Watermarks, key)
+				}
+			}
+			for zxim > 0 {
+				zxim--
+				var zwqb string
+				var zyzi uint64
+				zwqb, err = dc.ReadString()
+				if err != nil {
+					return
+				}
+				zyzi, err = dc.ReadUint64()
+				if err != nil {
+					return
+				}
+				z.Watermarks[zwqb] = zyzi
+			}
+		case "Limit":
+			z.Limit, err = dc.ReadInt()
+			if err != nil {
+				return
+			}
+		case "Resync":
+			z.Resync, err = dc.ReadBool()
+			if err != nil {
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *SyncChangesRequest) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "Watermarks"
+	err = en.Append(0x83, 0xaa, 0x57, 0x61, 0x74, 0x65, 0x72, 0x6d, 0x61, 0x72, 0x6b, 0x73)
+	if err != nil {
+		return err
+	}
+	err = en.WriteMapHeader(uint32(len(z.Watermarks)))
+	if err != nil {
+		return
+	}
+	for zwqb, zyzi := range z.Watermarks {
+		err = en.WriteString(zwqb)
+		if err != nil {
+			return
+		}
+		err = en.WriteUint64(zyzi)
+		if err != nil {
+			return
+		}
+	}
+	// write "Limit"
+	err = en.Append(0xa5, 0x4c, 0x69, 0x6d, 0x69, 0x74)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt(z.Limit)
+	if err != nil {
+		return
+	}
+	// write "Resync"
+	err = en.Append(0xa6, 0x52, 0x65, 0x73, 0x79, 0x6e, 0x63)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBool(z.Resync)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *SyncChangesRequest) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "Watermarks"
+	o = append(o, 0x83, 0xaa, 0x57, 0x61, 0x74, 0x65, 0x72, 0x6d, 0x61, 0x72, 0x6b, 0x73)
+	o = msgp.AppendMapHeader(o, uint32(len(z.Watermarks)))
+	for zwqb, zyzi := range z.Watermarks {
+		o = msgp.AppendString(o, zwqb)
+		o = msgp.AppendUint64(o, zyzi)
+	}
+	// string "Limit"
+	o = append(o, 0xa5, 0x4c, 0x69, 0x6d, 0x69, 0x74)
+	o = msgp.AppendInt(o, z.Limit)
+	// string "Resync"
+	o = append(o, 0xa6, 0x52, 0x65, 0x73, 0x79, 0x6e, 0x63)
+	o = msgp.AppendBool(o, z.Resync)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *SyncChangesRequest) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zlmr uint32
+	zlmr, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zlmr > 0 {
+		zlmr--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Watermarks":
+			var zojm uint32
+			zojm, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if z.Watermarks == nil && zojm > 0 {
+				z.Watermarks = make(map[string]uint64, zojm)
+			} else if len(z.Watermarks) > 0 {
+				for key := range z.Watermarks {
+					delete(z.Watermarks, key)
+				}
+			}
+			for zojm > 0 {
+				var zwqb string
+				var zyzi uint64
+				zojm--
+				zwqb, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					return
+				}
+				zyzi, bts, err = msgp.ReadUint64Bytes(bts)
+				if err != nil {
+					return
+				}
+				z.Watermarks[zwqb] = zyzi
+			}
+		case "Limit":
+			z.Limit, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Resync":
+			z.Resync, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *SyncChangesRequest) Msgsize() (s int) {
+	s = 1 + 11 + msgp.MapHeaderSize
+	if z.Watermarks != nil {
+		for zwqb, zyzi := range z.Watermarks {
+			_ = zyzi
+			s += msgp.StringPrefixSize + len(zwqb) + msgp.Uint64Size
+		}
+	}
+	s += 6 + msgp.IntSize + 7 + msgp.BoolSize
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *SyncChunkRequest) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zkzd uint32
+	zkzd, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zkzd > 0 {
+		zkzd--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "After":
+			z.After, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "List":
+			err = z.List.DecodeMsg(dc)
+			if err != nil {
+				return
+			}
+		case "Last":
+			z.Last, err = dc.ReadBool()
+			if err != nil {
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *SyncChunkRequest) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "After"
+	err = en.Append(0x83, 0xa5, 0x41, 0x66, 0x74, 0x65, 0x72)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.After)
+	if err != nil {
+		return
+	}
+	// write "List"
+	err = en.Append(0xa4, 0x4c, 0x69, 0x73, 0x74)
+	if err != nil {
+		return err
+	}
+	err = z.List.EncodeMsg(en)
+	if err != nil {
+		return
+	}
+	// write "Last"
+	err = en.Append(0xa4, 0x4c, 0x61, 0x73, 0x74)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBool(z.Last)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *SyncChunkRequest) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "After"
+	o = append(o, 0x83, 0xa5, 0x41, 0x66, 0x74, 0x65, 0x72)
+	o = msgp.AppendString(o, z.After)
+	// string "List"
+	o = append(o, 0xa4, 0x4c, 0x69, 0x73, 0x74)
+	o, err = z.List.MarshalMsg(o)
+	if err != nil {
+		return
+	}
+	// string "Last"
+	o = append(o, 0xa4, 0x4c, 0x61, 0x73, 0x74)
+	o = msgp.AppendBool(o, z.Last)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *SyncChunkRequest) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zklh uint32
+	zklh, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zklh > 0 {
+		zklh--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "After":
+			z.After, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "List":
+			bts, err = z.List.UnmarshalMsg(bts)
+			if err != nil {
+				return
+			}
+		case "Last":
+			z.Last, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *SyncChunkRequest) Msgsize() (s int) {
+	s = 1 + 6 + msgp.StringPrefixSize + len(z.After) + 5 + z.List.Msgsize() + 5 + msgp.BoolSize
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *SyncResponse) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zbzx uint32
+	zbzx, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zbzx > 0 {
+		zbzx--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Added":
+			err = z.Added.DecodeMsg(dc)
+			if err != nil {
+				return
+			}
+		case "Deleted":
+			err = z.Deleted.DecodeMsg(dc)
+			if err != nil {
+				return
+			}
+		case "Changed":
+			err = z.Changed.DecodeMsg(dc)
+			if err != nil {
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *SyncResponse) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "Added"
+	err = en.Append(0x83, 0xa5, 0x41, 0x64, 0x64, 0x65, 0x64)
+	if err != nil {
+		return err
+	}
+	err = z.Added.EncodeMsg(en)
+	if err != nil {
+		return
+	}
+	// write "Deleted"
+	err = en.Append(0xa7, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x64)
+	if err != nil {
+		return err
+	}
+	err = z.Deleted.EncodeMsg(en)
+	if err != nil {
+		return
+	}
+	// write "Changed"
+	err = en.Append(0xa7, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x64)
+	if err != nil {
+		return err
+	}
+	err = z.Changed.EncodeMsg(en)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *SyncResponse) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "Added"
+	o = append(o, 0x83, 0xa5, 0x41, 0x64, 0x64, 0x65, 0x64)
+	o, err = z.Added.MarshalMsg(o)
+	if err != nil {
+		return
+	}
+	// string "Deleted"
+	o = append(o, 0xa7, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x64)
+	o, err = z.Deleted.MarshalMsg(o)
+	if err != nil {
+		return
+	}
+	// string "Changed"
+	o = append(o, 0xa7, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x64)
+	o, err = z.Changed.MarshalMsg(o)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *SyncResponse) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zzbi uint32
+	zzbi, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zzbi > 0 {
+		zzbi--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Added":
+			bts, err = z.Added.UnmarshalMsg(bts)
+			if err != nil {
+				return
+			}
+		case "Deleted":
+			bts, err = z.Deleted.UnmarshalMsg(bts)
+			if err != nil {
+				return
+			}
+		case "Changed":
+			bts, err = z.Changed.UnmarshalMsg(bts)
+			if err != nil {
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *SyncResponse) Msgsize() (s int) {
+	s = 1 + 6 + z.Added.Msgsize() + 8 + z.Deleted.Msgsize() + 8 + z.Changed.Msgsize()
+	return
+}
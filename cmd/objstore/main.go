@@ -1,6 +1,10 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -74,6 +78,93 @@ var (
 		EnvVar: "APP_FILES_DIR",
 		Value:  "files/",
 	})
+	rebalanceBandwidth = app.Int(cli.IntOpt{
+		Name:   "rebalance-bandwidth",
+		Desc:   "Bandwidth limit for rebalancing objects across nodes, in bytes per second (0 means no limit).",
+		EnvVar: "APP_REBALANCE_BANDWIDTH",
+		Value:  0,
+	})
+	hintsTTL = app.String(cli.StringOpt{
+		Name:   "hints-ttl",
+		Desc:   "How long to keep announcements for unreachable nodes.",
+		EnvVar: "APP_HINTS_TTL",
+		Value:  "24h",
+	})
+	hintsLimit = app.Int(cli.IntOpt{
+		Name:   "hints-limit",
+		Desc:   "Max amount of announcements to keep per unreachable node.",
+		EnvVar: "APP_HINTS_LIMIT",
+		Value:  100000,
+	})
+	tombstoneRetention = app.String(cli.StringOpt{
+		Name:   "tombstone-retention",
+		Desc:   "How long to keep journal entries of deleted objects (0 means forever).",
+		EnvVar: "APP_TOMBSTONE_RETENTION",
+		Value:  "720h",
+	})
+	tlsCert = app.String(cli.StringOpt{
+		Name:   "tls-cert",
+		Desc:   "Node certificate for mutual TLS in the private network.",
+		EnvVar: "APP_TLS_CERT",
+		Value:  "",
+	})
+	tlsKey = app.String(cli.StringOpt{
+		Name:   "tls-key",
+		Desc:   "Node private key for mutual TLS in the private network.",
+		EnvVar: "APP_TLS_KEY",
+		Value:  "",
+	})
+	tlsCA = app.String(cli.StringOpt{
+		Name:   "tls-ca",
+		Desc:   "Cluster CA certificate to verify peers in the private network.",
+		EnvVar: "APP_TLS_CA",
+		Value:  "",
+	})
+	clusterSecret = app.String(cli.StringOpt{
+		Name:      "cluster-secret",
+		Desc:      "Pre-shared secret to authenticate peers in the private network.",
+		EnvVar:    "APP_CLUSTER_SECRET",
+		Value:     "",
+		HideValue: true,
+	})
+	authConfig = app.String(cli.StringOpt{
+		Name:   "auth-config",
+		Desc:   "Config file with API keys for the public API, if not set the public API is open.",
+		EnvVar: "APP_AUTH_CONFIG",
+		Value:  "",
+	})
+	presignKey = app.String(cli.StringOpt{
+		Name:      "presign-key",
+		Desc:      "Key to sign URLs granting temporary access to objects, must be the same on all nodes.",
+		EnvVar:    "APP_PRESIGN_KEY",
+		Value:     "",
+		HideValue: true,
+	})
+	accessLog = app.String(cli.StringOpt{
+		Name:   "access-log",
+		Desc:   "File where to record requests to the public API.",
+		EnvVar: "APP_ACCESS_LOG",
+		Value:  "",
+	})
+	indexMeta = app.Strings(cli.StringsOpt{
+		Name:      "index-meta",
+		Desc:      "User meta keys to index for queries, must be the same on all nodes.",
+		EnvVar:    "APP_INDEX_META",
+		Value:     []string{},
+		HideValue: true,
+	})
+	namespacesConfig = app.String(cli.StringOpt{
+		Name:   "namespaces",
+		Desc:   "Config file with namespaces of the cluster, must be the same on all nodes.",
+		EnvVar: "APP_NAMESPACES",
+		Value:  "",
+	})
+	s3Addr = app.String(cli.StringOpt{
+		Name:   "s3-addr",
+		Desc:   "Listen address for the S3-compatible API, disabled if empty.",
+		EnvVar: "NET_S3_ADDR",
+		Value:  "",
+	})
 	s3Region = app.String(cli.StringOpt{
 		Name:   "R region",
 		Desc:   "Amazon S3 region name",
@@ -132,7 +223,37 @@ func appMain() {
 
 	privateServer := api.NewPrivateServer(nodeID, *clusterName)
 	privateServer.SetDebug(debugEnabled)
+	if len(*tlsCert) > 0 || len(*tlsKey) > 0 || len(*tlsCA) > 0 {
+		tlsConfig, err := loadTLSConfig(*tlsCert, *tlsKey, *tlsCA)
+		if err != nil {
+			closer.Fatalln("[ERR] failed to load TLS config:", err)
+		}
+		privateServer.SetTLSConfig(tlsConfig)
+	}
+	if len(*clusterSecret) > 0 {
+		privateServer.SetSecret(*clusterSecret)
+	}
 	privateClient := cluster.NewPrivateClient(privateServer.Router())
+	hintsTTLDuration, err := time.ParseDuration(*hintsTTL)
+	if err != nil {
+		closer.Fatalln("[ERR] invalid hints TTL:", err)
+	}
+	tombstoneRetentionDuration, err := time.ParseDuration(*tombstoneRetention)
+	if err != nil {
+		closer.Fatalln("[ERR] invalid tombstone retention:", err)
+	}
+	hintStore, err := cluster.NewHintStore(db, hintsTTLDuration, *hintsLimit)
+	if err != nil {
+		closer.Fatalln("[ERR] failed to init hint store:", err)
+	}
+	inboundQueue, err := cluster.NewEventQueue(db, "inbound")
+	if err != nil {
+		closer.Fatalln("[ERR] failed to init inbound queue:", err)
+	}
+	outboundQueue, err := cluster.NewEventQueue(db, "outbound")
+	if err != nil {
+		closer.Fatalln("[ERR] failed to init outbound queue:", err)
+	}
 	journalManager := journal.NewJournalManager(db)
 	closer.Bind(func() {
 		if err := journalManager.Close(); err != nil {
@@ -144,11 +265,39 @@ func appMain() {
 		storage.NewS3Storage(*s3Region, *s3Bucket),
 		journalManager,
 		cluster.NewClusterManager(privateClient, nodeID),
+		cluster.NewRendezvousPlacement(),
+		hintStore,
+		inboundQueue,
+		outboundQueue,
 	)
 	if err != nil {
 		closer.Fatalln("[ERR]", err)
 	}
 	store.SetDebug(debugEnabled)
+	store.SetRebalanceLimit(int64(*rebalanceBandwidth))
+	store.SetTombstoneRetention(tombstoneRetentionDuration)
+	if err := store.SetIndexedMeta(*indexMeta); err != nil {
+		closer.Fatalln("[ERR] failed to index user meta:", err)
+	}
+	if len(*namespacesConfig) > 0 {
+		namespaces, err := objstore.LoadNamespaces(*namespacesConfig)
+		if err != nil {
+			closer.Fatalln("[ERR] failed to load namespaces:", err)
+		}
+		for _, ns := range namespaces {
+			if len(ns.Bucket) == 0 {
+				continue
+			}
+			region := ns.Region
+			if len(region) == 0 {
+				region = *s3Region
+			}
+			ns.Remote = storage.NewS3Storage(region, ns.Bucket)
+		}
+		if err := store.SetNamespaces(namespaces); err != nil {
+			closer.Fatalln("[ERR]", err)
+		}
+	}
 	privateServer.RouteAPI(store)
 	if err := privateServer.ListenAndServe(*privateAddr); err != nil {
 		closer.Fatalln(err)
@@ -196,6 +345,27 @@ func appMain() {
 	}
 
 	publicServer := api.NewPublicServer(nodeID)
+	var keyStore *api.KeyStore
+	if len(*authConfig) > 0 {
+		keyStore, err = api.LoadKeyStore(*authConfig)
+		if err != nil {
+			closer.Fatalln("[ERR] failed to load auth config:", err)
+		}
+		publicServer.SetAuthenticator(keyStore)
+	}
+	if len(*presignKey) > 0 {
+		publicServer.SetPresignKey(*presignKey)
+	}
+	if len(*accessLog) > 0 {
+		f, err := os.OpenFile(*accessLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			closer.Fatalln("[ERR] failed to open access log:", err)
+		}
+		closer.Bind(func() {
+			f.Close()
+		})
+		publicServer.SetAccessLog(f)
+	}
 	publicServer.RouteAPI(store)
 	go func() {
 		if err := publicServer.ListenAndServe(*publicAddr); err != nil {
@@ -203,6 +373,19 @@ func appMain() {
 		}
 	}()
 
+	if len(*s3Addr) > 0 {
+		s3Server := api.NewS3Server(*s3Bucket)
+		if keyStore != nil {
+			s3Server.SetKeyStore(keyStore)
+		}
+		s3Server.RouteAPI(store)
+		go func() {
+			if err := s3Server.ListenAndServe(*s3Addr); err != nil {
+				closer.Fatalln(err)
+			}
+		}()
+	}
+
 	closer.Hold()
 }
 
@@ -215,3 +398,26 @@ func openStateDB(prefix string) (*bolt.DB, error) {
 		InitialMmapSize: 4 * 1024 * 1024 * 1024, // preallocated space to avoid writers block
 	})
 }
+
+// loadTLSConfig prepares mutual TLS config, peers are verified by the cluster CA both ways.
+func loadTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no CA certificates found in " + caFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
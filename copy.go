@@ -0,0 +1,103 @@
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"sphere.software/objstore/cluster"
+	"sphere.software/objstore/journal"
+)
+
+// CopyObject creates a new object having the body of the live object srcID, meta describes the new
+// object and may change the consistency level. The body is hard linked if the source is stored on this node,
+// the remote copy is made within the remote storage if the source is stored there too, before the object
+// is announced unless the body is linked. Otherwise the body is found on the cluster, like FindObject does,
+// and uploaded to the remote storage if needed.
+func (o *objStore) CopyObject(ctx context.Context, srcID string, meta *FileMeta) (*FileMeta, error) {
+	src, err := o.HeadObject(srcID)
+	if err != nil {
+		return nil, err
+	} else if src.IsDeleted {
+		return nil, ErrNotFound
+	}
+	if _, err := (ConsistencyLevel)(meta.Consistency).Check(); err != nil {
+		return nil, err
+	}
+	meta.Size = src.Size
+	if err := o.checkQuota(meta); err != nil {
+		return nil, err
+	}
+	meta.Clock = o.clock.Now()
+	srcRemote, srcKey := o.remote(src)
+	remote, key := o.remote(meta)
+	remoteCopy := meta.Consistency != journal.ConsistencyLocal &&
+		src.Consistency != journal.ConsistencyLocal && srcRemote == remote
+
+	var linked bool
+	if !src.IsSymlink {
+		// the source may be missing while its entry is being fetched or dropped
+		if _, err := o.localStorage.Stat(src.ID); err == nil {
+			if _, err := o.localStorage.Link(src.ID, meta.ID); err != nil {
+				log.Println("[WARN] failed to link local file:", err)
+			} else {
+				linked = true
+			}
+		}
+	}
+	var copied bool
+	switch {
+	case linked:
+		err = o.setLocal(meta)
+	case remoteCopy:
+		// the body is copied before the object is announced, so nodes fetching it on the event find it
+		if _, err := remote.CopyObject(srcKey, key, (*journal.FileMeta)(meta).Map()); err != nil {
+			err = fmt.Errorf("objstore: remote copy failed: %v", err)
+			return nil, err
+		}
+		copied = true
+		// the body is not on this node, it's kept in the remote storage only, like for non-replicas
+		meta.IsSymlink = true
+		err = o.setLocal(meta)
+	default:
+		var r io.ReadCloser
+		if r, _, err = o.FindObject(ctx, src.ID, true); err != nil {
+			return nil, err
+		}
+		_, err = o.storeLocal(r, meta)
+		r.Close()
+	}
+	if err != nil {
+		err = fmt.Errorf("objstore: local store failed: %v", err)
+		return nil, err
+	}
+	// the symlink flag is local to this node, peers and clients see the object as stored
+	announced := *meta
+	announced.IsSymlink = false
+	o.EmitEventAnnounce(&EventAnnounce{
+		Type:     cluster.EventFileAdded,
+		FileMeta: (*journal.FileMeta)(&announced),
+	})
+	if meta.Consistency == journal.ConsistencyLocal || copied {
+		return &announced, nil
+	}
+	if remoteCopy {
+		if _, err := remote.CopyObject(srcKey, key, (*journal.FileMeta)(meta).Map()); err != nil {
+			err = fmt.Errorf("objstore: remote copy failed: %v", err)
+			return &announced, err
+		}
+		return &announced, nil
+	}
+	f, err := o.localStorage.Read(meta.ID)
+	if err != nil {
+		err = fmt.Errorf("objstore: local store missing file: %v", err)
+		return &announced, err
+	}
+	defer f.Close()
+	if _, err := remote.PutObject(key, f, (*journal.FileMeta)(meta).Map()); err != nil {
+		err = fmt.Errorf("objstore: remote store failed: %v", err)
+		return &announced, err
+	}
+	return &announced, nil
+}
@@ -0,0 +1,229 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	// changesBucket maps the change sequence to the key changed.
+	changesBucket = []byte("changes")
+	// changesIndexBucket maps the key to its latest change sequence,
+	// so the log keeps only one change per key.
+	changesIndexBucket = []byte("changes_index")
+	// syncBucket keeps the epoch of the change log and the watermarks of peers.
+	syncBucket = []byte("sync")
+
+	epochKey    = []byte("epoch")
+	lastSyncKey = []byte("last_sync")
+)
+
+// recordChange appends the key to the change log of the DB, all journals share the log.
+func recordChange(tx *bolt.Tx, k string) error {
+	changes, err := tx.CreateBucketIfNotExists(changesBucket)
+	if err != nil {
+		return err
+	}
+	index, err := tx.CreateBucketIfNotExists(changesIndexBucket)
+	if err != nil {
+		return err
+	}
+	if prev := index.Get([]byte(k)); prev != nil {
+		if err := changes.Delete(prev); err != nil {
+			return err
+		}
+	}
+	seq, err := changes.NextSequence()
+	if err != nil {
+		return err
+	}
+	seqKey := make([]byte, 8)
+	binary.BigEndian.PutUint64(seqKey, seq)
+	if err := changes.Put(seqKey, []byte(k)); err != nil {
+		return err
+	}
+	return index.Put([]byte(k), seqKey)
+}
+
+// forgetChange removes the key from the change log.
+func forgetChange(tx *bolt.Tx, k string) error {
+	changes := tx.Bucket(changesBucket)
+	index := tx.Bucket(changesIndexBucket)
+	if changes == nil || index == nil {
+		return nil
+	}
+	if prev := index.Get([]byte(k)); prev != nil {
+		if err := changes.Delete(prev); err != nil {
+			return err
+		}
+	}
+	return index.Delete([]byte(k))
+}
+
+// Epoch returns the ID of the change log, it's generated once per DB, when the store is opened.
+// Change sequences are comparable only within the same epoch. Upon creation of the epoch all existing keys
+// are added to the change log, so entries written before the log existed are not missed.
+func (kv *kvJournalManager) Epoch() (string, error) {
+	var epoch string
+	if err := kv.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(syncBucket); b != nil {
+			epoch = string(b.Get(epochKey))
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	} else if len(epoch) > 0 {
+		return epoch, nil
+	}
+	return kv.createEpoch()
+}
+
+func (kv *kvJournalManager) createEpoch() (string, error) {
+	var epoch string
+	err := kv.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(syncBucket)
+		if err != nil {
+			return err
+		}
+		if v := b.Get(epochKey); v != nil {
+			epoch = string(v)
+			return nil
+		}
+		if journals := tx.Bucket(journalsBucket); journals != nil {
+			var keys []string
+			cur := journals.Cursor()
+			for id, _ := cur.First(); id != nil; id, _ = cur.Next() {
+				if jb := journals.Bucket(id); jb != nil {
+					jb.ForEach(func(k, _ []byte) error {
+						keys = append(keys, string(k))
+						return nil
+					})
+				}
+			}
+			for _, k := range keys {
+				if err := recordChange(tx, k); err != nil {
+					return err
+				}
+			}
+		}
+		epoch = GetULID()
+		return b.Put(epochKey, []byte(epoch))
+	})
+	return epoch, err
+}
+
+// Changes lists the current entries of keys changed after the specified sequence, up to the limit.
+// Returns the sequence of the last change listed and whether more changes are available.
+func (kv *kvJournalManager) Changes(since uint64, limit int) (list FileMetaList, next uint64, more bool, err error) {
+	next = since
+	err = kv.db.View(func(tx *bolt.Tx) error {
+		changes := tx.Bucket(changesBucket)
+		if changes == nil {
+			return nil
+		}
+		journals := tx.Bucket(journalsBucket)
+		seqKey := make([]byte, 8)
+		binary.BigEndian.PutUint64(seqKey, since+1)
+		cur := changes.Cursor()
+		for k, v := cur.Seek(seqKey); k != nil; k, v = cur.Next() {
+			if limit > 0 && len(list) >= limit {
+				more = true
+				return nil
+			}
+			next = binary.BigEndian.Uint64(k)
+			if meta := lookup(journals, v); meta != nil {
+				list = append(list, meta)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// lookup gets the entry from the first journal having the key.
+func lookup(journals *bolt.Bucket, k []byte) *FileMeta {
+	if journals == nil {
+		return nil
+	}
+	cur := journals.Cursor()
+	for id, _ := cur.First(); id != nil; id, _ = cur.Next() {
+		b := journals.Bucket(id)
+		if b == nil {
+			continue
+		}
+		if v := b.Get(k); v != nil {
+			meta := new(FileMeta)
+			meta.UnmarshalMsg(v)
+			return meta
+		}
+	}
+	return nil
+}
+
+// Watermarks returns the last change sequences seen from all known peer epochs.
+func (kv *kvJournalManager) Watermarks() (map[string]uint64, error) {
+	marks := make(map[string]uint64)
+	err := kv.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(syncBucket)
+		if b == nil {
+			return nil
+		}
+		prefix := watermarkKey("")
+		cur := b.Cursor()
+		for k, v := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cur.Next() {
+			if len(v) == 8 {
+				marks[string(k[len(prefix):])] = binary.BigEndian.Uint64(v)
+			}
+		}
+		return nil
+	})
+	return marks, err
+}
+
+// SetWatermark records the last change sequence seen from the peer with the specified epoch.
+func (kv *kvJournalManager) SetWatermark(epoch string, seq uint64) error {
+	return kv.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(syncBucket)
+		if err != nil {
+			return err
+		}
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, seq)
+		return b.Put(watermarkKey(epoch), v)
+	})
+}
+
+func watermarkKey(epoch string) []byte {
+	return []byte("watermark:" + epoch)
+}
+
+// LastSync returns the time of the last successful sync with peers, zero if unknown.
+func (kv *kvJournalManager) LastSync() (int64, error) {
+	var ts int64
+	err := kv.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(syncBucket)
+		if b == nil {
+			return nil
+		}
+		if v := b.Get(lastSyncKey); len(v) == 8 {
+			ts = int64(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	return ts, err
+}
+
+// SetLastSync records the time of the last successful sync with peers.
+func (kv *kvJournalManager) SetLastSync(ts int64) error {
+	return kv.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(syncBucket)
+		if err != nil {
+			return err
+		}
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, uint64(ts))
+		return b.Put(lastSyncKey, v)
+	})
+}
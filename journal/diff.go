@@ -0,0 +1,205 @@
+package journal
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/cznic/b"
+)
+
+// metaIter iterates over journal entries in key order, returns false when done.
+type metaIter interface {
+	Next() (string, *FileMeta, bool)
+}
+
+func iterOf(j Journal) metaIter {
+	switch j := j.(type) {
+	case *btreeJournal:
+		return j.iter()
+	case *kvJournal:
+		return j.iter()
+	default:
+		panic("journal: indifferentiable types")
+	}
+}
+
+// diff merges two ordered iterators of journal entries.
+func diff(prev, next metaIter) (added, deleted FileMetaList, changed FileMetaChangeList) {
+	diffEach(prev, next, func(_ string, prevV, nextV *FileMeta) bool {
+		switch {
+		case prevV == nil:
+			added = append(added, nextV)
+		case nextV == nil:
+			deleted = append(deleted, prevV)
+		default:
+			changed = append(changed, &FileMetaChange{
+				Prev: prevV,
+				Next: nextV,
+			})
+		}
+		return true
+	})
+	return
+}
+
+// diffEach merges two ordered iterators of journal entries, fn is called for each key that differs:
+// with nil prev for keys present only in next, with nil next for keys present only in prev,
+// and with both entries if their meta differs. The merge stops once fn returns false.
+// Returns the last key processed, so all keys up to it have been compared.
+func diffEach(prev, next metaIter, fn func(k string, prev, next *FileMeta) bool) (lastK string) {
+	prevK, prevV, prevOk := prev.Next()
+	nextK, nextV, nextOk := next.Next()
+	for prevOk || nextOk {
+		var cmp int
+		switch {
+		case !prevOk:
+			cmp = 1
+		case !nextOk:
+			cmp = -1
+		default:
+			cmp = strings.Compare(prevK, nextK)
+		}
+		var proceed = true
+		switch {
+		case cmp < 0:
+			// prevK has been deleted
+			lastK = prevK
+			proceed = fn(prevK, prevV, nil)
+			prevK, prevV, prevOk = prev.Next()
+		case cmp > 0:
+			// nextK has been inserted
+			lastK = nextK
+			proceed = fn(nextK, nil, nextV)
+			nextK, nextV, nextOk = next.Next()
+		default:
+			lastK = prevK
+			if !prevV.Equal(nextV) {
+				proceed = fn(prevK, prevV, nextV)
+			}
+			prevK, prevV, prevOk = prev.Next()
+			nextK, nextV, nextOk = next.Next()
+		}
+		if !proceed {
+			return
+		}
+	}
+	return
+}
+
+type emptyIter struct{}
+
+func (emptyIter) Next() (string, *FileMeta, bool) {
+	return "", nil, false
+}
+
+type btreeIter struct {
+	mux  *sync.Mutex
+	enum *b.Enumerator
+	done bool
+}
+
+func (it *btreeIter) Next() (string, *FileMeta, bool) {
+	if it.done {
+		return "", nil, false
+	}
+	it.mux.Lock()
+	k, v, err := it.enum.Next()
+	it.mux.Unlock()
+	if err != nil {
+		// io.EOF or the enumerator has been invalidated
+		it.done = true
+		it.enum.Close()
+		return "", nil, false
+	}
+	return k.(string), v.(*FileMeta), true
+}
+
+type kvIter struct {
+	cur     *bolt.Cursor
+	started bool
+}
+
+func (it *kvIter) Next() (string, *FileMeta, bool) {
+	var k, v []byte
+	if !it.started {
+		it.started = true
+		k, v = it.cur.First()
+	} else {
+		k, v = it.cur.Next()
+	}
+	// skip nested buckets
+	for k != nil && v == nil {
+		k, v = it.cur.Next()
+	}
+	if k == nil {
+		return "", nil, false
+	}
+	meta := new(FileMeta)
+	meta.UnmarshalMsg(v)
+	return string(k), meta, true
+}
+
+// mergedIter iterates over entries of all journals in key order, starting from the seek key.
+// If the same key is present in multiple journals, the entry of the first journal is used.
+type mergedIter struct {
+	cursors []*cursorState
+}
+
+type cursorState struct {
+	cur *bolt.Cursor
+	k   []byte
+	v   []byte
+}
+
+func newMergedIter(tx *bolt.Tx, seek []byte) *mergedIter {
+	iter := new(mergedIter)
+	journals := tx.Bucket(journalsBucket)
+	if journals == nil {
+		return iter
+	}
+	jcur := journals.Cursor()
+	for id, _ := jcur.First(); id != nil; id, _ = jcur.Next() {
+		b := journals.Bucket(id)
+		if b == nil {
+			continue
+		}
+		state := &cursorState{
+			cur: b.Cursor(),
+		}
+		state.k, state.v = state.cur.Seek(seek)
+		iter.cursors = append(iter.cursors, state)
+	}
+	return iter
+}
+
+func (it *mergedIter) Next() (string, *FileMeta, bool) {
+	for {
+		var minK, minV []byte
+		for _, state := range it.cursors {
+			if state.k == nil {
+				continue
+			}
+			if minK == nil || bytes.Compare(state.k, minK) < 0 {
+				minK, minV = state.k, state.v
+			}
+		}
+		if minK == nil {
+			return "", nil, false
+		}
+		k := string(minK)
+		for _, state := range it.cursors {
+			if state.k != nil && bytes.Equal(state.k, minK) {
+				state.k, state.v = state.cur.Next()
+			}
+		}
+		if minV == nil {
+			// nested bucket
+			continue
+		}
+		meta := new(FileMeta)
+		meta.UnmarshalMsg(minV)
+		return k, meta, true
+	}
+}
@@ -0,0 +1,148 @@
+package journal
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+func (kv *kvJournalManager) ExportEach(fn func(meta *FileMeta) error) error {
+	return kv.db.View(func(tx *bolt.Tx) error {
+		iter := newMergedIter(tx, nil)
+		for {
+			_, meta, ok := iter.Next()
+			if !ok {
+				return nil
+			}
+			if err := fn(meta); err == ErrRangeStop {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+func (kv *kvJournalManager) RangeMerged(seek string, fn func(k string, meta *FileMeta) error) error {
+	return kv.viewJournals(func(journals []Journal) error {
+		iter := newRangeIter(journals, seek)
+		for {
+			k, meta, ok := iter.Next()
+			if !ok {
+				return iter.Err()
+			}
+			if err := fn(k, meta); err == ErrRangeStop {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+func (kv *kvJournalManager) ExportAfter(after string, limit int) (FileMetaList, error) {
+	var list FileMetaList
+	err := kv.db.View(func(tx *bolt.Tx) error {
+		iter := &boundedIter{
+			iter:  newMergedIter(tx, []byte(after)),
+			after: after,
+		}
+		for limit <= 0 || len(list) < limit {
+			_, meta, ok := iter.Next()
+			if !ok {
+				return nil
+			}
+			list = append(list, meta)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// DiffChunk compares a chunk of an external journal with entries of all journals. The chunk must be
+// sorted by key and covers the keys following after up to the last key of the list, or all the
+// remaining keys if the chunk is the last one. At most limit differences are returned, zero means no limit.
+// External entries are compared as the previous state, like in Journal.Diff.
+func (kv *kvJournalManager) DiffChunk(after string, list FileMetaList, last bool, limit int) (*ChunkDiff, error) {
+	prevK := after
+	for _, meta := range list {
+		if meta.ID <= prevK {
+			err := fmt.Errorf("kvJournal: chunk is not sorted after %s: %s", prevK, meta.ID)
+			return nil, err
+		}
+		prevK = meta.ID
+	}
+	result := new(ChunkDiff)
+	err := kv.db.View(func(tx *bolt.Tx) error {
+		local := &boundedIter{
+			iter:  newMergedIter(tx, []byte(after)),
+			after: after,
+		}
+		if !last && len(list) > 0 {
+			local.until = list[len(list)-1].ID
+		}
+		remote := &listIter{
+			list: list,
+		}
+		var count int
+		result.Until = diffEach(remote, local, func(_ string, prev, next *FileMeta) bool {
+			switch {
+			case prev == nil:
+				result.Added = append(result.Added, next)
+			case next == nil:
+				result.Deleted = append(result.Deleted, prev)
+			default:
+				result.Changed = append(result.Changed, &FileMetaChange{
+					Prev: prev,
+					Next: next,
+				})
+			}
+			count++
+			return limit <= 0 || count < limit
+		})
+		if limit <= 0 || count < limit {
+			result.Done = true
+			result.Until = local.until
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// boundedIter limits the iterator to keys following after, up to until if set.
+type boundedIter struct {
+	iter  metaIter
+	after string
+	until string
+}
+
+func (it *boundedIter) Next() (string, *FileMeta, bool) {
+	for {
+		k, meta, ok := it.iter.Next()
+		if !ok {
+			return "", nil, false
+		} else if k <= it.after {
+			continue
+		} else if len(it.until) > 0 && k > it.until {
+			return "", nil, false
+		}
+		return k, meta, true
+	}
+}
+
+type listIter struct {
+	list FileMetaList
+	pos  int
+}
+
+func (it *listIter) Next() (string, *FileMeta, bool) {
+	if it.pos >= len(it.list) {
+		return "", nil, false
+	}
+	meta := it.list[it.pos]
+	it.pos++
+	return meta.ID, meta, true
+}
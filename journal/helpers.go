@@ -2,6 +2,7 @@ package journal
 
 import (
 	"math/rand"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,3 +36,39 @@ func (r *lockedSource) Seed(seed int64) {
 	r.src.Seed(seed)
 	r.lk.Unlock()
 }
+
+// ULIDBound constructs the lowest ULID of the specified time, so ranges of IDs can be
+// bounded by time, as IDs of objects are ULIDs generated upon upload.
+func ULIDBound(t time.Time) string {
+	return ulid.MustNew(ulid.Timestamp(t), zeroEntropy{}).String()
+}
+
+type zeroEntropy struct{}
+
+func (zeroEntropy) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// NamespaceSeparator separates the namespace from the ULID in IDs of objects that belong
+// to namespaces, objects of the default namespace have plain ULIDs as IDs. So entries
+// of each namespace share the same key prefix in journals.
+const NamespaceSeparator = ":"
+
+// SplitID splits the ID of an object into the namespace and the ULID.
+func SplitID(id string) (ns, ulid string) {
+	if i := strings.Index(id, NamespaceSeparator); i >= 0 {
+		return id[:i], id[i+1:]
+	}
+	return "", id
+}
+
+// JoinID constructs the ID of an object in the namespace.
+func JoinID(ns, ulid string) string {
+	if len(ns) == 0 {
+		return ulid
+	}
+	return ns + NamespaceSeparator + ulid
+}
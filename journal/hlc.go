@@ -0,0 +1,71 @@
+package journal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PhysicalHLC returns the HLC timestamp of the wall-clock time with zero logical counter.
+func PhysicalHLC(t time.Time) HLC {
+	if t.UnixNano() <= 0 {
+		return 0
+	}
+	return HLC(uint64(t.UnixNano()/int64(time.Millisecond)) << 16)
+}
+
+// Time returns the physical part of the timestamp.
+func (h HLC) Time() time.Time {
+	return time.Unix(0, int64(h>>16)*int64(time.Millisecond))
+}
+
+// Logical returns the logical counter of the timestamp.
+func (h HLC) Logical() uint16 {
+	return uint16(h)
+}
+
+func (h HLC) String() string {
+	return fmt.Sprintf("%d.%d", h>>16, h.Logical())
+}
+
+// Clock is a hybrid logical clock. Its timestamps never go backwards on a node and
+// always succeed the timestamps received from other nodes, regardless of clock skew.
+type Clock struct {
+	mux  *sync.Mutex
+	last HLC
+}
+
+func NewClock() *Clock {
+	return &Clock{
+		mux: new(sync.Mutex),
+	}
+}
+
+// Now returns a new timestamp for a local mutation.
+func (c *Clock) Now() HLC {
+	pt := PhysicalHLC(time.Now())
+	c.mux.Lock()
+	if pt > c.last {
+		c.last = pt
+	} else {
+		c.last++
+	}
+	ts := c.last
+	c.mux.Unlock()
+	return ts
+}
+
+// Update advances the clock past the timestamp received from another node.
+func (c *Clock) Update(remote HLC) {
+	pt := PhysicalHLC(time.Now())
+	c.mux.Lock()
+	switch {
+	case pt > c.last && pt > remote:
+		c.last = pt
+	case remote > c.last:
+		c.last = remote + 1
+	default:
+		c.last++
+	}
+	c.mux.Unlock()
+}
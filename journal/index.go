@@ -0,0 +1,246 @@
+package journal
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	// indexBucket holds secondary indexes over names and selected user meta of entries, it's derived
+	// from journals and updated along with them. Index keys are the field, the value and the key of
+	// the entry separated by zero bytes, so entries having the same value are sorted by IDs.
+	// Entries of each namespace are indexed in a separate bucket.
+	indexBucket = []byte("index")
+	// indexedMetaBucket lists user meta keys being indexed.
+	indexedMetaBucket = []byte("indexed_meta")
+)
+
+const (
+	nameField       = "name"
+	metaFieldPrefix = "meta."
+)
+
+var ErrNotIndexed = errors.New("journal: query has no indexed fields")
+
+func indexBucketOf(ns string) []byte {
+	if len(ns) == 0 {
+		return indexBucket
+	}
+	return []byte(string(indexBucket) + NamespaceSeparator + ns)
+}
+
+func isIndexBucket(name []byte) bool {
+	return bytes.Equal(name, indexBucket) ||
+		bytes.HasPrefix(name, []byte(string(indexBucket)+NamespaceSeparator))
+}
+
+func indexEntry(field, value, k string) []byte {
+	return []byte(field + "\x00" + value + "\x00" + k)
+}
+
+// indexEntries lists index keys of the entry, deleted entries are not indexed.
+func indexEntries(tx *bolt.Tx, k string, meta *FileMeta) map[string]struct{} {
+	entries := make(map[string]struct{})
+	if meta == nil || meta.IsDeleted {
+		return entries
+	}
+	if len(meta.Name) > 0 {
+		entries[string(indexEntry(nameField, meta.Name, k))] = struct{}{}
+	}
+	if indexed := tx.Bucket(indexedMetaBucket); indexed != nil {
+		for key, v := range meta.UserMeta {
+			if indexed.Get([]byte(key)) != nil {
+				entries[string(indexEntry(metaFieldPrefix+key, v, k))] = struct{}{}
+			}
+		}
+	}
+	return entries
+}
+
+// reindex replaces index keys of the previous state of the entry with the ones of the next state.
+// The index may keep keys of stale states of entries present in multiple journals, so queries
+// check the entries they find.
+func reindex(tx *bolt.Tx, k string, prev, next *FileMeta) error {
+	prevEntries := indexEntries(tx, k, prev)
+	nextEntries := indexEntries(tx, k, next)
+	if len(prevEntries) == 0 && len(nextEntries) == 0 {
+		return nil
+	}
+	ns, _ := SplitID(k)
+	index, err := tx.CreateBucketIfNotExists(indexBucketOf(ns))
+	if err != nil {
+		return err
+	}
+	for entry := range prevEntries {
+		if _, ok := nextEntries[entry]; ok {
+			continue
+		}
+		if err := index.Delete([]byte(entry)); err != nil {
+			return err
+		}
+	}
+	for entry := range nextEntries {
+		if err := index.Put([]byte(entry), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetIndexedMeta sets user meta keys to index, if the keys differ from the ones indexed
+// before, indexes of all namespaces are rebuilt from journals.
+func (kv *kvJournalManager) SetIndexedMeta(keys []string) error {
+	return kv.db.Update(func(tx *bolt.Tx) error {
+		if indexed := tx.Bucket(indexedMetaBucket); indexed != nil {
+			var prev []string
+			indexed.ForEach(func(k, _ []byte) error {
+				prev = append(prev, string(k))
+				return nil
+			})
+			if sameKeys(prev, keys) {
+				return nil
+			}
+			if err := tx.DeleteBucket(indexedMetaBucket); err != nil {
+				return err
+			}
+		}
+		indexed, err := tx.CreateBucket(indexedMetaBucket)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := indexed.Put([]byte(key), []byte{1}); err != nil {
+				return err
+			}
+		}
+		return rebuildIndex(tx)
+	})
+}
+
+func sameKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// rebuildIndex drops indexes of all namespaces and indexes entries of all journals again.
+func rebuildIndex(tx *bolt.Tx) error {
+	var stale [][]byte
+	tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		if isIndexBucket(name) {
+			stale = append(stale, append([]byte(nil), name...))
+		}
+		return nil
+	})
+	for _, name := range stale {
+		if err := tx.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+	journals := tx.Bucket(journalsBucket)
+	if journals == nil {
+		return nil
+	}
+	cur := journals.Cursor()
+	for id, _ := cur.First(); id != nil; id, _ = cur.Next() {
+		if _, err := NewJournal(ID(id), tx, journals.Bucket(id)).Range("", 0, func(k string, v *FileMeta) error {
+			return reindex(tx, k, nil, v)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query selects live entries by the prefix of names and exact values of user meta.
+type Query struct {
+	NamePrefix string
+	Meta       map[string]string
+}
+
+func (q *Query) Match(meta *FileMeta) bool {
+	if meta == nil || meta.IsDeleted || !strings.HasPrefix(meta.Name, q.NamePrefix) {
+		return false
+	}
+	for k, v := range q.Meta {
+		if value, ok := meta.UserMeta[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Query lists live entries of the namespace matching the query, in the order of the index used.
+// The index of the first indexed user meta key of the query is used, otherwise the name index,
+// returns ErrNotIndexed if none of them applies. Only entries following after the cursor are listed,
+// at most limit entries if limit is positive. Returns the cursor to continue after, if there are more entries.
+func (kv *kvJournalManager) Query(ns string, q *Query, after string, limit int) (FileMetaList, string, error) {
+	var list FileMetaList
+	var last, next string
+	err := kv.db.View(func(tx *bolt.Tx) error {
+		var prefix []byte
+		if indexed := tx.Bucket(indexedMetaBucket); indexed != nil {
+			keys := make([]string, 0, len(q.Meta))
+			for k := range q.Meta {
+				if indexed.Get([]byte(k)) != nil {
+					keys = append(keys, k)
+				}
+			}
+			if len(keys) > 0 {
+				sort.Strings(keys)
+				prefix = indexEntry(metaFieldPrefix+keys[0], q.Meta[keys[0]], "")
+			}
+		}
+		if prefix == nil {
+			if len(q.NamePrefix) == 0 {
+				return ErrNotIndexed
+			}
+			prefix = []byte(nameField + "\x00" + q.NamePrefix)
+		}
+		index := tx.Bucket(indexBucketOf(ns))
+		if index == nil {
+			return nil
+		}
+		journals := tx.Bucket(journalsBucket)
+		cur := index.Cursor()
+		seek := prefix
+		if after > string(prefix) {
+			seek = []byte(after)
+		}
+		for k, _ := cur.Seek(seek); k != nil; k, _ = cur.Next() {
+			if !bytes.HasPrefix(k, prefix) {
+				return nil
+			} else if string(k) <= after {
+				continue
+			}
+			id := string(k[bytes.LastIndexByte(k, 0)+1:])
+			meta := lookup(journals, []byte(id))
+			// skip keys of stale states of entries
+			if _, ok := indexEntries(tx, id, meta)[string(k)]; !ok || !q.Match(meta) {
+				continue
+			}
+			if limit > 0 && len(list) >= limit {
+				next = last
+				return nil
+			}
+			list = append(list, meta)
+			last = string(k)
+		}
+		return nil
+	})
+	return list, next, err
+}
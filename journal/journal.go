@@ -7,7 +7,6 @@ package journal
 import (
 	"errors"
 	"fmt"
-	"io"
 	"strings"
 	"sync"
 	"time"
@@ -22,7 +21,9 @@ type Journal interface {
 	Exists(k string) bool
 	Set(k string, m *FileMeta) error
 	Delete(k string) error
-	Diff(j Journal) (added FileMetaList, deleted FileMetaList)
+	// Diff compares the journal with the next state, returns entries present only in the next journal,
+	// entries missing in the next journal, and entries present in both but having different meta.
+	Diff(j Journal) (added, deleted FileMetaList, changed FileMetaChangeList)
 	Range(start string, limit int, fn func(k string, v *FileMeta) error) (string, error)
 	Join(target Journal, mapping Mapping) error
 	List() FileMetaList
@@ -202,341 +203,35 @@ func (b *btreeJournal) List() FileMetaList {
 	return list
 }
 
-func (prev *btreeJournal) Diff(next Journal) (added FileMetaList, deleted FileMetaList) {
-	switch next := next.(type) {
-	case *btreeJournal:
-		prev.mux.Lock()
-		if prev.closed {
-			prev.mux.Unlock()
-			return nil, nil
-		}
-		prevIter, prevErr := prev.t.SeekFirst()
-		prev.mux.Unlock()
-		if prevErr == nil {
-			defer prevIter.Close()
-		}
-		next.mux.Lock()
-		if next.closed {
-			next.mux.Unlock()
-			return nil, nil
-		}
-		nextIter, nextErr := next.t.SeekFirst()
-		next.mux.Unlock()
-		if nextErr == nil {
-			defer nextIter.Close()
-		}
+func (prev *btreeJournal) Diff(next Journal) (added, deleted FileMetaList, changed FileMetaChangeList) {
+	return diff(prev.iter(), iterOf(next))
+}
 
-		switch {
-		case prevErr == io.EOF && nextErr == io.EOF:
-			return nil, nil
-		case prevErr == io.EOF:
-			// all added
-			return next.List(), nil
-		case nextErr == io.EOF:
-			// all deleted
-			return nil, prev.List()
-		default:
-			prev.mux.Lock()
-			prevK, prevV, prevErr := prevIter.Next()
-			prev.mux.Unlock()
-			next.mux.Lock()
-			nextK, nextV, nextErr := nextIter.Next()
-			next.mux.Unlock()
-
-			for {
-				switch {
-				case prevErr == io.EOF:
-					if nextErr == io.EOF {
-						// done
-						return
-					}
-					added = append(added, nextV.(*FileMeta))
-					// move next iterator
-					next.mux.Lock()
-					nextK, nextV, nextErr = nextIter.Next()
-					next.mux.Unlock()
-				case nextErr == io.EOF:
-					if prevErr == io.EOF {
-						// done
-						return
-					}
-					deleted = append(deleted, prevV.(*FileMeta))
-					// move prev iterator
-					prev.mux.Lock()
-					prevK, prevV, prevErr = prevIter.Next()
-					prev.mux.Unlock()
-				default:
-					prevCmp := strings.Compare(prevK.(string), nextK.(string))
-					switch {
-					case prevCmp < 0: // nextK > prevK
-						// prevK has been deleted
-						deleted = append(deleted, prevV.(*FileMeta))
-						// advance prev iter
-						prev.mux.Lock()
-						prevK, prevV, prevErr = prevIter.Next()
-						prev.mux.Unlock()
-					case prevCmp > 0: // nextK < prevK
-						// nextK has been insterted
-						added = append(added, nextV.(*FileMeta))
-						// advance next iter
-						next.mux.Lock()
-						nextK, nextV, nextErr = nextIter.Next()
-						next.mux.Unlock()
-					default:
-						// same key -> advance iterators
-						prev.mux.Lock()
-						prevK, prevV, prevErr = prevIter.Next()
-						prev.mux.Unlock()
-						next.mux.Lock()
-						nextK, nextV, nextErr = nextIter.Next()
-						next.mux.Unlock()
-					}
-				}
-			}
-		}
-	case *kvJournal:
-		prev.mux.Lock()
-		if prev.closed {
-			prev.mux.Unlock()
-			return nil, nil
-		}
-		prevIter, prevErr := prev.t.SeekFirst()
-		prev.mux.Unlock()
-		if prevErr == nil {
-			defer prevIter.Close()
-		}
-		nextIter := next.b.Cursor()
-
-		switch {
-		case prevErr == io.EOF && nextIter == nil:
-			return nil, nil
-		case prevErr == io.EOF:
-			// all added
-			return next.List(), nil
-		case nextIter == nil:
-			// all deleted
-			return nil, prev.List()
-		default:
-			prev.mux.Lock()
-			prevK, prevV, prevErr := prevIter.Next()
-			prev.mux.Unlock()
-			nextK, nextV := nextIter.Next()
-
-			for {
-				switch {
-				case prevErr == io.EOF:
-					if nextK == nil {
-						// done
-						return
-					}
-					if nextV != nil {
-						meta := new(FileMeta)
-						meta.UnmarshalMsg(nextV)
-						added = append(added, meta)
-					}
-					// move next iterator
-					nextK, nextV = nextIter.Next()
-				case nextK == nil:
-					if prevErr == io.EOF {
-						// done
-						return
-					}
-					deleted = append(deleted, prevV.(*FileMeta))
-					// move prev iterator
-					prev.mux.Lock()
-					prevK, prevV, prevErr = prevIter.Next()
-					prev.mux.Unlock()
-				default:
-					prevCmp := strings.Compare(prevK.(string), string(nextK))
-					switch {
-					case prevCmp < 0: // nextK > prevK
-						// prevK has been deleted
-						deleted = append(deleted, prevV.(*FileMeta))
-						// advance prev iter
-						prev.mux.Lock()
-						prevK, prevV, prevErr = prevIter.Next()
-						prev.mux.Unlock()
-					case prevCmp > 0: // nextK < prevK
-						// nextK has been insterted
-						if nextV != nil {
-							meta := new(FileMeta)
-							meta.UnmarshalMsg(nextV)
-							added = append(added, meta)
-						}
-						// advance next iter
-						nextK, nextV = nextIter.Next()
-					default:
-						// same key -> advance iterators
-						prev.mux.Lock()
-						prevK, prevV, prevErr = prevIter.Next()
-						prev.mux.Unlock()
-						nextK, nextV = nextIter.Next()
-					}
-				}
-			}
-		}
-	default:
-		panic("indifferentiable types")
+// iter returns an iterator over the journal entries in key order.
+func (b *btreeJournal) iter() metaIter {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.closed {
+		return emptyIter{}
+	}
+	enum, err := b.t.SeekFirst()
+	if err != nil {
+		return emptyIter{}
+	}
+	return &btreeIter{
+		mux:  b.mux,
+		enum: enum,
 	}
 }
 
-func (prev *kvJournal) Diff(next Journal) (added FileMetaList, deleted FileMetaList) {
-	switch next := next.(type) {
-	case *kvJournal:
-		prevIter := prev.b.Cursor()
-		nextIter := next.b.Cursor()
-
-		switch {
-		case prevIter == nil && nextIter == nil:
-			return nil, nil
-		case prevIter == nil:
-			// all added
-			return next.List(), nil
-		case nextIter == nil:
-			// all deleted
-			return nil, prev.List()
-		default:
-			prevK, prevV := prevIter.Next()
-			nextK, nextV := nextIter.Next()
-
-			for {
-				switch {
-				case prevK == nil:
-					if nextK == nil {
-						// done
-						return
-					}
-					if nextV != nil {
-						meta := new(FileMeta)
-						meta.UnmarshalMsg(nextV)
-						added = append(added, meta)
-					}
-					// move next iterator
-					nextK, nextV = nextIter.Next()
-				case nextK == nil:
-					if prevK == nil {
-						// done
-						return
-					}
-					if prevV != nil {
-						meta := new(FileMeta)
-						meta.UnmarshalMsg(prevV)
-						deleted = append(deleted, meta)
-					}
-					// move prev iterator
-					prevK, prevV = prevIter.Next()
-				default:
-					prevCmp := strings.Compare(string(prevK), string(nextK))
-					switch {
-					case prevCmp < 0: // nextK > prevK
-						// prevK has been deleted
-						if prevV != nil {
-							meta := new(FileMeta)
-							meta.UnmarshalMsg(prevV)
-							deleted = append(deleted, meta)
-						}
-						// advance prev iter
-						prevK, prevV = prevIter.Next()
-					case prevCmp > 0: // nextK < prevK
-						// nextK has been insterted
-						if nextV != nil {
-							meta := new(FileMeta)
-							meta.UnmarshalMsg(nextV)
-							added = append(added, meta)
-						}
-						// advance next iter
-						nextK, nextV = nextIter.Next()
-					default:
-						// same key -> advance iterators
-						prevK, prevV = prevIter.Next()
-						nextK, nextV = nextIter.Next()
-					}
-				}
-			}
-		}
-	case *btreeJournal:
-		next.mux.Lock()
-		if next.closed {
-			next.mux.Unlock()
-			return nil, nil
-		}
-		nextIter, nextErr := next.t.SeekFirst()
-		next.mux.Unlock()
-		if nextErr == nil {
-			defer nextIter.Close()
-		}
-		prevIter := prev.b.Cursor()
-
-		switch {
-		case nextErr == io.EOF && prevIter == nil:
-			return nil, nil
-		case nextErr == io.EOF:
-			// all added
-			return prev.List(), nil
-		case prevIter == nil:
-			// all deleted
-			return nil, next.List()
-		default:
-			next.mux.Lock()
-			nextK, nextV, nextErr := nextIter.Next()
-			next.mux.Unlock()
-			prevK, prevV := prevIter.Next()
-
-			for {
-				switch {
-				case nextErr == io.EOF:
-					if prevK == nil {
-						// done
-						return
-					}
-					if prevV != nil {
-						meta := new(FileMeta)
-						meta.UnmarshalMsg(prevV)
-						added = append(added, meta)
-					}
-					// move prev iterator
-					prevK, prevV = prevIter.Next()
-				case prevK == nil:
-					if nextErr == io.EOF {
-						// done
-						return
-					}
-					deleted = append(deleted, nextV.(*FileMeta))
-					// move next iterator
-					next.mux.Lock()
-					nextK, nextV, nextErr = nextIter.Next()
-					next.mux.Unlock()
-				default:
-					nextCmp := strings.Compare(nextK.(string), string(prevK))
-					switch {
-					case nextCmp < 0: // prevK > nextK
-						// nextK has been deleted
-						deleted = append(deleted, nextV.(*FileMeta))
-						// advance next iter
-						next.mux.Lock()
-						nextK, nextV, nextErr = nextIter.Next()
-						next.mux.Unlock()
-					case nextCmp > 0: // prevK < nextK
-						// prevK has been insterted
-						if prevV != nil {
-							meta := new(FileMeta)
-							meta.UnmarshalMsg(prevV)
-							added = append(added, meta)
-						}
-						// advance prev iter
-						prevK, prevV = prevIter.Next()
-					default:
-						// same key -> advance iterators
-						next.mux.Lock()
-						nextK, nextV, nextErr = nextIter.Next()
-						next.mux.Unlock()
-						prevK, prevV = prevIter.Next()
-					}
-				}
-			}
-		}
-	default:
-		panic("journal: indifferentiable types")
+func (prev *kvJournal) Diff(next Journal) (added, deleted FileMetaList, changed FileMetaChangeList) {
+	return diff(prev.iter(), iterOf(next))
+}
+
+// iter returns an iterator over the journal entries in key order.
+func (j *kvJournal) iter() metaIter {
+	return &kvIter{
+		cur: j.b.Cursor(),
 	}
 }
 
@@ -618,11 +313,39 @@ func (j *kvJournal) Set(k string, m *FileMeta) error {
 	if err != nil {
 		return err
 	}
-	return j.b.Put([]byte(k), v)
+	prev := j.Get(k)
+	if err := j.b.Put([]byte(k), v); err != nil {
+		return err
+	}
+	if err := indexKey(j.tx, k, m); err != nil {
+		return err
+	}
+	if err := reindex(j.tx, k, prev, m); err != nil {
+		return err
+	}
+	return recordChange(j.tx, k)
 }
 
 func (j *kvJournal) Delete(k string) error {
-	return j.b.Delete([]byte(k))
+	var prev *FileMeta
+	if v := j.b.Get([]byte(k)); v != nil {
+		prev = new(FileMeta)
+		prev.UnmarshalMsg(v)
+	}
+	if err := j.b.Delete([]byte(k)); err != nil {
+		return err
+	}
+	if prev != nil {
+		if err := unindexKey(j.tx, k, prev); err != nil {
+			return err
+		}
+		// the entry may be still present in other journals
+		next := lookup(j.tx.Bucket(journalsBucket), []byte(k))
+		if err := reindex(j.tx, k, prev, next); err != nil {
+			return err
+		}
+	}
+	return recordChange(j.tx, k)
 }
 
 func (j *kvJournal) List() FileMetaList {
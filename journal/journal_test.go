@@ -1,8 +1,13 @@
 package journal
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/boltdb/bolt"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -11,18 +16,280 @@ var noID ID
 func TestBtreeDiffBtree(t *testing.T) {
 	assert := assert.New(t)
 
-	j1 := MakeJournal(noID, []*Meta{
+	j1 := MakeJournal(noID, []*FileMeta{
 		{ID: "000"}, {ID: "001"}, {ID: "002"}, {ID: "003"}, {ID: "005"},
 	})
-	j2 := MakeJournal(noID, []*Meta{
+	j2 := MakeJournal(noID, []*FileMeta{
 		{ID: "000"}, {ID: "002"}, {ID: "003"}, {ID: "004"}, {ID: "005"},
 	})
 
-	added, deleted := j1.Diff(j2)
-	assert.Equal([]*Meta{{ID: "004"}}, added)
-	assert.Equal([]*Meta{{ID: "001"}}, deleted)
+	added, deleted, changed := j1.Diff(j2)
+	assert.Equal(FileMetaList{{ID: "004"}}, added)
+	assert.Equal(FileMetaList{{ID: "001"}}, deleted)
+	assert.Empty(changed)
 
-	added, deleted = j1.Diff(j1)
+	added, deleted, changed = j1.Diff(j1)
 	assert.Empty(added)
 	assert.Empty(deleted)
+	assert.Empty(changed)
+}
+
+func TestBtreeDiffChanged(t *testing.T) {
+	assert := assert.New(t)
+
+	j1 := MakeJournal(noID, []*FileMeta{
+		{ID: "000"}, {ID: "001", Name: "a"}, {ID: "002"}, {ID: "003", IsSymlink: true},
+	})
+	j2 := MakeJournal(noID, []*FileMeta{
+		{ID: "000", IsDeleted: true}, {ID: "001", Name: "b"}, {ID: "002"}, {ID: "003"},
+	})
+
+	added, deleted, changed := j1.Diff(j2)
+	assert.Empty(added)
+	assert.Empty(deleted)
+	assert.Equal(FileMetaChangeList{
+		{Prev: &FileMeta{ID: "000"}, Next: &FileMeta{ID: "000", IsDeleted: true}},
+		{Prev: &FileMeta{ID: "001", Name: "a"}, Next: &FileMeta{ID: "001", Name: "b"}},
+	}, changed)
+}
+
+func TestKVDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "state.db"), 0600, nil)
+	assert.NoError(err)
+	defer db.Close()
+
+	manager := NewJournalManager(db)
+	assert.NoError(manager.Create("kv"))
+	assert.NoError(manager.Update("kv", func(j Journal, _ *JournalMeta) error {
+		for _, meta := range []*FileMeta{
+			{ID: "000"}, {ID: "001"}, {ID: "002", Replicas: 2}, {ID: "003"},
+		} {
+			if err := j.Set(meta.ID, meta); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	btree := MakeJournal(noID, []*FileMeta{
+		{ID: "000"}, {ID: "002", Replicas: 3}, {ID: "003"}, {ID: "004"},
+	})
+
+	assert.NoError(manager.View("kv", func(kv Journal, _ *JournalMeta) error {
+		added, deleted, changed := kv.Diff(btree)
+		assert.Equal(FileMetaList{{ID: "004"}}, added)
+		assert.Equal(FileMetaList{{ID: "001"}}, deleted)
+		assert.Equal(FileMetaChangeList{
+			{Prev: &FileMeta{ID: "002", Replicas: 2}, Next: &FileMeta{ID: "002", Replicas: 3}},
+		}, changed)
+
+		added, deleted, changed = btree.Diff(kv)
+		assert.Equal(FileMetaList{{ID: "001"}}, added)
+		assert.Equal(FileMetaList{{ID: "004"}}, deleted)
+		assert.Len(changed, 1)
+
+		added, deleted, changed = kv.Diff(kv)
+		assert.Empty(added)
+		assert.Empty(deleted)
+		assert.Empty(changed)
+		return nil
+	}))
+}
+
+func TestKVKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "state.db"), 0600, nil)
+	assert.NoError(err)
+	defer db.Close()
+
+	manager := NewJournalManager(db)
+	assert.NoError(manager.Create("kv"))
+	assert.NoError(manager.Update("kv", func(j Journal, _ *JournalMeta) error {
+		for _, meta := range []*FileMeta{
+			{ID: "000", Key: "a/1", Clock: 1}, {ID: "001", Key: "a/2", Clock: 1},
+			{ID: "002", Key: "b/1", Clock: 1}, {ID: "003", Key: "a/1", Clock: 2},
+			{ID: "004", Key: "a/1", Clock: 1},
+		} {
+			if err := j.Set(meta.ID, meta); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	meta, err := manager.LookupKey("", "a/1")
+	assert.NoError(err)
+	assert.Equal("003", meta.ID)
+	list, err := manager.ListKeys("", "a/", "", 0)
+	assert.NoError(err)
+	assert.Len(list, 2)
+	list, err = manager.ListKeys("", "a/", "a/1", 0)
+	assert.NoError(err)
+	assert.Equal(FileMetaList{{ID: "001", Key: "a/2", Clock: 1}}, list)
+
+	assert.NoError(manager.Update("kv", func(j Journal, _ *JournalMeta) error {
+		if err := j.Set("003", &FileMeta{ID: "003", Key: "a/1", Clock: 3, IsDeleted: true}); err != nil {
+			return err
+		}
+		return j.Delete("001")
+	}))
+	meta, err = manager.LookupKey("", "a/1")
+	assert.NoError(err)
+	assert.Nil(meta)
+	list, err = manager.ListKeys("", "", "", 0)
+	assert.NoError(err)
+	assert.Equal(FileMetaList{{ID: "002", Key: "b/1", Clock: 1}}, list)
+}
+
+func TestKVQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "state.db"), 0600, nil)
+	assert.NoError(err)
+	defer db.Close()
+
+	manager := NewJournalManager(db)
+	assert.NoError(manager.Create("kv"))
+	assert.NoError(manager.Update("kv", func(j Journal, _ *JournalMeta) error {
+		for _, meta := range []*FileMeta{
+			{ID: "000", Name: "a.txt", UserMeta: map[string]string{"project": "x"}},
+			{ID: "001", Name: "b.txt", UserMeta: map[string]string{"project": "x"}},
+			{ID: "002", Name: "a.png", UserMeta: map[string]string{"project": "y"}},
+		} {
+			if err := j.Set(meta.ID, meta); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	_, _, err = manager.Query("", &Query{Meta: map[string]string{"project": "x"}}, "", 0)
+	assert.Equal(ErrNotIndexed, err)
+	assert.NoError(manager.SetIndexedMeta([]string{"project"}))
+
+	list, next, err := manager.Query("", &Query{Meta: map[string]string{"project": "x"}}, "", 1)
+	assert.NoError(err)
+	assert.Len(list, 1)
+	assert.Equal("000", list[0].ID)
+	list, next, err = manager.Query("", &Query{Meta: map[string]string{"project": "x"}}, next, 1)
+	assert.NoError(err)
+	assert.Len(list, 1)
+	assert.Equal("001", list[0].ID)
+	assert.Empty(next)
+
+	list, _, err = manager.Query("", &Query{NamePrefix: "a.", Meta: map[string]string{"project": "y"}}, "", 0)
+	assert.NoError(err)
+	assert.Len(list, 1)
+	assert.Equal("002", list[0].ID)
+
+	assert.NoError(manager.Update("kv", func(j Journal, _ *JournalMeta) error {
+		if err := j.Set("000", &FileMeta{ID: "000", Name: "c.txt"}); err != nil {
+			return err
+		}
+		return j.Delete("002")
+	}))
+	list, _, err = manager.Query("", &Query{NamePrefix: "a."}, "", 0)
+	assert.NoError(err)
+	assert.Empty(list)
+	list, _, err = manager.Query("", &Query{Meta: map[string]string{"project": "x"}}, "", 0)
+	assert.NoError(err)
+	assert.Len(list, 1)
+	assert.Equal("001", list[0].ID)
+}
+
+func TestKVHashRanges(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "state.db"), 0600, nil)
+	assert.NoError(err)
+	defer db.Close()
+
+	manager := NewJournalManager(db)
+	assert.NoError(manager.Create("a"))
+	assert.NoError(manager.Create("b"))
+	assert.NoError(manager.Update("a", func(j Journal, _ *JournalMeta) error {
+		// more entries than a page read at once
+		for i := 0; i < 600; i++ {
+			id := fmt.Sprintf("%04d", i)
+			if err := j.Set(id, &FileMeta{ID: id, Clock: 1}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	assert.NoError(manager.Update("b", func(j Journal, _ *JournalMeta) error {
+		return j.Set("0001", &FileMeta{ID: "0001", Clock: 2})
+	}))
+
+	list, err := manager.ExportRanges([]string{"000"})
+	assert.NoError(err)
+	assert.Len(list, 10)
+	assert.Equal(HLC(2), list[1].Clock)
+	list, err = manager.ExportRanges([]string{""})
+	assert.NoError(err)
+	assert.Len(list, 600)
+
+	ranges, err := manager.HashRanges([]string{"000"})
+	assert.NoError(err)
+	assert.Len(ranges["000"], 10)
+	hash := ranges["000"][1].Hash
+	assert.NoError(manager.Update("b", func(j Journal, _ *JournalMeta) error {
+		return j.Set("0001", &FileMeta{ID: "0001", Clock: 3})
+	}))
+	ranges, err = manager.HashRanges([]string{"000"})
+	assert.NoError(err)
+	assert.NotEqual(hash, ranges["000"][1].Hash)
+}
+
+func TestKVRangeMerged(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "state.db"), 0600, nil)
+	assert.NoError(err)
+	defer db.Close()
+
+	manager := NewJournalManager(db)
+	assert.NoError(manager.Create("a"))
+	assert.NoError(manager.Create("b"))
+	assert.NoError(manager.Update("a", func(j Journal, _ *JournalMeta) error {
+		j.Set("001", &FileMeta{ID: "001", Clock: 1})
+		return j.Set("002", &FileMeta{ID: "002", Clock: 1})
+	}))
+	assert.NoError(manager.Update("b", func(j Journal, _ *JournalMeta) error {
+		return j.Set("001", &FileMeta{ID: "001", Clock: 2, IsDeleted: true})
+	}))
+
+	var list FileMetaList
+	assert.NoError(manager.RangeMerged("001", func(_ string, meta *FileMeta) error {
+		list = append(list, meta)
+		return nil
+	}))
+	assert.Len(list, 2)
+	assert.True(list[0].IsDeleted)
+	assert.False(list[1].IsDeleted)
+
+	list = nil
+	assert.NoError(manager.RangeMerged("002", func(_ string, meta *FileMeta) error {
+		list = append(list, meta)
+		return ErrRangeStop
+	}))
+	assert.Len(list, 1)
+	assert.Equal("002", list[0].ID)
 }
@@ -0,0 +1,116 @@
+package journal
+
+import (
+	"bytes"
+
+	"github.com/boltdb/bolt"
+)
+
+// keysBucket maps object keys chosen by clients to IDs of the entries, it's derived from
+// journals and updated along with them, so the mapping is replicated with journal entries.
+// Keys of each namespace are mapped in a separate bucket.
+var keysBucket = []byte("keys")
+
+func keysBucketOf(ns string) []byte {
+	if len(ns) == 0 {
+		return keysBucket
+	}
+	return []byte(string(keysBucket) + NamespaceSeparator + ns)
+}
+
+// indexKey maps the object key of the entry to its ID, keys of deleted entries are unmapped.
+// If the key is mapped to another live entry that supersedes this one, the mapping is kept.
+func indexKey(tx *bolt.Tx, k string, meta *FileMeta) error {
+	if len(meta.Key) == 0 {
+		return nil
+	}
+	ns, _ := SplitID(k)
+	keys, err := tx.CreateBucketIfNotExists(keysBucketOf(ns))
+	if err != nil {
+		return err
+	}
+	prev := keys.Get([]byte(meta.Key))
+	if meta.IsDeleted {
+		if string(prev) == k {
+			return keys.Delete([]byte(meta.Key))
+		}
+		return nil
+	}
+	if prev != nil && string(prev) != k {
+		other := lookup(tx.Bucket(journalsBucket), prev)
+		if other != nil && !other.IsDeleted && other.Supersedes(meta) {
+			return nil
+		}
+	}
+	return keys.Put([]byte(meta.Key), []byte(k))
+}
+
+// unindexKey unmaps the object key of the entry once it's deleted from all journals.
+func unindexKey(tx *bolt.Tx, k string, meta *FileMeta) error {
+	if len(meta.Key) == 0 {
+		return nil
+	}
+	ns, _ := SplitID(k)
+	keys := tx.Bucket(keysBucketOf(ns))
+	if keys == nil || string(keys.Get([]byte(meta.Key))) != k {
+		return nil
+	}
+	if lookup(tx.Bucket(journalsBucket), []byte(k)) != nil {
+		return nil
+	}
+	return keys.Delete([]byte(meta.Key))
+}
+
+// LookupKey finds the live entry mapped to the object key in the namespace, returns nil if there is none.
+func (kv *kvJournalManager) LookupKey(ns, key string) (*FileMeta, error) {
+	var meta *FileMeta
+	err := kv.db.View(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(keysBucketOf(ns))
+		if keys == nil {
+			return nil
+		}
+		if id := keys.Get([]byte(key)); id != nil {
+			meta = lookup(tx.Bucket(journalsBucket), id)
+		}
+		return nil
+	})
+	if meta != nil && meta.IsDeleted {
+		return nil, err
+	}
+	return meta, err
+}
+
+// ListKeys lists live entries of the namespace with object keys having the prefix, in key order.
+// Only keys following after are listed, at most limit entries if limit is positive.
+func (kv *kvJournalManager) ListKeys(ns, prefix, after string, limit int) (FileMetaList, error) {
+	var list FileMetaList
+	err := kv.db.View(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(keysBucketOf(ns))
+		if keys == nil {
+			return nil
+		}
+		journals := tx.Bucket(journalsBucket)
+		cur := keys.Cursor()
+		seek := []byte(prefix)
+		if after > prefix {
+			seek = []byte(after)
+		}
+		for k, id := cur.Seek(seek); k != nil; k, id = cur.Next() {
+			if !bytes.HasPrefix(k, []byte(prefix)) {
+				return nil
+			} else if string(k) <= after {
+				continue
+			}
+			meta := lookup(journals, id)
+			if meta == nil || meta.IsDeleted {
+				continue
+			}
+			list = append(list, meta)
+			if limit > 0 && len(list) >= limit {
+				return nil
+			}
+		}
+		return nil
+	})
+	return list, err
+}
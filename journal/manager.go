@@ -16,10 +16,43 @@ type JournalManager interface {
 
 	ForEach(fn JournalIter) error
 	ForEachUpdate(fn JournalIter) error
+	// UpdateAll calls fn with all journals within one write transaction, so entries can be
+	// compared across journals before any of them is changed.
+	UpdateAll(fn func(journals []Journal) error) error
 
 	JoinAll(target ID) (*JournalMeta, error)
 	ListAll() ([]*JournalMeta, error)
 	ExportAll() (FileMetaList, error)
+	// ExportEach and ExportAfter export entries of all journals in key order without
+	// materialising them all in memory, entries present in multiple journals are exported once.
+	ExportEach(fn func(meta *FileMeta) error) error
+	ExportAfter(after string, limit int) (FileMetaList, error)
+	// RangeMerged ranges over entries of all journals in key order starting from the seek key,
+	// entries present in multiple journals are merged into the superseding one.
+	RangeMerged(seek string, fn func(k string, meta *FileMeta) error) error
+	// DiffChunk compares a chunk of an external journal with entries of all journals.
+	DiffChunk(after string, list FileMetaList, last bool, limit int) (*ChunkDiff, error)
+	// LookupKey and ListKeys find live entries of a namespace by object keys chosen by clients.
+	LookupKey(ns, key string) (*FileMeta, error)
+	ListKeys(ns, prefix, after string, limit int) (FileMetaList, error)
+	// SetIndexedMeta and Query maintain and use secondary indexes over names and user meta.
+	SetIndexedMeta(keys []string) error
+	Query(ns string, q *Query, after string, limit int) (FileMetaList, string, error)
+
+	// HashRanges and ExportRanges expose the Merkle tree over journal keys for anti-entropy.
+	HashRanges(prefixes []string) (map[string][]*RangeHash, error)
+	ExportRanges(prefixes []string) (FileMetaList, error)
+
+	// Epoch, Changes and watermarks support incremental sync using the change log.
+	Epoch() (string, error)
+	Changes(since uint64, limit int) (list FileMetaList, next uint64, more bool, err error)
+	Watermarks() (map[string]uint64, error)
+	SetWatermark(epoch string, seq uint64) error
+	LastSync() (int64, error)
+	SetLastSync(ts int64) error
+
+	// PurgeDeleted deletes entries of deleted objects older than the specified timestamp from all journals.
+	PurgeDeleted(before HLC) (int, error)
 
 	Close() error
 }
@@ -244,6 +277,20 @@ func (kv *kvJournalManager) ForEachUpdate(fn JournalIter) error {
 	})
 }
 
+func (kv *kvJournalManager) UpdateAll(fn func(journals []Journal) error) error {
+	return kv.db.Update(func(tx *bolt.Tx) error {
+		var list []Journal
+		journals := tx.Bucket(journalsBucket)
+		cur := journals.Cursor()
+		for id, _ := cur.First(); id != nil; id, _ = cur.Next() {
+			if b := journals.Bucket(id); b != nil {
+				list = append(list, NewJournal(ID(id), tx, b))
+			}
+		}
+		return fn(list)
+	})
+}
+
 func (kv *kvJournalManager) ExportAll() (FileMetaList, error) {
 	var list FileMetaList
 	err := kv.db.View(func(tx *bolt.Tx) error {
@@ -260,6 +307,40 @@ func (kv *kvJournalManager) ExportAll() (FileMetaList, error) {
 	return list, err
 }
 
+func (kv *kvJournalManager) PurgeDeleted(before HLC) (int, error) {
+	var purged int
+	err := kv.db.Update(func(tx *bolt.Tx) error {
+		journals := tx.Bucket(journalsBucket)
+		cur := journals.Cursor()
+		id, _ := cur.First()
+		for id != nil {
+			journal := NewJournal(ID(id), tx, journals.Bucket(id))
+			var keys []string
+			if _, err := journal.Range("", 0, func(k string, v *FileMeta) error {
+				if v != nil && v.IsDeleted && v.Version() < before {
+					keys = append(keys, k)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			for _, k := range keys {
+				if err := journals.Bucket(id).Delete([]byte(k)); err != nil {
+					return err
+				}
+				// peers purge their tombstones independently
+				if err := forgetChange(tx, k); err != nil {
+					return err
+				}
+			}
+			purged += len(keys)
+			id, _ = cur.Next()
+		}
+		return nil
+	})
+	return purged, err
+}
+
 func (kv *kvJournalManager) Close() error {
 	return kv.db.Close()
 }
@@ -0,0 +1,212 @@
+package journal
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"hash"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// HashRanges computes the hashes of child ranges for each of the specified prefixes,
+// all journals are merged as one keyspace. Only non-empty ranges are returned.
+func (kv *kvJournalManager) HashRanges(prefixes []string) (map[string][]*RangeHash, error) {
+	ranges := make(map[string][]*RangeHash, len(prefixes))
+	err := kv.viewJournals(func(journals []Journal) error {
+		for _, prefix := range prefixes {
+			var children []*RangeHash
+			var child *RangeHash
+			var h hash.Hash
+			if err := scanPrefix(journals, prefix, func(k string, meta *FileMeta) error {
+				if len(k) == len(prefix) {
+					// the key equals the prefix, so it belongs to no child range
+					return nil
+				}
+				childPrefix := k[:len(prefix)+1]
+				if child == nil || child.Prefix != childPrefix {
+					if child != nil {
+						child.Hash = h.Sum(nil)
+					}
+					child = &RangeHash{
+						Prefix: childPrefix,
+					}
+					children = append(children, child)
+					h = sha1.New()
+				}
+				child.Count++
+				writeDigest(h, meta)
+				return nil
+			}); err != nil {
+				return err
+			}
+			if child != nil {
+				child.Hash = h.Sum(nil)
+			}
+			ranges[prefix] = children
+		}
+		return nil
+	})
+	return ranges, err
+}
+
+// ExportRanges lists all entries with keys having any of the specified prefixes,
+// all journals are merged as one keyspace.
+func (kv *kvJournalManager) ExportRanges(prefixes []string) (FileMetaList, error) {
+	var list FileMetaList
+	err := kv.viewJournals(func(journals []Journal) error {
+		for _, prefix := range prefixes {
+			if err := scanPrefix(journals, prefix, func(_ string, meta *FileMeta) error {
+				list = append(list, meta)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return list, err
+}
+
+// viewJournals calls fn with all journals within one read transaction.
+func (kv *kvJournalManager) viewJournals(fn func(journals []Journal) error) error {
+	return kv.db.View(func(tx *bolt.Tx) error {
+		var list []Journal
+		journals := tx.Bucket(journalsBucket)
+		cur := journals.Cursor()
+		for id, _ := cur.First(); id != nil; id, _ = cur.Next() {
+			if b := journals.Bucket(id); b != nil {
+				list = append(list, NewJournal(ID(id), tx, b))
+			}
+		}
+		return fn(list)
+	})
+}
+
+// writeDigest writes the fields of entry that must be equal on all nodes, the version
+// covers all changes made in place, e.g. meta data updates.
+func writeDigest(h hash.Hash, meta *FileMeta) {
+	h.Write([]byte(meta.ID))
+	if meta.IsDeleted {
+		h.Write([]byte{0, 1})
+	} else {
+		h.Write([]byte{0, 0})
+	}
+	var version [8]byte
+	binary.BigEndian.PutUint64(version[:], uint64(meta.Version()))
+	h.Write(version[:])
+}
+
+// scanPrefix iterates over entries of all journals with keys having the prefix, in key order.
+// If the same key is present in multiple journals, the entry superseding the others is used.
+func scanPrefix(journals []Journal, prefix string, fn func(k string, meta *FileMeta) error) error {
+	iter := newRangeIter(journals, prefix)
+	for {
+		k, meta, ok := iter.Next()
+		if !ok || !strings.HasPrefix(k, prefix) {
+			return iter.Err()
+		}
+		if err := fn(k, meta); err != nil {
+			return err
+		}
+	}
+}
+
+// rangePageSize is the amount of entries read from a journal at once by rangeIter.
+const rangePageSize = 256
+
+// rangeIter merges entries of journals in key order, starting from the seek key.
+// Journals are read page by page using Journal.Range.
+type rangeIter struct {
+	cursors []*rangeCursor
+}
+
+func newRangeIter(journals []Journal, seek string) *rangeIter {
+	iter := new(rangeIter)
+	for _, j := range journals {
+		iter.cursors = append(iter.cursors, &rangeCursor{
+			j:    j,
+			next: seek,
+		})
+	}
+	return iter
+}
+
+func (it *rangeIter) Next() (string, *FileMeta, bool) {
+	var minK string
+	var found bool
+	for _, cur := range it.cursors {
+		if k, _, ok := cur.peek(); ok && (!found || k < minK) {
+			minK = k
+			found = true
+		}
+	}
+	if !found {
+		return "", nil, false
+	}
+	var meta *FileMeta
+	for _, cur := range it.cursors {
+		if k, m, ok := cur.peek(); ok && k == minK {
+			if meta == nil || m.Supersedes(meta) {
+				meta = m
+			}
+			cur.pos++
+		}
+	}
+	return minK, meta, true
+}
+
+// Err returns the first error that occurred while reading journals.
+func (it *rangeIter) Err() error {
+	for _, cur := range it.cursors {
+		if cur.err != nil {
+			return cur.err
+		}
+	}
+	return nil
+}
+
+type rangeCursor struct {
+	j     Journal
+	keys  []string
+	metas []*FileMeta
+	pos   int
+	// next is the key to read the next page from, it has been read already unless not started.
+	next    string
+	started bool
+	done    bool
+	err     error
+}
+
+func (c *rangeCursor) peek() (string, *FileMeta, bool) {
+	for c.pos >= len(c.keys) {
+		if c.done {
+			return "", nil, false
+		}
+		c.keys, c.metas, c.pos = c.keys[:0], c.metas[:0], 0
+		from, last := c.next, c.next
+		var processed int
+		_, err := c.j.Range(from, rangePageSize, func(k string, v *FileMeta) error {
+			processed++
+			last = k
+			if v == nil || (c.started && k <= from) {
+				// nested buckets and the last key of the previous page
+				return nil
+			}
+			c.keys = append(c.keys, k)
+			c.metas = append(c.metas, v)
+			return nil
+		})
+		if err != nil {
+			c.err = err
+			c.done = true
+			return "", nil, false
+		}
+		if processed < rangePageSize || last == from {
+			c.done = true
+		}
+		c.started = true
+		c.next = last
+	}
+	return c.keys[c.pos], c.metas[c.pos], true
+}
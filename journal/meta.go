@@ -2,6 +2,7 @@ package journal
 
 import (
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -17,6 +18,11 @@ type FileMeta struct {
 	Consistency ConsistencyLevel  `msgp:"6" json:"consistency"`
 	IsDeleted   bool              `msgp:"7" json:"is_deleted"`
 	IsFetched   bool              `msgp:"8" json:"is_fetched"`
+	Replicas    int               `msgp:"9" json:"replicas"`
+	// Clock is the HLC timestamp of the last mutation, used for last-writer-wins.
+	Clock HLC `msgp:"10" json:"clock"`
+	// Key is the object key chosen by the client, e.g. the key of S3 API requests.
+	Key string `msgp:"11" json:"key"`
 }
 
 func (f *FileMeta) Map() map[string]string {
@@ -27,6 +33,16 @@ func (f *FileMeta) Map() map[string]string {
 		"timestamp":   strconv.FormatInt(f.Timestamp, 10),
 		"consistency": strconv.Itoa(int(f.Consistency)),
 	}
+	if f.Replicas > 0 {
+		m["replicas"] = strconv.Itoa(f.Replicas)
+	}
+	if f.Clock > 0 {
+		m["clock"] = strconv.FormatUint(uint64(f.Clock), 10)
+	}
+	if len(f.Key) > 0 {
+		// metadata values must be ASCII
+		m["key"] = url.QueryEscape(f.Key)
+	}
 	for k, v := range f.UserMeta {
 		m["usermeta-"+k] = v
 	}
@@ -53,6 +69,13 @@ func (f *FileMeta) Unmap(m map[string]string) {
 			} else {
 				f.Consistency = (ConsistencyLevel)(level)
 			}
+		case "replicas":
+			f.Replicas, _ = strconv.Atoi(v)
+		case "clock":
+			clock, _ := strconv.ParseUint(v, 10, 64)
+			f.Clock = HLC(clock)
+		case "key":
+			f.Key, _ = url.QueryUnescape(v)
 		default:
 			if !strings.HasPrefix(k, "usermeta-") {
 				continue
@@ -66,6 +89,35 @@ func (f *FileMeta) Unmap(m map[string]string) {
 
 type FileMetaList []*FileMeta
 
+// FileMetaChange is an entry present in both journals, but having different meta.
+type FileMetaChange struct {
+	Prev *FileMeta `msgp:"0" json:"prev"`
+	Next *FileMeta `msgp:"1" json:"next"`
+}
+
+type FileMetaChangeList []*FileMetaChange
+
+// ChunkDiff is the difference between a chunk of an external journal and the local journals.
+type ChunkDiff struct {
+	Added   FileMetaList       `msgp:"0" json:"list_added"`
+	Deleted FileMetaList       `msgp:"1" json:"list_deleted"`
+	Changed FileMetaChangeList `msgp:"2" json:"list_changed"`
+	// Until is the last key compared, if the chunk is not done, the next chunk
+	// must start after this key.
+	Until string `msgp:"3" json:"until"`
+	// Done is set once the whole range of the chunk has been compared.
+	Done bool `msgp:"4" json:"done"`
+}
+
+// RangeHash is a node of the Merkle tree over journal keys, it's a digest
+// of all journal entries with keys sharing the same prefix. Children of a node
+// are ranges with the prefix extended by one more character of the key.
+type RangeHash struct {
+	Prefix string `msgp:"0" json:"prefix"`
+	Hash   []byte `msgp:"1" json:"hash"`
+	Count  int    `msgp:"2" json:"count"`
+}
+
 func (m FileMeta) String() string {
 	if m.IsDeleted {
 		return fmt.Sprintf("%s: %s (deleted)", m.ID, m.Name)
@@ -86,6 +138,63 @@ const (
 	ConsistencyFull ConsistencyLevel = 2
 )
 
+// ReplicationFactor returns the number of nodes chosen by placement to keep the file body. Zero means
+// that the body is kept only by the node that has taken the put, until rebalancing moves it to the most
+// preferred node, unless the file is replicated across all existing nodes, see IsReplicatedFully.
+func (f *FileMeta) ReplicationFactor() int {
+	if f.Replicas > 0 {
+		return f.Replicas
+	}
+	return 0
+}
+
+// IsReplicatedFully reports whether the file body must be kept by all existing nodes,
+// an explicit replication factor overrides the one implied by the full consistency.
+func (f *FileMeta) IsReplicatedFully() bool {
+	return f.Replicas <= 0 && f.Consistency == ConsistencyFull
+}
+
+// Version returns the HLC timestamp of the last mutation. Entries written before
+// HLC timestamps were introduced derive it from the wall-clock timestamp.
+func (f *FileMeta) Version() HLC {
+	if f.Clock > 0 {
+		return f.Clock
+	}
+	return PhysicalHLC(time.Unix(0, f.Timestamp))
+}
+
+// Supersedes reports whether the entry wins over the other one by last-writer-wins.
+// Concurrent mutations with equal timestamps are resolved in favor of deletion.
+func (f *FileMeta) Supersedes(other *FileMeta) bool {
+	if v, otherV := f.Version(), other.Version(); v != otherV {
+		return v > otherV
+	}
+	return f.IsDeleted && !other.IsDeleted
+}
+
+// Equal reports whether both entries describe the same state of the object. The node-local
+// flags IsSymlink and IsFetched are not compared.
+func (f *FileMeta) Equal(other *FileMeta) bool {
+	if f.ID != other.ID || f.Name != other.Name || f.Size != other.Size ||
+		f.Consistency != other.Consistency || f.IsDeleted != other.IsDeleted ||
+		f.Replicas != other.Replicas || f.Version() != other.Version() || f.Key != other.Key {
+		return false
+	}
+	if len(f.UserMeta) != len(other.UserMeta) {
+		return false
+	}
+	for k, v := range f.UserMeta {
+		if otherV, ok := other.UserMeta[k]; !ok || otherV != v {
+			return false
+		}
+	}
+	return true
+}
+
+// HLC is a hybrid logical clock timestamp, the physical time in milliseconds
+// is kept in the upper 48 bits and the logical counter in the lower 16 bits.
+type HLC uint64
+
 type ID string
 
 type JournalMeta struct {
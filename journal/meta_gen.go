@@ -6,12 +6,425 @@ package journal
 
 import "github.com/tinylib/msgp/msgp"
 
+// DecodeMsg implements msgp.Decodable
+func (z *ChunkDiff) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zjtc uint32
+	zjtc, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zjtc > 0 {
+		zjtc--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Added":
+			var zdjw uint32
+			zdjw, err = dc.ReadArrayHeader()
+			if err != nil {
+				return
+			}
+			if cap(z.Added) >= int(zdjw) {
+				z.Added = (z.Added)[:zdjw]
+			} else {
+				z.Added = make(FileMetaList, zdjw)
+			}
+			for zkst := range z.Added {
+				if dc.IsNil() {
+					err = dc.ReadNil()
+					if err != nil {
+						return
+					}
+					z.Added[zkst] = nil
+				} else {
+					if z.Added[zkst] == nil {
+						z.Added[zkst] = new(FileMeta)
+					}
+					err = z.Added[zkst].DecodeMsg(dc)
+					if err != nil {
+						return
+					}
+				}
+			}
+		case "Deleted":
+			var zixt uint32
+			zixt, err = dc.ReadArrayHeader()
+			if err != nil {
+				return
+			}
+			if cap(z.Deleted) >= int(zixt) {
+				z.Deleted = (z.Deleted)[:zixt]
+			} else {
+				z.Deleted = make(FileMetaList, zixt)
+			}
+			for zmur := range z.Deleted {
+				if dc.IsNil() {
+					err = dc.ReadNil()
+					if err != nil {
+						return
+					}
+					z.Deleted[zmur] = nil
+				} else {
+					if z.Deleted[zmur] == nil {
+						z.Deleted[zmur] = new(FileMeta)
+					}
+					err = z.Deleted[zmur].DecodeMsg(dc)
+					if err != nil {
+						return
+					}
+				}
+			}
+		case "Changed":
+			var zmqr uint32
+			zmqr, err = dc.ReadArrayHeader()
+			if err != nil {
+				return
+			}
+			if cap(z.Changed) >= int(zmqr) {
+				z.Changed = (z.Changed)[:zmqr]
+			} else {
+				z.Changed = make(FileMetaChangeList, zmqr)
+			}
+			for znei := range z.Changed {
+				if dc.IsNil() {
+					err = dc.ReadNil()
+					if err != nil {
+						return
+					}
+					z.Changed[znei] = nil
+				} else {
+					if z.Changed[znei] == nil {
+						z.Changed[znei] = new(FileMetaChange)
+					}
+					err = z.Changed[znei].DecodeMsg(dc)
+					if err != nil {
+						return
+					}
+				}
+			}
+		case "Until":
+			z.Until, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "Done":
+			z.Done, err = dc.ReadBool()
+			if err != nil {
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *ChunkDiff) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 5
+	// write "Added"
+	err = en.Append(0x85, 0xa5, 0x41, 0x64, 0x64, 0x65, 0x64)
+	if err != nil {
+		return err
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Added)))
+	if err != nil {
+		return
+	}
+	for zkst := range z.Added {
+		if z.Added[zkst] == nil {
+			err = en.WriteNil()
+			if err != nil {
+				return
+			}
+		} else {
+			err = z.Added[zkst].EncodeMsg(en)
+			if err != nil {
+				return
+			}
+		}
+	}
+	// write "Deleted"
+	err = en.Append(0xa7, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x64)
+	if err != nil {
+		return err
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Deleted)))
+	if err != nil {
+		return
+	}
+	for zmur := range z.Deleted {
+		if z.Deleted[zmur] == nil {
+			err = en.WriteNil()
+			if err != nil {
+				return
+			}
+		} else {
+			err = z.Deleted[zmur].EncodeMsg(en)
+			if err != nil {
+				return
+			}
+		}
+	}
+	// write "Changed"
+	err = en.Append(0xa7, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x64)
+	if err != nil {
+		return err
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Changed)))
+	if err != nil {
+		return
+	}
+	for znei := range z.Changed {
+		if z.Changed[znei] == nil {
+			err = en.WriteNil()
+			if err != nil {
+				return
+			}
+		} else {
+			err = z.Changed[znei].EncodeMsg(en)
+			if err != nil {
+				return
+			}
+		}
+	}
+	// write "Until"
+	err = en.Append(0xa5, 0x55, 0x6e, 0x74, 0x69, 0x6c)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.Until)
+	if err != nil {
+		return
+	}
+	// write "Done"
+	err = en.Append(0xa4, 0x44, 0x6f, 0x6e, 0x65)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBool(z.Done)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *ChunkDiff) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 5
+	// string "Added"
+	o = append(o, 0x85, 0xa5, 0x41, 0x64, 0x64, 0x65, 0x64)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Added)))
+	for zkst := range z.Added {
+		if z.Added[zkst] == nil {
+			o = msgp.AppendNil(o)
+		} else {
+			o, err = z.Added[zkst].MarshalMsg(o)
+			if err != nil {
+				return
+			}
+		}
+	}
+	// string "Deleted"
+	o = append(o, 0xa7, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x64)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Deleted)))
+	for zmur := range z.Deleted {
+		if z.Deleted[zmur] == nil {
+			o = msgp.AppendNil(o)
+		} else {
+			o, err = z.Deleted[zmur].MarshalMsg(o)
+			if err != nil {
+				return
+			}
+		}
+	}
+	// string "Changed"
+	o = append(o, 0xa7, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x64)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Changed)))
+	for znei := range z.Changed {
+		if z.Changed[znei] == nil {
+			o = msgp.AppendNil(o)
+		} else {
+			o, err = z.Changed[znei].MarshalMsg(o)
+			if err != nil {
+				return
+			}
+		}
+	}
+	// string "Until"
+	o = append(o, 0xa5, 0x55, 0x6e, 0x74, 0x69, 0x6c)
+	o = msgp.AppendString(o, z.Until)
+	// string "Done"
+	o = append(o, 0xa4, 0x44, 0x6f, 0x6e, 0x65)
+	o = msgp.AppendBool(o, z.Done)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *ChunkDiff) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zeny uint32
+	zeny, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zeny > 0 {
+		zeny--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Added":
+			var zjmi uint32
+			zjmi, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if cap(z.Added) >= int(zjmi) {
+				z.Added = (z.Added)[:zjmi]
+			} else {
+				z.Added = make(FileMetaList, zjmi)
+			}
+			for zkst := range z.Added {
+				if msgp.IsNil(bts) {
+					bts, err = msgp.ReadNilBytes(bts)
+					if err != nil {
+						return
+					}
+					z.Added[zkst] = nil
+				} else {
+					if z.Added[zkst] == nil {
+						z.Added[zkst] = new(FileMeta)
+					}
+					bts, err = z.Added[zkst].UnmarshalMsg(bts)
+					if err != nil {
+						return
+					}
+				}
+			}
+		case "Deleted":
+			var zclk uint32
+			zclk, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if cap(z.Deleted) >= int(zclk) {
+				z.Deleted = (z.Deleted)[:zclk]
+			} else {
+				z.Deleted = make(FileMetaList, zclk)
+			}
+			for zmur := range z.Deleted {
+				if msgp.IsNil(bts) {
+					bts, err = msgp.ReadNilBytes(bts)
+					if err != nil {
+						return
+					}
+					z.Deleted[zmur] = nil
+				} else {
+					if z.Deleted[zmur] == nil {
+						z.Deleted[zmur] = new(FileMeta)
+					}
+					bts, err = z.Deleted[zmur].UnmarshalMsg(bts)
+					if err != nil {
+						return
+					}
+				}
+			}
+		case "Changed":
+			var znsq uint32
+			znsq, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if cap(z.Changed) >= int(znsq) {
+				z.Changed = (z.Changed)[:znsq]
+			} else {
+				z.Changed = make(FileMetaChangeList, znsq)
+			}
+			for znei := range z.Changed {
+				if msgp.IsNil(bts) {
+					bts, err = msgp.ReadNilBytes(bts)
+					if err != nil {
+						return
+					}
+					z.Changed[znei] = nil
+				} else {
+					if z.Changed[znei] == nil {
+						z.Changed[znei] = new(FileMetaChange)
+					}
+					bts, err = z.Changed[znei].UnmarshalMsg(bts)
+					if err != nil {
+						return
+					}
+				}
+			}
+		case "Until":
+			z.Until, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Done":
+			z.Done, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *ChunkDiff) Msgsize() (s int) {
+	s = 1 + 6 + msgp.ArrayHeaderSize
+	for zkst := range z.Added {
+		if z.Added[zkst] == nil {
+			s += msgp.NilSize
+		} else {
+			s += z.Added[zkst].Msgsize()
+		}
+	}
+	s += 8 + msgp.ArrayHeaderSize
+	for zmur := range z.Deleted {
+		if z.Deleted[zmur] == nil {
+			s += msgp.NilSize
+		} else {
+			s += z.Deleted[zmur].Msgsize()
+		}
+	}
+	s += 8 + msgp.ArrayHeaderSize
+	for znei := range z.Changed {
+		if z.Changed[znei] == nil {
+			s += msgp.NilSize
+		} else {
+			s += z.Changed[znei].Msgsize()
+		}
+	}
+	s += 6 + msgp.StringPrefixSize + len(z.Until) + 5 + msgp.BoolSize
+	return
+}
+
 // DecodeMsg implements msgp.Decodable
 func (z *ConsistencyLevel) DecodeMsg(dc *msgp.Reader) (err error) {
 	{
-		var zxvk int
-		zxvk, err = dc.ReadInt()
-		(*z) = ConsistencyLevel(zxvk)
+		var zbij int
+		zbij, err = dc.ReadInt()
+		(*z) = ConsistencyLevel(zbij)
 	}
 	if err != nil {
 		return
@@ -38,9 +451,9 @@ func (z ConsistencyLevel) MarshalMsg(b []byte) (o []byte, err error) {
 // UnmarshalMsg implements msgp.Unmarshaler
 func (z *ConsistencyLevel) UnmarshalMsg(bts []byte) (o []byte, err error) {
 	{
-		var zbzg int
-		zbzg, bts, err = msgp.ReadIntBytes(bts)
-		(*z) = ConsistencyLevel(zbzg)
+		var ztoe int
+		ztoe, bts, err = msgp.ReadIntBytes(bts)
+		(*z) = ConsistencyLevel(ztoe)
 	}
 	if err != nil {
 		return
@@ -59,13 +472,13 @@ func (z ConsistencyLevel) Msgsize() (s int) {
 func (z *FileMeta) DecodeMsg(dc *msgp.Reader) (err error) {
 	var field []byte
 	_ = field
-	var zajw uint32
-	zajw, err = dc.ReadMapHeader()
+	var zqqr uint32
+	zqqr, err = dc.ReadMapHeader()
 	if err != nil {
 		return
 	}
-	for zajw > 0 {
-		zajw--
+	for zqqr > 0 {
+		zqqr--
 		field, err = dc.ReadMapKeyPtr()
 		if err != nil {
 			return
@@ -92,31 +505,31 @@ func (z *FileMeta) DecodeMsg(dc *msgp.Reader) (err error) {
 				return
 			}
 		case "UserMeta":
-			var zwht uint32
-			zwht, err = dc.ReadMapHeader()
+			var zeok uint32
+			zeok, err = dc.ReadMapHeader()
 			if err != nil {
 				return
 			}
-			if z.UserMeta == nil && zwht > 0 {
-				z.UserMeta = make(map[string]string, zwht)
+			if z.UserMeta == nil && zeok > 0 {
+				z.UserMeta = make(map[string]string, zeok)
 			} else if len(z.UserMeta) > 0 {
 				for key := range z.UserMeta {
 					delete(z.UserMeta, key)
 				}
 			}
-			for zwht > 0 {
-				zwht--
-				var zbai string
-				var zcmr string
-				zbai, err = dc.ReadString()
+			for zeok > 0 {
+				zeok--
+				var zkel string
+				var zyrk string
+				zkel, err = dc.ReadString()
 				if err != nil {
 					return
 				}
-				zcmr, err = dc.ReadString()
+				zyrk, err = dc.ReadString()
 				if err != nil {
 					return
 				}
-				z.UserMeta[zbai] = zcmr
+				z.UserMeta[zkel] = zyrk
 			}
 		case "IsSymlink":
 			z.IsSymlink, err = dc.ReadBool()
@@ -125,9 +538,9 @@ func (z *FileMeta) DecodeMsg(dc *msgp.Reader) (err error) {
 			}
 		case "Consistency":
 			{
-				var zhct int
-				zhct, err = dc.ReadInt()
-				z.Consistency = ConsistencyLevel(zhct)
+				var zkft int
+				zkft, err = dc.ReadInt()
+				z.Consistency = ConsistencyLevel(zkft)
 			}
 			if err != nil {
 				return
@@ -142,6 +555,25 @@ func (z *FileMeta) DecodeMsg(dc *msgp.Reader) (err error) {
 			if err != nil {
 				return
 			}
+		case "Replicas":
+			z.Replicas, err = dc.ReadInt()
+			if err != nil {
+				return
+			}
+		case "Clock":
+			{
+				var zuqz uint64
+				zuqz, err = dc.ReadUint64()
+				z.Clock = HLC(zuqz)
+			}
+			if err != nil {
+				return
+			}
+		case "Key":
+			z.Key, err = dc.ReadString()
+			if err != nil {
+				return
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -154,9 +586,9 @@ func (z *FileMeta) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *FileMeta) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 9
+	// map header, size 12
 	// write "ID"
-	err = en.Append(0x89, 0xa2, 0x49, 0x44)
+	err = en.Append(0x8c, 0xa2, 0x49, 0x44)
 	if err != nil {
 		return err
 	}
@@ -200,12 +632,12 @@ func (z *FileMeta) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
-	for zbai, zcmr := range z.UserMeta {
-		err = en.WriteString(zbai)
+	for zkel, zyrk := range z.UserMeta {
+		err = en.WriteString(zkel)
 		if err != nil {
 			return
 		}
-		err = en.WriteString(zcmr)
+		err = en.WriteString(zyrk)
 		if err != nil {
 			return
 		}
@@ -246,15 +678,42 @@ func (z *FileMeta) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
+	// write "Replicas"
+	err = en.Append(0xa8, 0x52, 0x65, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x73)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt(z.Replicas)
+	if err != nil {
+		return
+	}
+	// write "Clock"
+	err = en.Append(0xa5, 0x43, 0x6c, 0x6f, 0x63, 0x6b)
+	if err != nil {
+		return err
+	}
+	err = en.WriteUint64(uint64(z.Clock))
+	if err != nil {
+		return
+	}
+	// write "Key"
+	err = en.Append(0xa3, 0x4b, 0x65, 0x79)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.Key)
+	if err != nil {
+		return
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
 func (z *FileMeta) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 9
+	// map header, size 12
 	// string "ID"
-	o = append(o, 0x89, 0xa2, 0x49, 0x44)
+	o = append(o, 0x8c, 0xa2, 0x49, 0x44)
 	o = msgp.AppendString(o, z.ID)
 	// string "Name"
 	o = append(o, 0xa4, 0x4e, 0x61, 0x6d, 0x65)
@@ -268,9 +727,9 @@ func (z *FileMeta) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "UserMeta"
 	o = append(o, 0xa8, 0x55, 0x73, 0x65, 0x72, 0x4d, 0x65, 0x74, 0x61)
 	o = msgp.AppendMapHeader(o, uint32(len(z.UserMeta)))
-	for zbai, zcmr := range z.UserMeta {
-		o = msgp.AppendString(o, zbai)
-		o = msgp.AppendString(o, zcmr)
+	for zkel, zyrk := range z.UserMeta {
+		o = msgp.AppendString(o, zkel)
+		o = msgp.AppendString(o, zyrk)
 	}
 	// string "IsSymlink"
 	o = append(o, 0xa9, 0x49, 0x73, 0x53, 0x79, 0x6d, 0x6c, 0x69, 0x6e, 0x6b)
@@ -284,98 +743,442 @@ func (z *FileMeta) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "IsFetched"
 	o = append(o, 0xa9, 0x49, 0x73, 0x46, 0x65, 0x74, 0x63, 0x68, 0x65, 0x64)
 	o = msgp.AppendBool(o, z.IsFetched)
+	// string "Replicas"
+	o = append(o, 0xa8, 0x52, 0x65, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x73)
+	o = msgp.AppendInt(o, z.Replicas)
+	// string "Clock"
+	o = append(o, 0xa5, 0x43, 0x6c, 0x6f, 0x63, 0x6b)
+	o = msgp.AppendUint64(o, uint64(z.Clock))
+	// string "Key"
+	o = append(o, 0xa3, 0x4b, 0x65, 0x79)
+	o = msgp.AppendString(o, z.Key)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *FileMeta) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zqtp uint32
+	zqtp, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zqtp > 0 {
+		zqtp--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "ID":
+			z.ID, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Name":
+			z.Name, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Size":
+			z.Size, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "Timestamp":
+			z.Timestamp, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				return
+			}
+		case "UserMeta":
+			var ztva uint32
+			ztva, bts, err = msgp.ReadMapHeaderBytes(bts)
+			if err != nil {
+				return
+			}
+			if z.UserMeta == nil && ztva > 0 {
+				z.UserMeta = make(map[string]string, ztva)
+			} else if len(z.UserMeta) > 0 {
+				for key := range z.UserMeta {
+					delete(z.UserMeta, key)
+				}
+			}
+			for ztva > 0 {
+				var zkel string
+				var zyrk string
+				ztva--
+				zkel, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					return
+				}
+				zyrk, bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					return
+				}
+				z.UserMeta[zkel] = zyrk
+			}
+		case "IsSymlink":
+			z.IsSymlink, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Consistency":
+			{
+				var zpha int
+				zpha, bts, err = msgp.ReadIntBytes(bts)
+				z.Consistency = ConsistencyLevel(zpha)
+			}
+			if err != nil {
+				return
+			}
+		case "IsDeleted":
+			z.IsDeleted, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
+		case "IsFetched":
+			z.IsFetched, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Replicas":
+			z.Replicas, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Clock":
+			{
+				var zfuu uint64
+				zfuu, bts, err = msgp.ReadUint64Bytes(bts)
+				z.Clock = HLC(zfuu)
+			}
+			if err != nil {
+				return
+			}
+		case "Key":
+			z.Key, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *FileMeta) Msgsize() (s int) {
+	s = 1 + 3 + msgp.StringPrefixSize + len(z.ID) + 5 + msgp.StringPrefixSize + len(z.Name) + 5 + msgp.Int64Size + 10 + msgp.Int64Size + 9 + msgp.MapHeaderSize
+	if z.UserMeta != nil {
+		for zkel, zyrk := range z.UserMeta {
+			_ = zyrk
+			s += msgp.StringPrefixSize + len(zkel) + msgp.StringPrefixSize + len(zyrk)
+		}
+	}
+	s += 10 + msgp.BoolSize + 12 + msgp.IntSize + 10 + msgp.BoolSize + 10 + msgp.BoolSize + 9 + msgp.IntSize + 6 + msgp.Uint64Size + 4 + msgp.StringPrefixSize + len(z.Key)
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *FileMetaChange) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zadc uint32
+	zadc, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zadc > 0 {
+		zadc--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Prev":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					return
+				}
+				z.Prev = nil
+			} else {
+				if z.Prev == nil {
+					z.Prev = new(FileMeta)
+				}
+				err = z.Prev.DecodeMsg(dc)
+				if err != nil {
+					return
+				}
+			}
+		case "Next":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					return
+				}
+				z.Next = nil
+			} else {
+				if z.Next == nil {
+					z.Next = new(FileMeta)
+				}
+				err = z.Next.DecodeMsg(dc)
+				if err != nil {
+					return
+				}
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *FileMetaChange) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 2
+	// write "Prev"
+	err = en.Append(0x82, 0xa4, 0x50, 0x72, 0x65, 0x76)
+	if err != nil {
+		return err
+	}
+	if z.Prev == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = z.Prev.EncodeMsg(en)
+		if err != nil {
+			return
+		}
+	}
+	// write "Next"
+	err = en.Append(0xa4, 0x4e, 0x65, 0x78, 0x74)
+	if err != nil {
+		return err
+	}
+	if z.Next == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = z.Next.EncodeMsg(en)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *FileMetaChange) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 2
+	// string "Prev"
+	o = append(o, 0x82, 0xa4, 0x50, 0x72, 0x65, 0x76)
+	if z.Prev == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o, err = z.Prev.MarshalMsg(o)
+		if err != nil {
+			return
+		}
+	}
+	// string "Next"
+	o = append(o, 0xa4, 0x4e, 0x65, 0x78, 0x74)
+	if z.Next == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o, err = z.Next.MarshalMsg(o)
+		if err != nil {
+			return
+		}
+	}
 	return
 }
 
 // UnmarshalMsg implements msgp.Unmarshaler
-func (z *FileMeta) UnmarshalMsg(bts []byte) (o []byte, err error) {
+func (z *FileMetaChange) UnmarshalMsg(bts []byte) (o []byte, err error) {
 	var field []byte
 	_ = field
-	var zcua uint32
-	zcua, bts, err = msgp.ReadMapHeaderBytes(bts)
+	var zbkb uint32
+	zbkb, bts, err = msgp.ReadMapHeaderBytes(bts)
 	if err != nil {
 		return
 	}
-	for zcua > 0 {
-		zcua--
+	for zbkb > 0 {
+		zbkb--
 		field, bts, err = msgp.ReadMapKeyZC(bts)
 		if err != nil {
 			return
 		}
 		switch msgp.UnsafeString(field) {
-		case "ID":
-			z.ID, bts, err = msgp.ReadStringBytes(bts)
-			if err != nil {
-				return
+		case "Prev":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Prev = nil
+			} else {
+				if z.Prev == nil {
+					z.Prev = new(FileMeta)
+				}
+				bts, err = z.Prev.UnmarshalMsg(bts)
+				if err != nil {
+					return
+				}
 			}
-		case "Name":
-			z.Name, bts, err = msgp.ReadStringBytes(bts)
-			if err != nil {
-				return
+		case "Next":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Next = nil
+			} else {
+				if z.Next == nil {
+					z.Next = new(FileMeta)
+				}
+				bts, err = z.Next.UnmarshalMsg(bts)
+				if err != nil {
+					return
+				}
 			}
-		case "Size":
-			z.Size, bts, err = msgp.ReadInt64Bytes(bts)
+		default:
+			bts, err = msgp.Skip(bts)
 			if err != nil {
 				return
 			}
-		case "Timestamp":
-			z.Timestamp, bts, err = msgp.ReadInt64Bytes(bts)
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *FileMetaChange) Msgsize() (s int) {
+	s = 1 + 5
+	if z.Prev == nil {
+		s += msgp.NilSize
+	} else {
+		s += z.Prev.Msgsize()
+	}
+	s += 5
+	if z.Next == nil {
+		s += msgp.NilSize
+	} else {
+		s += z.Next.Msgsize()
+	}
+	return
+}
+
+// DecodeMsg implements msgp.Decodable
+func (z *FileMetaChangeList) DecodeMsg(dc *msgp.Reader) (err error) {
+	var zxwi uint32
+	zxwi, err = dc.ReadArrayHeader()
+	if err != nil {
+		return
+	}
+	if cap((*z)) >= int(zxwi) {
+		(*z) = (*z)[:zxwi]
+	} else {
+		(*z) = make(FileMetaChangeList, zxwi)
+	}
+	for zmbr := range *z {
+		if dc.IsNil() {
+			err = dc.ReadNil()
 			if err != nil {
 				return
 			}
-		case "UserMeta":
-			var zxhx uint32
-			zxhx, bts, err = msgp.ReadMapHeaderBytes(bts)
+			(*z)[zmbr] = nil
+		} else {
+			if (*z)[zmbr] == nil {
+				(*z)[zmbr] = new(FileMetaChange)
+			}
+			err = (*z)[zmbr].DecodeMsg(dc)
 			if err != nil {
 				return
 			}
-			if z.UserMeta == nil && zxhx > 0 {
-				z.UserMeta = make(map[string]string, zxhx)
-			} else if len(z.UserMeta) > 0 {
-				for key := range z.UserMeta {
-					delete(z.UserMeta, key)
-				}
-			}
-			for zxhx > 0 {
-				var zbai string
-				var zcmr string
-				zxhx--
-				zbai, bts, err = msgp.ReadStringBytes(bts)
-				if err != nil {
-					return
-				}
-				zcmr, bts, err = msgp.ReadStringBytes(bts)
-				if err != nil {
-					return
-				}
-				z.UserMeta[zbai] = zcmr
-			}
-		case "IsSymlink":
-			z.IsSymlink, bts, err = msgp.ReadBoolBytes(bts)
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z FileMetaChangeList) EncodeMsg(en *msgp.Writer) (err error) {
+	err = en.WriteArrayHeader(uint32(len(z)))
+	if err != nil {
+		return
+	}
+	for zgkf := range z {
+		if z[zgkf] == nil {
+			err = en.WriteNil()
 			if err != nil {
 				return
 			}
-		case "Consistency":
-			{
-				var zlqf int
-				zlqf, bts, err = msgp.ReadIntBytes(bts)
-				z.Consistency = ConsistencyLevel(zlqf)
-			}
+		} else {
+			err = z[zgkf].EncodeMsg(en)
 			if err != nil {
 				return
 			}
-		case "IsDeleted":
-			z.IsDeleted, bts, err = msgp.ReadBoolBytes(bts)
+		}
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z FileMetaChangeList) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	o = msgp.AppendArrayHeader(o, uint32(len(z)))
+	for zgkf := range z {
+		if z[zgkf] == nil {
+			o = msgp.AppendNil(o)
+		} else {
+			o, err = z[zgkf].MarshalMsg(o)
 			if err != nil {
 				return
 			}
-		case "IsFetched":
-			z.IsFetched, bts, err = msgp.ReadBoolBytes(bts)
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *FileMetaChangeList) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var zali uint32
+	zali, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	if cap((*z)) >= int(zali) {
+		(*z) = (*z)[:zali]
+	} else {
+		(*z) = make(FileMetaChangeList, zali)
+	}
+	for zofw := range *z {
+		if msgp.IsNil(bts) {
+			bts, err = msgp.ReadNilBytes(bts)
 			if err != nil {
 				return
 			}
-		default:
-			bts, err = msgp.Skip(bts)
+			(*z)[zofw] = nil
+		} else {
+			if (*z)[zofw] == nil {
+				(*z)[zofw] = new(FileMetaChange)
+			}
+			bts, err = (*z)[zofw].UnmarshalMsg(bts)
 			if err != nil {
 				return
 			}
@@ -386,42 +1189,42 @@ func (z *FileMeta) UnmarshalMsg(bts []byte) (o []byte, err error) {
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
-func (z *FileMeta) Msgsize() (s int) {
-	s = 1 + 3 + msgp.StringPrefixSize + len(z.ID) + 5 + msgp.StringPrefixSize + len(z.Name) + 5 + msgp.Int64Size + 10 + msgp.Int64Size + 9 + msgp.MapHeaderSize
-	if z.UserMeta != nil {
-		for zbai, zcmr := range z.UserMeta {
-			_ = zcmr
-			s += msgp.StringPrefixSize + len(zbai) + msgp.StringPrefixSize + len(zcmr)
+func (z FileMetaChangeList) Msgsize() (s int) {
+	s = msgp.ArrayHeaderSize
+	for zxze := range z {
+		if z[zxze] == nil {
+			s += msgp.NilSize
+		} else {
+			s += z[zxze].Msgsize()
 		}
 	}
-	s += 10 + msgp.BoolSize + 12 + msgp.IntSize + 10 + msgp.BoolSize + 10 + msgp.BoolSize
 	return
 }
 
 // DecodeMsg implements msgp.Decodable
 func (z *FileMetaList) DecodeMsg(dc *msgp.Reader) (err error) {
-	var zjfb uint32
-	zjfb, err = dc.ReadArrayHeader()
+	var zcrh uint32
+	zcrh, err = dc.ReadArrayHeader()
 	if err != nil {
 		return
 	}
-	if cap((*z)) >= int(zjfb) {
-		(*z) = (*z)[:zjfb]
+	if cap((*z)) >= int(zcrh) {
+		(*z) = (*z)[:zcrh]
 	} else {
-		(*z) = make(FileMetaList, zjfb)
+		(*z) = make(FileMetaList, zcrh)
 	}
-	for zpks := range *z {
+	for zbgb := range *z {
 		if dc.IsNil() {
 			err = dc.ReadNil()
 			if err != nil {
 				return
 			}
-			(*z)[zpks] = nil
+			(*z)[zbgb] = nil
 		} else {
-			if (*z)[zpks] == nil {
-				(*z)[zpks] = new(FileMeta)
+			if (*z)[zbgb] == nil {
+				(*z)[zbgb] = new(FileMeta)
 			}
-			err = (*z)[zpks].DecodeMsg(dc)
+			err = (*z)[zbgb].DecodeMsg(dc)
 			if err != nil {
 				return
 			}
@@ -436,14 +1239,14 @@ func (z FileMetaList) EncodeMsg(en *msgp.Writer) (err error) {
 	if err != nil {
 		return
 	}
-	for zcxo := range z {
-		if z[zcxo] == nil {
+	for zxes := range z {
+		if z[zxes] == nil {
 			err = en.WriteNil()
 			if err != nil {
 				return
 			}
 		} else {
-			err = z[zcxo].EncodeMsg(en)
+			err = z[zxes].EncodeMsg(en)
 			if err != nil {
 				return
 			}
@@ -456,11 +1259,11 @@ func (z FileMetaList) EncodeMsg(en *msgp.Writer) (err error) {
 func (z FileMetaList) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
 	o = msgp.AppendArrayHeader(o, uint32(len(z)))
-	for zcxo := range z {
-		if z[zcxo] == nil {
+	for zxes := range z {
+		if z[zxes] == nil {
 			o = msgp.AppendNil(o)
 		} else {
-			o, err = z[zcxo].MarshalMsg(o)
+			o, err = z[zxes].MarshalMsg(o)
 			if err != nil {
 				return
 			}
@@ -471,28 +1274,28 @@ func (z FileMetaList) MarshalMsg(b []byte) (o []byte, err error) {
 
 // UnmarshalMsg implements msgp.Unmarshaler
 func (z *FileMetaList) UnmarshalMsg(bts []byte) (o []byte, err error) {
-	var zrsw uint32
-	zrsw, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	var zgmw uint32
+	zgmw, bts, err = msgp.ReadArrayHeaderBytes(bts)
 	if err != nil {
 		return
 	}
-	if cap((*z)) >= int(zrsw) {
-		(*z) = (*z)[:zrsw]
+	if cap((*z)) >= int(zgmw) {
+		(*z) = (*z)[:zgmw]
 	} else {
-		(*z) = make(FileMetaList, zrsw)
+		(*z) = make(FileMetaList, zgmw)
 	}
-	for zeff := range *z {
+	for zvpa := range *z {
 		if msgp.IsNil(bts) {
 			bts, err = msgp.ReadNilBytes(bts)
 			if err != nil {
 				return
 			}
-			(*z)[zeff] = nil
+			(*z)[zvpa] = nil
 		} else {
-			if (*z)[zeff] == nil {
-				(*z)[zeff] = new(FileMeta)
+			if (*z)[zvpa] == nil {
+				(*z)[zvpa] = new(FileMeta)
 			}
-			bts, err = (*z)[zeff].UnmarshalMsg(bts)
+			bts, err = (*z)[zvpa].UnmarshalMsg(bts)
 			if err != nil {
 				return
 			}
@@ -505,22 +1308,71 @@ func (z *FileMetaList) UnmarshalMsg(bts []byte) (o []byte, err error) {
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z FileMetaList) Msgsize() (s int) {
 	s = msgp.ArrayHeaderSize
-	for zxpk := range z {
-		if z[zxpk] == nil {
+	for zvif := range z {
+		if z[zvif] == nil {
 			s += msgp.NilSize
 		} else {
-			s += z[zxpk].Msgsize()
+			s += z[zvif].Msgsize()
 		}
 	}
 	return
 }
 
+// DecodeMsg implements msgp.Decodable
+func (z *HLC) DecodeMsg(dc *msgp.Reader) (err error) {
+	{
+		var zcvq uint64
+		zcvq, err = dc.ReadUint64()
+		(*z) = HLC(zcvq)
+	}
+	if err != nil {
+		return
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z HLC) EncodeMsg(en *msgp.Writer) (err error) {
+	err = en.WriteUint64(uint64(z))
+	if err != nil {
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z HLC) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	o = msgp.AppendUint64(o, uint64(z))
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *HLC) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	{
+		var zbkb uint64
+		zbkb, bts, err = msgp.ReadUint64Bytes(bts)
+		(*z) = HLC(zbkb)
+	}
+	if err != nil {
+		return
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z HLC) Msgsize() (s int) {
+	s = msgp.Uint64Size
+	return
+}
+
 // DecodeMsg implements msgp.Decodable
 func (z *ID) DecodeMsg(dc *msgp.Reader) (err error) {
 	{
-		var zdnj string
-		zdnj, err = dc.ReadString()
-		(*z) = ID(zdnj)
+		var zvsx string
+		zvsx, err = dc.ReadString()
+		(*z) = ID(zvsx)
 	}
 	if err != nil {
 		return
@@ -547,9 +1399,9 @@ func (z ID) MarshalMsg(b []byte) (o []byte, err error) {
 // UnmarshalMsg implements msgp.Unmarshaler
 func (z *ID) UnmarshalMsg(bts []byte) (o []byte, err error) {
 	{
-		var zobc string
-		zobc, bts, err = msgp.ReadStringBytes(bts)
-		(*z) = ID(zobc)
+		var zimn string
+		zimn, bts, err = msgp.ReadStringBytes(bts)
+		(*z) = ID(zimn)
 	}
 	if err != nil {
 		return
@@ -568,13 +1420,13 @@ func (z ID) Msgsize() (s int) {
 func (z *JournalMeta) DecodeMsg(dc *msgp.Reader) (err error) {
 	var field []byte
 	_ = field
-	var zsnv uint32
-	zsnv, err = dc.ReadMapHeader()
+	var zevk uint32
+	zevk, err = dc.ReadMapHeader()
 	if err != nil {
 		return
 	}
-	for zsnv > 0 {
-		zsnv--
+	for zevk > 0 {
+		zevk--
 		field, err = dc.ReadMapKeyPtr()
 		if err != nil {
 			return
@@ -582,9 +1434,9 @@ func (z *JournalMeta) DecodeMsg(dc *msgp.Reader) (err error) {
 		switch msgp.UnsafeString(field) {
 		case "ID":
 			{
-				var zkgt string
-				zkgt, err = dc.ReadString()
-				z.ID = ID(zkgt)
+				var zsku string
+				zsku, err = dc.ReadString()
+				z.ID = ID(zsku)
 			}
 			if err != nil {
 				return
@@ -713,13 +1565,13 @@ func (z *JournalMeta) MarshalMsg(b []byte) (o []byte, err error) {
 func (z *JournalMeta) UnmarshalMsg(bts []byte) (o []byte, err error) {
 	var field []byte
 	_ = field
-	var zema uint32
-	zema, bts, err = msgp.ReadMapHeaderBytes(bts)
+	var zpjj uint32
+	zpjj, bts, err = msgp.ReadMapHeaderBytes(bts)
 	if err != nil {
 		return
 	}
-	for zema > 0 {
-		zema--
+	for zpjj > 0 {
+		zpjj--
 		field, bts, err = msgp.ReadMapKeyZC(bts)
 		if err != nil {
 			return
@@ -727,9 +1579,9 @@ func (z *JournalMeta) UnmarshalMsg(bts []byte) (o []byte, err error) {
 		switch msgp.UnsafeString(field) {
 		case "ID":
 			{
-				var zpez string
-				zpez, bts, err = msgp.ReadStringBytes(bts)
-				z.ID = ID(zpez)
+				var zqmi string
+				zqmi, bts, err = msgp.ReadStringBytes(bts)
+				z.ID = ID(zqmi)
 			}
 			if err != nil {
 				return
@@ -775,3 +1627,141 @@ func (z *JournalMeta) Msgsize() (s int) {
 	s = 1 + 3 + msgp.StringPrefixSize + len(string(z.ID)) + 10 + msgp.Int64Size + 9 + msgp.Int64Size + 9 + msgp.StringPrefixSize + len(z.FirstKey) + 8 + msgp.StringPrefixSize + len(z.LastKey) + 11 + msgp.IntSize
 	return
 }
+
+// DecodeMsg implements msgp.Decodable
+func (z *RangeHash) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zwcm uint32
+	zwcm, err = dc.ReadMapHeader()
+	if err != nil {
+		return
+	}
+	for zwcm > 0 {
+		zwcm--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Prefix":
+			z.Prefix, err = dc.ReadString()
+			if err != nil {
+				return
+			}
+		case "Hash":
+			z.Hash, err = dc.ReadBytes(z.Hash)
+			if err != nil {
+				return
+			}
+		case "Count":
+			z.Count, err = dc.ReadInt()
+			if err != nil {
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *RangeHash) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 3
+	// write "Prefix"
+	err = en.Append(0x83, 0xa6, 0x50, 0x72, 0x65, 0x66, 0x69, 0x78)
+	if err != nil {
+		return err
+	}
+	err = en.WriteString(z.Prefix)
+	if err != nil {
+		return
+	}
+	// write "Hash"
+	err = en.Append(0xa4, 0x48, 0x61, 0x73, 0x68)
+	if err != nil {
+		return err
+	}
+	err = en.WriteBytes(z.Hash)
+	if err != nil {
+		return
+	}
+	// write "Count"
+	err = en.Append(0xa5, 0x43, 0x6f, 0x75, 0x6e, 0x74)
+	if err != nil {
+		return err
+	}
+	err = en.WriteInt(z.Count)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *RangeHash) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 3
+	// string "Prefix"
+	o = append(o, 0x83, 0xa6, 0x50, 0x72, 0x65, 0x66, 0x69, 0x78)
+	o = msgp.AppendString(o, z.Prefix)
+	// string "Hash"
+	o = append(o, 0xa4, 0x48, 0x61, 0x73, 0x68)
+	o = msgp.AppendBytes(o, z.Hash)
+	// string "Count"
+	o = append(o, 0xa5, 0x43, 0x6f, 0x75, 0x6e, 0x74)
+	o = msgp.AppendInt(o, z.Count)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *RangeHash) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zpun uint32
+	zpun, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return
+	}
+	for zpun > 0 {
+		zpun--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "Prefix":
+			z.Prefix, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return
+			}
+		case "Hash":
+			z.Hash, bts, err = msgp.ReadBytesBytes(bts, z.Hash)
+			if err != nil {
+				return
+			}
+		case "Count":
+			z.Count, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *RangeHash) Msgsize() (s int) {
+	s = 1 + 7 + msgp.StringPrefixSize + len(z.Prefix) + 5 + msgp.BytesPrefixSize + len(z.Hash) + 6 + msgp.IntSize
+	return
+}
@@ -0,0 +1,19 @@
+package objstore
+
+// LookupKey finds meta data of the live object stored under the key chosen by a client in the namespace.
+func (o *objStore) LookupKey(ns, key string) (*FileMeta, error) {
+	meta, err := o.journals.LookupKey(ns, key)
+	if err != nil {
+		return nil, err
+	} else if meta == nil {
+		return nil, ErrNotFound
+	}
+	return (*FileMeta)(meta), nil
+}
+
+// ListKeys lists live objects of the namespace with keys having the prefix in key order, starting after
+// the specified key. At most limit objects are listed if limit is positive.
+func (o *objStore) ListKeys(ns, prefix, after string, limit int) (FileMetaList, error) {
+	list, err := o.journals.ListKeys(ns, prefix, after, limit)
+	return FileMetaList(list), err
+}
@@ -0,0 +1,81 @@
+package objstore
+
+import (
+	"sphere.software/objstore/journal"
+)
+
+const defaultListLimit = 1000
+
+// ListFilter selects objects listed by ListObjects, nil fields match any value.
+type ListFilter struct {
+	// Namespace of listed objects, the default one if empty.
+	Namespace string
+	// Since and Until bound IDs of listed objects, Since is inclusive and Until is not,
+	// IDs of objects of namespaces are prefixed by their names.
+	Since string
+	Until string
+
+	IsDeleted   *bool
+	IsSymlink   *bool
+	Consistency *journal.ConsistencyLevel
+}
+
+func (f *ListFilter) Match(meta *FileMeta) bool {
+	switch {
+	case f.IsDeleted != nil && *f.IsDeleted != meta.IsDeleted:
+		return false
+	case f.IsSymlink != nil && *f.IsSymlink != meta.IsSymlink:
+		return false
+	case f.Consistency != nil && *f.Consistency != meta.Consistency:
+		return false
+	}
+	return true
+}
+
+// ListObjects lists objects from all journals in the order of IDs, starting after the specified ID.
+// Entries present in multiple journals are merged before the filter is applied, so an outdated
+// entry of another journal never matches in place of the current one.
+// Returns the ID to continue after, if there are more objects to list.
+func (o *objStore) ListObjects(after string, limit int, filter *ListFilter) (FileMetaList, string, error) {
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if filter == nil {
+		filter = new(ListFilter)
+	}
+	start := journal.JoinID(filter.Namespace, "")
+	if after > start {
+		start = after
+	}
+	if filter.Since > start {
+		start = filter.Since
+	}
+	var list FileMetaList
+	err := o.journals.RangeMerged(start, func(k string, v *journal.FileMeta) error {
+		if ns, _ := journal.SplitID(k); ns != filter.Namespace {
+			if len(filter.Namespace) > 0 {
+				return journal.ErrRangeStop
+			}
+			return nil
+		} else if k <= after {
+			return nil
+		} else if len(filter.Until) > 0 && k >= filter.Until {
+			return journal.ErrRangeStop
+		} else if !filter.Match((*FileMeta)(v)) {
+			return nil
+		}
+		list = append(list, v)
+		// one extra entry tells whether there is a next page
+		if len(list) > limit {
+			return journal.ErrRangeStop
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(list) > limit {
+		return list[:limit], list[limit-1].ID, nil
+	}
+	return list, "", nil
+}
@@ -0,0 +1,124 @@
+package objstore
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"sphere.software/objstore/cluster"
+	"sphere.software/objstore/journal"
+)
+
+// MetaUpdate lists mutable meta data fields of an object, nil fields are left unchanged.
+// UserMeta replaces user meta data of the object entirely.
+type MetaUpdate struct {
+	Name     *string           `json:"name"`
+	UserMeta map[string]string `json:"user_meta"`
+}
+
+// UpdateMeta changes meta data of the live object in journals and announces the change, the body
+// stays where it is. The change is made on the entry read within the journal update, objects stored
+// remotely then get the committed meta data by a copy in place. If the remote copy fails, the change
+// is reverted unless the entry has been changed again meanwhile, and it's not announced.
+func (o *objStore) UpdateMeta(id string, update *MetaUpdate) (*FileMeta, error) {
+	var meta, prev *FileMeta
+	err := o.journals.ForEachUpdate(func(j journal.Journal, _ *journal.JournalMeta) error {
+		m := j.Get(id)
+		if m == nil {
+			return nil
+		} else if m.IsDeleted {
+			return journal.ForEachStop
+		}
+		old := *m
+		prev = (*FileMeta)(&old)
+		if update.Name != nil {
+			m.Name = *update.Name
+		}
+		if update.UserMeta != nil {
+			m.UserMeta = update.UserMeta
+		}
+		m.Timestamp = time.Now().UnixNano()
+		m.Clock = o.clock.Now()
+		if err := j.Set(id, m); err != nil {
+			return err
+		}
+		meta = (*FileMeta)(m)
+		return journal.ForEachStop
+	})
+	if err != nil {
+		err = fmt.Errorf("objstore: journal update failed: %v", err)
+		return nil, err
+	} else if meta == nil {
+		return nil, ErrNotFound
+	}
+	if meta.Consistency != journal.ConsistencyLocal {
+		remote, key := o.remote(meta)
+		if _, err := remote.CopyObject(key, key, (*journal.FileMeta)(meta).Map()); err != nil {
+			if err := o.revertMeta(prev, meta.Clock); err != nil {
+				log.Println("[WARN] failed to revert meta update:", err)
+			}
+			err = fmt.Errorf("objstore: remote meta update failed: %v", err)
+			return nil, err
+		}
+	}
+	o.EmitEventAnnounce(&EventAnnounce{
+		Type:     cluster.EventMetaUpdated,
+		FileMeta: (*journal.FileMeta)(meta),
+	})
+	return meta, nil
+}
+
+// revertMeta restores the entry changed by a meta update that hasn't been announced,
+// unless the entry has been changed again since the update of the clock.
+func (o *objStore) revertMeta(prev *FileMeta, clock journal.HLC) error {
+	return o.journals.ForEachUpdate(func(j journal.Journal, _ *journal.JournalMeta) error {
+		m := j.Get(prev.ID)
+		if m == nil {
+			return nil
+		} else if m.Clock == clock {
+			if err := j.Set(prev.ID, (*journal.FileMeta)(prev)); err != nil {
+				return err
+			}
+		}
+		return journal.ForEachStop
+	})
+}
+
+// handleMetaUpdated applies the meta data of the event to the local entry, keeping the node-local
+// flags. Objects unknown to the node are handled as if they have been just added.
+func (o *objStore) handleMetaUpdated(ev *EventAnnounce, timeout time.Duration) error {
+	id := ev.FileMeta.ID
+	var found bool
+	err := o.journals.ForEachUpdate(func(j journal.Journal, _ *journal.JournalMeta) error {
+		m := j.Get(id)
+		if m == nil {
+			return nil
+		} else if m.IsDeleted || m.Supersedes(ev.FileMeta) {
+			// either deleted or changed again, the event is outdated
+			found = true
+			return journal.ForEachStop
+		}
+		found = true
+		meta := *ev.FileMeta
+		meta.IsSymlink = m.IsSymlink
+		meta.IsFetched = m.IsFetched
+		if err := j.Set(id, &meta); err != nil {
+			return err
+		}
+		return journal.ForEachStop
+	})
+	if err != nil {
+		err = fmt.Errorf("objstore: journal update failed: %v", err)
+		return err
+	} else if found {
+		return nil
+	}
+	if o.debug {
+		log.Println("[INFO] meta updated for unknown object:", ev.FileMeta)
+	}
+	return o.handleEvent(&EventAnnounce{
+		Type:     cluster.EventFileAdded,
+		FileMeta: ev.FileMeta,
+		Clock:    ev.Clock,
+	}, timeout)
+}
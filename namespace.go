@@ -0,0 +1,191 @@
+package objstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"time"
+
+	"sphere.software/objstore/journal"
+	"sphere.software/objstore/storage"
+)
+
+// Namespace isolates objects of a tenant sharing the cluster. Objects of a namespace have IDs
+// prefixed by its name, so they share the same prefix in journals, and they are stored in
+// the remote storage of the namespace or under the prefix of its name in the default one.
+type Namespace struct {
+	Name string `json:"name"`
+	// Consistency is the default consistency level of objects put into the namespace.
+	Consistency ConsistencyLevel `json:"consistency"`
+	// Quota limits the total size of live objects in bytes, zero means no limit.
+	Quota int64 `json:"quota"`
+	// Bucket and Region of the remote storage, if not set objects are stored in the default one.
+	Bucket string `json:"bucket"`
+	Region string `json:"region"`
+	// Keys are IDs of API keys permitted to access the namespace, if empty any key is permitted.
+	Keys []string `json:"keys"`
+
+	Remote storage.RemoteStorage `json:"-"`
+}
+
+// Permits reports whether the API key is permitted to access the namespace.
+func (n *Namespace) Permits(keyID string) bool {
+	if len(n.Keys) == 0 {
+		return true
+	}
+	for _, id := range n.Keys {
+		if id == keyID {
+			return true
+		}
+	}
+	return false
+}
+
+type NamespaceConfig struct {
+	Namespaces []*Namespace `json:"namespaces"`
+}
+
+var (
+	ErrQuotaExceeded = errors.New("objstore: namespace quota exceeded")
+
+	namespaceRx = regexp.MustCompile("^[a-z0-9][a-z0-9-]{0,62}$")
+)
+
+// LoadNamespaces reads namespaces from a JSON config file, remote storages are not set up.
+func LoadNamespaces(path string) ([]*Namespace, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config NamespaceConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		err = fmt.Errorf("objstore: failed to parse namespaces config: %v", err)
+		return nil, err
+	}
+	return config.Namespaces, nil
+}
+
+// SetNamespaces sets namespaces of the cluster, all nodes must have the same namespaces.
+// Namespaces having own remote storages must have them set up.
+func (o *objStore) SetNamespaces(namespaces []*Namespace) error {
+	byName := make(map[string]*Namespace, len(namespaces))
+	for _, ns := range namespaces {
+		if !namespaceRx.MatchString(ns.Name) {
+			return fmt.Errorf("objstore: invalid namespace name: %s", ns.Name)
+		} else if _, ok := byName[ns.Name]; ok {
+			return fmt.Errorf("objstore: duplicate namespace: %s", ns.Name)
+		} else if _, err := ns.Consistency.Check(); err != nil {
+			return fmt.Errorf("objstore: namespace %s: %v", ns.Name, err)
+		}
+		if ns.Remote != nil {
+			if err := ns.Remote.CheckAccess(""); err != nil {
+				err = fmt.Errorf("objstore: cannot access remote storage of namespace %s: %v", ns.Name, err)
+				return err
+			}
+		}
+		byName[ns.Name] = ns
+	}
+	o.nsMux.Lock()
+	o.namespaces = byName
+	o.nsMux.Unlock()
+	return nil
+}
+
+func (o *objStore) Namespace(name string) (*Namespace, bool) {
+	o.nsMux.RLock()
+	ns, ok := o.namespaces[name]
+	o.nsMux.RUnlock()
+	return ns, ok
+}
+
+// remote finds the remote storage of the object and its key there. Objects having keys chosen
+// by clients are stored under these keys, other objects under their ULIDs.
+func (o *objStore) remote(meta *FileMeta) (storage.RemoteStorage, string) {
+	name, key := journal.SplitID(meta.ID)
+	if len(meta.Key) > 0 {
+		key = meta.Key
+	}
+	return o.remoteOf(name, key)
+}
+
+func (o *objStore) remoteOf(name, key string) (storage.RemoteStorage, string) {
+	if len(name) == 0 {
+		return o.remoteStorage, key
+	}
+	if ns, ok := o.Namespace(name); ok && ns.Remote != nil {
+		return ns.Remote, key
+	}
+	return o.remoteStorage, name + "/" + key
+}
+
+// usageTTL is how long the computed usage of a namespace is trusted,
+// sizes of objects put meanwhile are added to it.
+const usageTTL = time.Minute
+
+type nsUsage struct {
+	bytes    int64
+	computed time.Time
+}
+
+// checkQuota reserves space for the object in its namespace, returns ErrQuotaExceeded if the object
+// doesn't fit. Replaced objects are not accounted, so the quota may be exceeded until they are deleted.
+func (o *objStore) checkQuota(meta *FileMeta) error {
+	name, _ := journal.SplitID(meta.ID)
+	ns, ok := o.Namespace(name)
+	if !ok || ns.Quota <= 0 {
+		return nil
+	}
+	o.nsMux.Lock()
+	usage, ok := o.usage[name]
+	o.nsMux.Unlock()
+	if !ok || time.Since(usage.computed) > usageTTL {
+		bytes, err := o.NamespaceUsage(name)
+		if err != nil {
+			return err
+		}
+		usage = &nsUsage{
+			bytes:    bytes,
+			computed: time.Now(),
+		}
+	}
+	o.nsMux.Lock()
+	defer o.nsMux.Unlock()
+	if usage.bytes+meta.Size > ns.Quota {
+		return ErrQuotaExceeded
+	}
+	usage.bytes += meta.Size
+	o.usage[name] = usage
+	return nil
+}
+
+// NamespaceUsage computes the total size of live objects in the namespace.
+func (o *objStore) NamespaceUsage(name string) (int64, error) {
+	prefix := journal.JoinID(name, "")
+	sizes := make(map[string]*journal.FileMeta)
+	err := o.journals.ForEach(func(j journal.Journal, _ *journal.JournalMeta) error {
+		_, err := j.Range(prefix, 0, func(k string, v *journal.FileMeta) error {
+			if ns, _ := journal.SplitID(k); ns != name {
+				if len(name) > 0 {
+					return journal.ErrRangeStop
+				}
+				return nil
+			} else if v == nil {
+				return nil
+			}
+			if prev, ok := sizes[k]; !ok || v.Supersedes(prev) {
+				sizes[k] = v
+			}
+			return nil
+		})
+		return err
+	})
+	var total int64
+	for _, meta := range sizes {
+		if !meta.IsDeleted {
+			total += meta.Size
+		}
+	}
+	return total, err
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -26,29 +27,93 @@ type Store interface {
 	ReceiveEventAnnounce(event *EventAnnounce)
 	EmitEventAnnounce(event *EventAnnounce)
 	DiskStats() (*DiskStats, error)
+	// HintStats reports the state of announcements kept for unreachable nodes.
+	HintStats() *HintStats
+	// QueueStats reports the depth and age of the inbound and outbound event queues.
+	QueueStats() (inbound, outbound *QueueStats)
+	// RebalanceStatus reports the progress of objects rebalancing across the cluster.
+	RebalanceStatus() *RebalanceStatus
+	// SetRebalanceLimit sets the bandwidth limit for rebalancing in bytes per second.
+	SetRebalanceLimit(bytesPerSec int64)
+	// SetTombstoneRetention sets how long entries of deleted objects are kept in journals,
+	// zero means forever.
+	SetTombstoneRetention(d time.Duration)
+	// AntiEntropyStatus reports the progress of periodic journal reconciliation.
+	AntiEntropyStatus() *AntiEntropyStatus
 	Close() error
 
 	// HeadObject gets object's meta data from the local journal.
 	HeadObject(id string) (*FileMeta, error)
+	// HeadLatest gets object's meta data like HeadObject does, and also from the nodes chosen by placement
+	// for the object, so versions taken by other nodes and not synced yet are seen. The superseding one wins.
+	HeadLatest(ctx context.Context, id string, replicas int) (*FileMeta, error)
 	// GetObject gets an object from the local storage of the node.
 	// Used for private API, when other nodes ask for an object.
 	GetObject(id string) (io.ReadCloser, *FileMeta, error)
 	// FindObject gets and object from any node, if not found then tries to acquire from
-	// the remote storage, e.g. Amazon S3.
+	// the remote storage, e.g. Amazon S3. IDs of objects of namespaces are prefixed by their names.
 	FindObject(ctx context.Context, id string, fetch bool) (io.ReadCloser, *FileMeta, error)
 	// FetchObject retrieves an object from the remote storage, e.g. Amazon S3.
 	// This should be called only on a total cache miss, when file is not found
-	// on any node of the cluster. If supplied ID is not a valid ULID, resulting meta will have a new ID.
-	FetchObject(ctx context.Context, id string) (io.ReadCloser, *FileMeta, error)
+	// on any node of the cluster. The object of the namespace is referenced by its ULID, otherwise ref
+	// is treated as the object key and resulting meta will have the ID the key is mapped to, or a new ID.
+	FetchObject(ctx context.Context, ns, ref string) (io.ReadCloser, *FileMeta, error)
 	// PutObject writes object to the local storage, emits cluster announcements, optionally
 	// writes object to remote storage, e.g. Amazon S3. Returns amount of bytes written.
 	PutObject(r io.ReadCloser, meta *FileMeta) (int64, error)
 	// DeleteObject marks object as deleted in journals and deletes it from the local storage.
 	// This operation does not delete object from remote storage.
 	DeleteObject(id string) (*FileMeta, error)
+	// UpdateMeta changes mutable meta data of the live object without moving its body,
+	// the change is announced to the cluster and applied to the remote storage copy.
+	UpdateMeta(id string, update *MetaUpdate) (*FileMeta, error)
+	// CopyObject creates the object described by meta having the body of the live object srcID,
+	// the body is linked locally and copied within the remote storage when possible.
+	CopyObject(ctx context.Context, srcID string, meta *FileMeta) (*FileMeta, error)
+	// Batch applies puts of small objects and deletes at once, in one journal transaction,
+	// and announces them as one event. Results are in the order of ops.
+	Batch(ops []*BatchOp) []*BatchResult
+	// InitiateUpload, UploadPart, CompleteUpload and AbortUpload manage resumable uploads, parts are
+	// staged on the local disk until the upload is completed. GetUpload reports the progress.
+	InitiateUpload(meta *FileMeta) (*Upload, error)
+	GetUpload(uploadID string) (*Upload, error)
+	UploadPart(uploadID string, n int, r io.Reader) (int64, error)
+	CompleteUpload(uploadID string) (*FileMeta, error)
+	AbortUpload(uploadID string) error
 	// Diff finds the difference between serialized exernal journal represented as list,
-	// and journals currently available on this local node.
-	Diff(list FileMetaList) (added, deleted FileMetaList, err error)
+	// and journals currently available on this local node. Changed entries keep
+	// the external version as Prev and the local one as Next.
+	Diff(list FileMetaList) (added, deleted FileMetaList, changed FileMetaChangeList, err error)
+	// DiffChunk is like Diff, but compares a chunk of the external journal sorted by key. The chunk
+	// covers keys following after up to its last key, or all the remaining keys if it's the last one.
+	// The amount of differences is limited, the requester continues after the Until key if not done.
+	DiffChunk(after string, list FileMetaList, last bool) (*ChunkDiff, error)
+	// ListObjects lists objects from all journals in the order of IDs, starting after the specified ID.
+	// Returns the ID to continue after, if there are more objects to list.
+	ListObjects(after string, limit int, filter *ListFilter) (FileMetaList, string, error)
+	// LookupKey finds meta data of the live object stored under the key chosen by a client.
+	LookupKey(ns, key string) (*FileMeta, error)
+	// ListKeys lists live objects with keys having the prefix in key order, starting after
+	// the specified key. At most limit objects are listed if limit is positive.
+	ListKeys(ns, prefix, after string, limit int) (FileMetaList, error)
+	// SetIndexedMeta sets user meta keys to index for queries, all nodes should index the same keys.
+	SetIndexedMeta(keys []string) error
+	// QueryObjects lists live objects of the namespace matching the query, starting after the cursor.
+	// Returns the cursor to continue after, if there are more objects to list.
+	QueryObjects(ns string, q *Query, after string, limit int) (FileMetaList, string, error)
+	// SetNamespaces sets namespaces of the cluster, all nodes must have the same namespaces.
+	SetNamespaces(namespaces []*Namespace) error
+	// Namespace finds the namespace by name.
+	Namespace(name string) (*Namespace, bool)
+	// NamespaceUsage computes the total size of live objects in the namespace.
+	NamespaceUsage(name string) (int64, error)
+	// HashRanges computes digests of journal key ranges that extend each prefix by one character.
+	HashRanges(prefixes []string) (map[string][]*RangeHash, error)
+	// ExportRanges lists journal entries with keys having any of the specified prefixes.
+	ExportRanges(prefixes []string) (FileMetaList, error)
+	// Changes lists journal changes since the watermark known for the journal's epoch.
+	// Full resync requests are served even when this node has a full resync pending.
+	Changes(watermarks map[string]uint64, limit int, resync bool) (*SyncChanges, error)
 }
 
 var ErrNotFound = errors.New("not found")
@@ -57,6 +122,10 @@ type DiskStats storage.DiskStats
 
 type EventAnnounce cluster.EventAnnounce
 
+type HintStats cluster.HintStats
+
+type QueueStats cluster.QueueStats
+
 type ConsistencyLevel journal.ConsistencyLevel
 
 func (c ConsistencyLevel) Check() (journal.ConsistencyLevel, error) {
@@ -70,7 +139,11 @@ func (c ConsistencyLevel) Check() (journal.ConsistencyLevel, error) {
 }
 
 const (
-	EventOpaqueData cluster.EventType = cluster.EventOpaqueData
+	EventFileAdded   cluster.EventType = cluster.EventFileAdded
+	EventFileDeleted cluster.EventType = cluster.EventFileDeleted
+	EventOpaqueData  cluster.EventType = cluster.EventOpaqueData
+	EventBatch       cluster.EventType = cluster.EventBatch
+	EventMetaUpdated cluster.EventType = cluster.EventMetaUpdated
 )
 
 type storeState int
@@ -85,21 +158,36 @@ type objStore struct {
 	nodeID string
 	debug  bool
 
+	tombstoneRetention int64
+	resync             int32
+
 	stateMux *sync.RWMutex
 	state    storeState
+	applyMux *sync.Mutex
+
+	nsMux      *sync.RWMutex
+	namespaces map[string]*Namespace
+	usage      map[string]*nsUsage
 
 	localStorage  storage.LocalStorage
 	remoteStorage storage.RemoteStorage
+	staging       storage.StagingStorage
 	journals      journal.JournalManager
 	cluster       cluster.ClusterManager
+	placement     cluster.Placement
+	hints         cluster.HintStore
+	rebalancer    *rebalancer
+	antiEntropy   *antiEntropy
+	clock         *journal.Clock
 
-	outboundWg        *sync.WaitGroup
-	outboundPump      chan *EventAnnounce
-	outboundAnnounces chan *EventAnnounce
+	uploadsMux *sync.Mutex
+	completing map[string]bool
 
-	inboundWg        *sync.WaitGroup
-	inboundPump      chan *EventAnnounce
-	inboundAnnounces chan *EventAnnounce
+	outboundWg    *sync.WaitGroup
+	outboundQueue cluster.EventQueue
+
+	inboundWg    *sync.WaitGroup
+	inboundQueue cluster.EventQueue
 }
 
 func NewStore(nodeID string,
@@ -107,6 +195,10 @@ func NewStore(nodeID string,
 	remoteStorage storage.RemoteStorage,
 	journals journal.JournalManager,
 	cluster cluster.ClusterManager,
+	placement cluster.Placement,
+	hints cluster.HintStore,
+	inboundQueue cluster.EventQueue,
+	outboundQueue cluster.EventQueue,
 ) (Store, error) {
 	if !CheckID(nodeID) {
 		return nil, errors.New("objstore: invalid node ID")
@@ -123,6 +215,15 @@ func NewStore(nodeID string,
 	if cluster == nil {
 		return nil, errors.New("objstore: cluster manager not provided")
 	}
+	if placement == nil {
+		return nil, errors.New("objstore: placement not provided")
+	}
+	if hints == nil {
+		return nil, errors.New("objstore: hint store not provided")
+	}
+	if inboundQueue == nil || outboundQueue == nil {
+		return nil, errors.New("objstore: event queues not provided")
+	}
 	if err := localStorage.CheckAccess(""); err != nil {
 		err = fmt.Errorf("objstore: cannot access local storage: %v", err)
 		return nil, err
@@ -135,24 +236,38 @@ func NewStore(nodeID string,
 		err = fmt.Errorf("objstore: unable to create new journal: %v", err)
 		return nil, err
 	}
-	outboundAnnounces := make(chan *EventAnnounce, 1024)
-	inboundAnnounces := make(chan *EventAnnounce, 1024)
+	if _, err := journals.Epoch(); err != nil {
+		err = fmt.Errorf("objstore: unable to init journal change log: %v", err)
+		return nil, err
+	}
 	store := &objStore{
 		nodeID:   nodeID,
 		stateMux: new(sync.RWMutex),
+		applyMux: new(sync.Mutex),
+
+		nsMux:      new(sync.RWMutex),
+		namespaces: make(map[string]*Namespace),
+		usage:      make(map[string]*nsUsage),
 
 		localStorage:  localStorage,
 		remoteStorage: remoteStorage,
+		staging:       storage.NewStagingStorage(filepath.Join(localStorage.Prefix(), uploadsDir)),
 		journals:      journals,
 		cluster:       cluster,
+		placement:     placement,
+		hints:         hints,
+		rebalancer:    newRebalancer(),
+		antiEntropy:   newAntiEntropy(),
+		clock:         journal.NewClock(),
+
+		uploadsMux: new(sync.Mutex),
+		completing: make(map[string]bool),
 
-		outboundWg:        new(sync.WaitGroup),
-		outboundPump:      pumpEventAnnounces(outboundAnnounces),
-		outboundAnnounces: outboundAnnounces,
+		outboundWg:    new(sync.WaitGroup),
+		outboundQueue: outboundQueue,
 
-		inboundWg:        new(sync.WaitGroup),
-		inboundPump:      pumpEventAnnounces(inboundAnnounces),
-		inboundAnnounces: inboundAnnounces,
+		inboundWg:    new(sync.WaitGroup),
+		inboundQueue: inboundQueue,
 	}
 	store.processInbound(4, 10*time.Minute)
 	store.processOutbound(4, 10*time.Minute)
@@ -167,6 +282,11 @@ func NewStore(nodeID string,
 			log.Println("[INFO] sync done")
 		}
 	}()
+	go store.watchMembership(10*time.Second, 30*time.Second)
+	go store.replayHints(10*time.Second, 10*time.Minute)
+	go store.reconcile(5*time.Minute, 10*time.Minute)
+	go store.purgeTombstones(time.Hour)
+	go store.expireUploads(time.Hour)
 	go func() {
 		listJournals := func() {
 			list, err := store.journals.ListAll()
@@ -206,23 +326,31 @@ func (o *objStore) sync(timeout time.Duration) bool {
 		o.stateMux.Lock()
 		o.state = storeActiveState
 		o.stateMux.Unlock()
+		// a single node is the source of truth
+		o.markSynced()
+		o.setResyncPending(false)
 		return false
 	}
 	o.stateMux.Lock()
 	o.state = storeInactiveState
 	o.stateMux.Unlock()
 
-	list, err := o.journals.ExportAll()
-	if err != nil {
-		closer.Fatalln("[WARN] list journals failed, sync cancelled:", err)
+	// peers might have purged tombstones of objects that this node considers alive,
+	// so the journal is rebuilt from peers and outdated entries missing on all of them are dropped.
+	stale := o.isStale() || o.resyncPending()
+	if stale {
+		log.Println("[WARN] node has been out of sync longer than tombstone retention, forcing full resync")
+		o.setResyncPending(true)
 	}
+	// entries this node keeps but peers are lacking, by the number of peers lacking them
+	lacking := make(map[string]int)
+	var synced int
+	var failed bool
 
 	wg := new(sync.WaitGroup)
+	mux := new(sync.Mutex)
 	ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
 
-	var listAdded journal.FileMetaList
-	var listDeleted journal.FileMetaList
-
 	for _, node := range nodes {
 		if node.ID == o.nodeID {
 			continue
@@ -231,105 +359,46 @@ func (o *objStore) sync(timeout time.Duration) bool {
 		go func(node *cluster.NodeInfo) {
 			defer wg.Done()
 
-			added, deleted, err := o.cluster.Sync(ctx, node.ID, list)
+			missing, err := o.syncPeer(ctx, node.ID, stale, timeout)
+			mux.Lock()
+			defer mux.Unlock()
 			if err != nil {
 				log.Println("[WARN] sync error:", err)
-			} else {
-				listAdded = append(listAdded, added...)
-				listDeleted = append(listDeleted, deleted...)
+				failed = true
+				return
+			}
+			synced++
+			for _, id := range missing {
+				lacking[id]++
 			}
 		}(node)
 	}
 	wg.Wait()
 	cancelFn()
-
-	setAdded := make(map[string]*journal.FileMeta, len(listAdded))
-	setDeleted := make(map[string]*journal.FileMeta, len(listDeleted))
-
-	for _, meta := range listAdded {
-		if m, ok := setAdded[meta.ID]; ok {
-			if meta.Timestamp > m.Timestamp {
-				setAdded[meta.ID] = meta
-				continue
-			}
+	if stale {
+		if failed {
+			log.Println("[WARN] full resync incomplete, will retry")
+			return false
 		}
-		setAdded[meta.ID] = meta
-	}
-	for _, meta := range listDeleted {
-		if mAdd, ok := setAdded[meta.ID]; ok {
-			// added already, check priority by age
-			if mAdd.Timestamp > meta.Timestamp {
-				continue // skip this delete event
-			} else {
-				delete(setAdded, meta.ID)
+		var missing []string
+		for id, n := range lacking {
+			if n == synced {
+				missing = append(missing, id)
 			}
 		}
-		if m, ok := setDeleted[meta.ID]; ok {
-			if meta.Timestamp > m.Timestamp {
-				setDeleted[meta.ID] = meta
-				continue
-			}
+		// the outdated entries all peers are missing are dropped, the rest are announced
+		if err := o.dropMissing(missing); err != nil {
+			closer.Fatalln("[WARN] failed to sync journal:", err)
 		}
-		setDeleted[meta.ID] = meta
+		o.setResyncPending(false)
 	}
-
-	err = o.journals.Update(journal.ID(o.nodeID),
-		func(j journal.Journal, _ *journal.JournalMeta) error {
-			for _, meta := range setAdded {
-				if meta.IsDeleted {
-					// missing in our records, but marked as deleted elsewere
-					o.localStorage.Delete(meta.ID)
-					meta.IsSymlink = true
-					if err := j.Set(meta.ID, meta); err != nil {
-						log.Println("[WARN] journal set:", err)
-					}
-					continue
-				}
-				switch meta.Consistency {
-				case journal.ConsistencyLocal, journal.ConsistencyS3:
-					// stored elsewere
-					meta.IsSymlink = true
-					if err := j.Set(meta.ID, meta); err != nil {
-						log.Println("[WARN] journal set:", err)
-					}
-				case journal.ConsistencyFull:
-					// must replicate, i.e. handle the missing announce
-					meta.IsSymlink = true // temporarily, will be overridden once replicated
-					o.ReceiveEventAnnounce(&EventAnnounce{
-						Type:     cluster.EventFileAdded,
-						FileMeta: meta,
-					})
-					if err := j.Set(meta.ID, meta); err != nil {
-						log.Println("[WARN] journal set:", err)
-					}
-				}
-			}
-			return nil
-		})
-	if err != nil {
-		closer.Fatalln("[WARN] failed to sync journal:", err)
+	if !failed {
+		o.markSynced()
 	}
 
 	o.stateMux.Lock()
 	o.state = storeActiveState
 	o.stateMux.Unlock()
-
-	for _, meta := range setDeleted {
-		if meta.IsDeleted {
-			// some nodes missing info we have on deleted object
-			o.EmitEventAnnounce(&EventAnnounce{
-				Type:     cluster.EventFileDeleted,
-				FileMeta: meta,
-			})
-			continue
-		}
-		// some nodes are missing our file
-		o.EmitEventAnnounce(&EventAnnounce{
-			Type:     cluster.EventFileAdded,
-			FileMeta: meta,
-		})
-	}
-
 	return true
 }
 
@@ -342,11 +411,9 @@ func (o *objStore) processOutbound(workers int, emitTimeout time.Duration) {
 			for !o.IsReady() {
 				time.Sleep(100 * time.Millisecond)
 			}
-			for ev := range o.outboundAnnounces {
-				if err := o.emitEvent(ev, emitTimeout); err != nil {
-					log.Println("[WARN] emitting event:", err)
-				}
-			}
+			processQueue(o.outboundQueue, func(ev *EventAnnounce) error {
+				return o.emitEvent(ev, emitTimeout)
+			})
 		}()
 	}
 }
@@ -360,15 +427,47 @@ func (o *objStore) processInbound(workers int, timeout time.Duration) {
 			for !o.IsReady() {
 				time.Sleep(100 * time.Millisecond)
 			}
-			for ev := range o.inboundAnnounces {
-				if err := o.handleEvent(ev, timeout); err != nil {
-					log.Println("[WARN] handling event:", err)
-				}
-			}
+			processQueue(o.inboundQueue, func(ev *EventAnnounce) error {
+				return o.handleEvent(ev, timeout)
+			})
 		}()
 	}
 }
 
+const queueRetries = 3
+
+// processQueue handles events from the queue until it's closed. Events are acknowledged
+// only after being handled successfully, the failed ones are retried a few times and then
+// moved to the dead letters of the queue to be replayed upon the next start.
+func processQueue(queue cluster.EventQueue, fn func(ev *EventAnnounce) error) {
+	for {
+		item, err := queue.Pop()
+		if err == cluster.ErrQueueClosed {
+			return
+		} else if err != nil {
+			log.Println("[WARN] queue error:", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		for retry := 0; retry < queueRetries; retry++ {
+			if err = fn((*EventAnnounce)(item.Event)); err == nil {
+				break
+			}
+			log.Println("[WARN] handling event:", err)
+			time.Sleep(time.Duration(retry+1) * time.Second)
+		}
+		if err != nil {
+			if err := queue.Bury(item.Seq); err != nil {
+				log.Println("[WARN] queue bury error:", err)
+			}
+			continue
+		}
+		if err := queue.Ack(item.Seq); err != nil {
+			log.Println("[WARN] queue ack error:", err)
+		}
+	}
+}
+
 func (o *objStore) IsReady() bool {
 	o.stateMux.RLock()
 	ready := o.state == storeActiveState
@@ -376,14 +475,12 @@ func (o *objStore) IsReady() bool {
 	return ready
 }
 
+// Close stops the event processing, all unhandled events are kept in queues.
 func (o *objStore) Close() error {
-	o.inboundPump <- &EventAnnounce{
-		Type: cluster.EventStopAnnounce,
-	}
-	o.outboundPump <- &EventAnnounce{
-		Type: cluster.EventStopAnnounce,
+	if err := o.inboundQueue.Close(); err != nil {
+		return err
 	}
-	return nil
+	return o.outboundQueue.Close()
 }
 
 func (o *objStore) WaitOutbound(timeout time.Duration) {
@@ -410,20 +507,33 @@ func waitWG(wg *sync.WaitGroup, timeout time.Duration) {
 	}
 }
 
-// ReceiveEventAnnounce never blocks. Internal workers will eventually handle the received events.
+// ReceiveEventAnnounce queues the event in the state DB, it returns once the event is written,
+// so it must not be called within a journal transaction. Internal workers will eventually handle the received events.
 func (o *objStore) ReceiveEventAnnounce(event *EventAnnounce) {
 	if event.Type == cluster.EventStopAnnounce {
 		return
 	}
-	o.inboundPump <- event
+	if err := o.inboundQueue.Push((*cluster.EventAnnounce)(event)); err != nil {
+		log.Println("[WARN] failed to queue inbound event:", err)
+	}
 }
 
-// EmitEventAnnounce never blocks. Internal workers will eventually handle the events to emit.
+// EmitEventAnnounce queues the event in the state DB, it returns once the event is written,
+// so it must not be called within a journal transaction. Internal workers will eventually handle the events to emit.
 func (o *objStore) EmitEventAnnounce(event *EventAnnounce) {
 	if event.Type == cluster.EventStopAnnounce {
 		return
 	}
-	o.outboundPump <- event
+	if event.Clock == 0 {
+		event.Clock = o.clock.Now()
+	}
+	if err := o.outboundQueue.Push((*cluster.EventAnnounce)(event)); err != nil {
+		log.Println("[WARN] failed to queue outbound event:", err)
+	}
+}
+
+func (o *objStore) QueueStats() (inbound, outbound *QueueStats) {
+	return (*QueueStats)(o.inboundQueue.Stats()), (*QueueStats)(o.outboundQueue.Stats())
 }
 
 func (s *objStore) NodeID() string {
@@ -450,6 +560,10 @@ func CheckID(str string) bool {
 }
 
 func (o *objStore) emitEvent(ev *EventAnnounce, timeout time.Duration) error {
+	if o.isOutdated(ev) {
+		log.Println("[WARN] dropping outdated announcement:", ev.Type, ev.FileMeta)
+		return nil
+	}
 	ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
 	defer cancelFn()
 	wg := new(sync.WaitGroup)
@@ -458,22 +572,104 @@ func (o *objStore) emitEvent(ev *EventAnnounce, timeout time.Duration) error {
 	if err != nil {
 		return err
 	}
+	online := make(map[string]bool, len(nodes))
+	peers := make([]string, 0, len(nodes))
 	for _, node := range nodes {
-		if node.ID == o.nodeID {
+		if node.ID != o.nodeID && !online[node.ID] {
+			online[node.ID] = true
+			peers = append(peers, node.ID)
+		}
+	}
+	if err := o.hints.Seen(peers); err != nil {
+		log.Println("[WARN] failed to record peers:", err)
+	}
+	for _, nodeID := range o.hints.Peers() {
+		if nodeID == o.nodeID || online[nodeID] {
+			continue
+		}
+		// the node has dropped out of discovery, the event is kept until it's back
+		if err := o.hints.Add(nodeID, (*cluster.EventAnnounce)(ev)); err != nil {
+			log.Println("[WARN] failed to store hint:", err)
+		}
+	}
+	for _, nodeID := range peers {
+		// keep the order of events, hints will be replayed first
+		if added, err := o.hints.AddPending(nodeID, (*cluster.EventAnnounce)(ev)); err != nil {
+			log.Println("[WARN] failed to store hint:", err)
+		} else if added {
 			continue
 		}
 		wg.Add(1)
-		go func(node *cluster.NodeInfo) {
+		go func(nodeID string) {
 			defer wg.Done()
-			if err := o.cluster.Announce(ctx, node.ID, (*cluster.EventAnnounce)(ev)); err != nil {
+			if err := o.cluster.Announce(ctx, nodeID, (*cluster.EventAnnounce)(ev)); err != nil {
 				log.Println("[WARN] announce error:", err)
+				if err := o.hints.Add(nodeID, (*cluster.EventAnnounce)(ev)); err != nil {
+					log.Println("[WARN] failed to store hint:", err)
+				}
 			}
-		}(node)
+		}(nodeID)
 	}
 	return nil
 }
 
-func (o *objStore) findOnCluster(ctx context.Context, id string) (io.ReadCloser, error) {
+// replayHints periodically replays announcements that failed to reach their target nodes,
+// once these nodes are discovered in the private network again.
+func (o *objStore) replayHints(interval, timeout time.Duration) {
+	for {
+		time.Sleep(interval)
+		if err := o.hints.Expire(); err != nil {
+			log.Println("[WARN] failed to expire hints:", err)
+		}
+		hinted, err := o.hints.Nodes()
+		if err != nil {
+			log.Println("[WARN] failed to list hints:", err)
+			continue
+		} else if len(hinted) == 0 {
+			continue
+		}
+		nodes, err := o.cluster.ListNodes()
+		if err != nil {
+			log.Println("[WARN] list nodes failed:", err)
+			continue
+		}
+		online := make(map[string]bool, len(nodes))
+		for _, node := range nodes {
+			online[node.ID] = true
+		}
+		for _, nodeID := range hinted {
+			if !online[nodeID] {
+				continue
+			}
+			replayed, err := o.hints.Replay(nodeID, func(ev *cluster.EventAnnounce) error {
+				if o.isOutdated((*EventAnnounce)(ev)) {
+					return nil
+				}
+				ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
+				defer cancelFn()
+				return o.cluster.Announce(ctx, nodeID, ev)
+			})
+			if err != nil {
+				log.Println("[WARN] hints replay error:", err)
+			}
+			if o.debug && replayed > 0 {
+				log.Println("[INFO] replayed", replayed, "hints for node", nodeID)
+			}
+		}
+	}
+}
+
+func (o *objStore) HintStats() *HintStats {
+	return (*HintStats)(o.hints.Stats())
+}
+
+// fullReplicaProbes is the number of nodes to query first for a file
+// that is expected to be replicated across all existing nodes.
+const fullReplicaProbes = 3
+
+// findOnCluster finds the file body on other nodes of the cluster. The nodes chosen by
+// placement to hold the file are queried first, the rest of nodes only as a fallback.
+func (o *objStore) findOnCluster(ctx context.Context, meta *FileMeta) (io.ReadCloser, error) {
 	nodes, err := o.cluster.ListNodes()
 	if err != nil {
 		err = fmt.Errorf("objstore: cannot discover nodes: %v", err)
@@ -482,12 +678,36 @@ func (o *objStore) findOnCluster(ctx context.Context, id string) (io.ReadCloser,
 		// no other nodes except us..
 		return nil, ErrNotFound
 	}
+	ranked := o.placement.Rank(meta.ID, nodes)
+	for i, node := range ranked {
+		if node.ID == o.nodeID {
+			ranked = append(ranked[:i:i], ranked[i+1:]...)
+			break
+		}
+	}
+	owners := (*journal.FileMeta)(meta).ReplicationFactor()
+	if (*journal.FileMeta)(meta).IsReplicatedFully() {
+		owners = fullReplicaProbes
+	} else if owners == 0 {
+		// kept by the node that has taken the put, which is unknown
+		owners = len(ranked)
+	}
+	if owners > len(ranked) {
+		owners = len(ranked)
+	}
+	if r, err := o.queryNodes(ctx, ranked[:owners], meta.ID); err == nil {
+		return r, nil
+	}
+	return o.queryNodes(ctx, ranked[owners:], meta.ID)
+}
+
+func (o *objStore) queryNodes(ctx context.Context, nodes []*cluster.NodeInfo, id string) (io.ReadCloser, error) {
+	if len(nodes) == 0 {
+		return nil, ErrNotFound
+	}
 	found := make(chan io.ReadCloser, len(nodes))
 	wg := new(sync.WaitGroup)
 	for _, node := range nodes {
-		if node.ID == o.nodeID {
-			continue
-		}
 		wg.Add(1)
 		go func(node *cluster.NodeInfo) {
 			defer wg.Done()
@@ -506,12 +726,80 @@ func (o *objStore) findOnCluster(ctx context.Context, id string) (io.ReadCloser,
 	// found will be closed if all workers done,
 	// or we get at least 1 result from the channel.
 	if r, ok := <-found; ok {
+		go func() {
+			// close the extra bodies from other nodes
+			for r := range found {
+				r.Close()
+			}
+		}()
 		return r, nil
 	}
 	return nil, ErrNotFound
 }
 
+// isReplica reports whether the current node is expected to keep a copy of the file body,
+// i.e. the node is one of the owners chosen by placement for that file.
+func (o *objStore) isReplica(meta *FileMeta) (bool, error) {
+	if (*journal.FileMeta)(meta).IsReplicatedFully() {
+		return true, nil
+	}
+	n := (*journal.FileMeta)(meta).ReplicationFactor()
+	if n == 0 {
+		return false, nil
+	}
+	nodes, err := o.cluster.ListNodes()
+	if err != nil {
+		return false, err
+	}
+	for _, node := range o.placement.Owners(meta.ID, nodes, n) {
+		if node.ID == o.nodeID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// replicate stores a copy of the file body locally, the body is found on the cluster
+// or fetched from the remote storage as the last resort.
+func (o *objStore) replicate(meta *FileMeta, timeout time.Duration) error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
+	defer cancelFn()
+	r, err := o.findBody(ctx, meta)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	meta.IsSymlink = false
+	if _, err := o.storeLocal(r, meta); err != nil {
+		err = fmt.Errorf("objstore: failed to store object: %v", err)
+		return err
+	}
+	return nil
+}
+
+// findBody finds the file body on the cluster, or fetches it from the remote storage as the last resort.
+func (o *objStore) findBody(ctx context.Context, meta *FileMeta) (io.ReadCloser, error) {
+	r, err := o.findOnCluster(ctx, meta)
+	if err == ErrNotFound {
+		if o.debug {
+			log.Println("[INFO] file not found on cluster:", (*journal.FileMeta)(meta))
+		}
+		// object not found on cluster, fetch from remote store
+		r, _, err = o.fetch(meta)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 func (o *objStore) handleEvent(ev *EventAnnounce, timeout time.Duration) error {
+	if ev.Clock > 0 {
+		o.clock.Update(ev.Clock)
+	}
+	if ev.FileMeta != nil {
+		o.clock.Update(ev.FileMeta.Version())
+	}
 	switch ev.Type {
 	case cluster.EventFileAdded:
 		if ev.FileMeta == nil {
@@ -520,33 +808,25 @@ func (o *objStore) handleEvent(ev *EventAnnounce, timeout time.Duration) error {
 		}
 		id := ev.FileMeta.ID
 		meta := (*FileMeta)(ev.FileMeta)
-		if meta.Consistency == journal.ConsistencyFull {
-			// need to replicate the file locally
-			ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
-			r, err := o.findOnCluster(ctx, id)
-			cancelFn()
-			if err == ErrNotFound {
-				if o.debug {
-					log.Println("[INFO] file not found on cluster:", ev.FileMeta)
-				}
-				// object not found on cluster, fetch from remote store
-				r, meta, err = o.FetchObject(ctx, id)
-				if err == ErrNotFound {
-					// we simply bail out if the file is expected with full consistency but not
-					// found on the cluster and the remote storage.
-					log.Println("[WARN] unable to find object for:", ev.FileMeta)
-					return nil
-				}
-				meta.Consistency = journal.ConsistencyFull
-				id = meta.ID // id is the same or new
+		if local, err := o.HeadObject(id); err == nil &&
+			(*journal.FileMeta)(local).Supersedes(ev.FileMeta) {
+			if o.debug {
+				log.Println("[INFO] skipping outdated added event:", ev.FileMeta)
 			}
-			meta.IsSymlink = false
-			if _, err := o.storeLocal(r, meta); err != nil {
-				r.Close()
-				log.Println("[WARN] failed to fetch and store object:", err)
-				return nil
+			return nil
+		}
+		replicate, err := o.isReplica(meta)
+		if err != nil {
+			log.Println("[WARN] unable to check replica placement:", err)
+		}
+		if replicate && !meta.IsDeleted {
+			// need to replicate the file locally
+			if err := o.replicate(meta, timeout); err != nil {
+				// we simply keep a symlink if the file is expected to be replicated but not
+				// found on the cluster and the remote storage.
+				log.Println("[WARN] unable to replicate object:", ev.FileMeta, err)
+				meta.IsSymlink = true
 			}
-			r.Close()
 		} else {
 			meta.IsSymlink = true
 		}
@@ -567,9 +847,14 @@ func (o *objStore) handleEvent(ev *EventAnnounce, timeout time.Duration) error {
 		id := ev.FileMeta.ID
 		err := o.journals.ForEachUpdate(func(j journal.Journal, _ *journal.JournalMeta) error {
 			if m := j.Get(id); m != nil {
+				if m.Supersedes(ev.FileMeta) {
+					// the object has been put again after deletion
+					return journal.ForEachStop
+				}
 				found = true
 				m.IsDeleted = true
-				m.Timestamp = time.Now().UnixNano()
+				m.Timestamp = ev.FileMeta.Timestamp
+				m.Clock = ev.FileMeta.Version()
 				if err := j.Set(id, m); err != nil {
 					return err
 				}
@@ -585,6 +870,14 @@ func (o *objStore) handleEvent(ev *EventAnnounce, timeout time.Duration) error {
 				log.Println("[WARN] failed to delete local file:", err)
 			}
 		}
+	case cluster.EventBatch:
+		return o.handleBatch(ev, timeout)
+	case cluster.EventMetaUpdated:
+		if ev.FileMeta == nil {
+			log.Println("[WARN] skipping meta updated event with no meta")
+			return nil
+		}
+		return o.handleMetaUpdated(ev, timeout)
 	case cluster.EventOpaqueData:
 		log.Println("[INFO] cluster message:", string(ev.OpaqueData))
 	default:
@@ -604,6 +897,8 @@ func (o *objStore) DiskStats() (*DiskStats, error) {
 type FileMeta journal.FileMeta
 type FileMetaList journal.FileMetaList
 
+type FileMetaChangeList journal.FileMetaChangeList
+
 func (o *objStore) HeadObject(id string) (*FileMeta, error) {
 	var meta *FileMeta
 	err := o.journals.ForEach(func(j journal.Journal, _ *journal.JournalMeta) error {
@@ -621,6 +916,51 @@ func (o *objStore) HeadObject(id string) (*FileMeta, error) {
 	return meta, nil
 }
 
+// HeadLatest queries the nodes chosen by placement along with the local journal, replicas is the
+// replication factor of the object, at least fullReplicaProbes nodes are queried. Nodes that fail
+// to respond are skipped, so it narrows down rather than rules out races with other nodes.
+func (o *objStore) HeadLatest(ctx context.Context, id string, replicas int) (*FileMeta, error) {
+	meta, err := o.HeadObject(id)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	nodes, err := o.cluster.ListNodes()
+	if err != nil {
+		err = fmt.Errorf("objstore: cannot discover nodes: %v", err)
+		return nil, err
+	}
+	if replicas < fullReplicaProbes {
+		replicas = fullReplicaProbes
+	}
+	found := make(chan *journal.FileMeta, replicas)
+	wg := new(sync.WaitGroup)
+	for _, node := range o.placement.Owners(id, nodes, replicas) {
+		if node.ID == o.nodeID {
+			continue
+		}
+		wg.Add(1)
+		go func(node *cluster.NodeInfo) {
+			defer wg.Done()
+			if m, err := o.cluster.HeadObject(ctx, node.ID, id); err == nil {
+				found <- m
+			} else if err != cluster.ErrNotFound {
+				log.Println("[WARN] cluster error:", err)
+			}
+		}(node)
+	}
+	wg.Wait()
+	close(found)
+	for m := range found {
+		if meta == nil || m.Supersedes((*journal.FileMeta)(meta)) {
+			meta = (*FileMeta)(m)
+		}
+	}
+	if meta == nil {
+		return nil, ErrNotFound
+	}
+	return meta, nil
+}
+
 func (o *objStore) GetObject(id string) (io.ReadCloser, *FileMeta, error) {
 	var meta *FileMeta
 	err := o.journals.ForEach(func(j journal.Journal, _ *journal.JournalMeta) error {
@@ -662,7 +1002,7 @@ func (o *objStore) FindObject(ctx context.Context,
 		// completely not found -> file has been removed
 		return nil, nil, ErrNotFound
 	} else if meta != nil {
-		r, err = o.findOnCluster(ctx, id)
+		r, err = o.findOnCluster(ctx, meta)
 		if err == nil {
 			return r, meta, err
 		} else if err != ErrNotFound {
@@ -673,7 +1013,14 @@ func (o *objStore) FindObject(ctx context.Context,
 		}
 	}
 	// fetch from remote store
-	r, meta, err = o.FetchObject(ctx, id)
+	known := meta
+	if meta != nil {
+		r, meta, err = o.fetch(meta)
+	} else {
+		// keys given by clients never contain the separator, so it can't be taken for another namespace
+		ns, ref := journal.SplitID(id)
+		r, meta, err = o.FetchObject(ctx, ns, ref)
+	}
 	if err == ErrNotFound {
 		return nil, nil, ErrNotFound
 	} else if err != nil {
@@ -687,7 +1034,14 @@ func (o *objStore) FindObject(ctx context.Context,
 	if (meta.Consistency) == 0 {
 		meta.Consistency = journal.ConsistencyS3
 	}
-	meta.Timestamp = time.Now().UnixNano()
+	// the version stored along is kept, so nodes fetching the object agree on it, e.g. on its ETag,
+	// unless the object is restored over a newer entry, e.g. a tombstone, which is a new mutation then
+	if meta.Clock == 0 || (known != nil && !(*journal.FileMeta)(meta).Supersedes((*journal.FileMeta)(known))) {
+		meta.Timestamp = time.Now().UnixNano()
+		meta.Clock = o.clock.Now()
+	} else {
+		o.clock.Update(meta.Clock)
+	}
 	if _, err := o.storeLocal(r, meta); err != nil {
 		r.Close()
 		log.Println("[WARN] failed to fetch and store object:", err)
@@ -718,8 +1072,24 @@ func (o *objStore) FindObject(ctx context.Context,
 	return f, &copyMeta, nil
 }
 
-func (o *objStore) FetchObject(ctx context.Context, id string) (io.ReadCloser, *FileMeta, error) {
-	spec, err := o.remoteStorage.GetObject(id)
+func (o *objStore) FetchObject(ctx context.Context, ns, ref string) (io.ReadCloser, *FileMeta, error) {
+	return o.fetchRef(ns, ref)
+}
+
+// fetch retrieves the object known from journals from the remote storage.
+func (o *objStore) fetch(meta *FileMeta) (io.ReadCloser, *FileMeta, error) {
+	name, ref := journal.SplitID(meta.ID)
+	if len(meta.Key) > 0 {
+		ref = meta.Key
+	}
+	return o.fetchRef(name, ref)
+}
+
+// fetchRef retrieves an object of the namespace from the remote storage, the object
+// is referenced either by its ULID or by its key.
+func (o *objStore) fetchRef(name, ref string) (io.ReadCloser, *FileMeta, error) {
+	remote, key := o.remoteOf(name, ref)
+	spec, err := remote.GetObject(key)
 	if err == storage.ErrNotFound {
 		return nil, nil, ErrNotFound
 	} else if err != nil {
@@ -727,10 +1097,25 @@ func (o *objStore) FetchObject(ctx context.Context, id string) (io.ReadCloser, *
 	}
 	meta := new(journal.FileMeta)
 	meta.Unmap(spec.Meta)
-	meta.ID = id
-	if !CheckID(id) {
-		// generate a new ID for the file to store in the journals
-		meta.ID = GenerateID()
+	if meta.Timestamp == 0 && !spec.UpdatedAt.IsZero() {
+		// not put via the cluster, versioned by the remote storage
+		meta.Timestamp = spec.UpdatedAt.UnixNano()
+	}
+	if meta.Clock == 0 {
+		meta.Clock = meta.Version()
+	}
+	if _, err := ulid.Parse(ref); err == nil {
+		meta.ID = journal.JoinID(name, ref)
+	} else {
+		// fetched by the key, keep the ID it's mapped to, or the one stored along,
+		// otherwise generate a new ID for the file to store in the journals
+		meta.Key = ref
+		storedNs, storedID := journal.SplitID(meta.ID)
+		if existing, err := o.journals.LookupKey(name, ref); err == nil && existing != nil {
+			meta.ID = existing.ID
+		} else if storedNs != name || !CheckID(storedID) {
+			meta.ID = journal.JoinID(name, GenerateID())
+		}
 	}
 	if spec.Size > 0 {
 		meta.Size = spec.Size
@@ -743,9 +1128,15 @@ func (o *objStore) storeLocal(r io.Reader, meta *FileMeta) (written int64, err e
 	if err != nil {
 		return
 	}
+	err = o.setLocal(meta)
+	return
+}
+
+// setLocal sets the entry in the journal of the node, removing it from other journals.
+func (o *objStore) setLocal(meta *FileMeta) error {
 	journalID := journal.ID(o.nodeID)
 	var journalOk bool
-	if err = o.journals.ForEachUpdate(
+	if err := o.journals.ForEachUpdate(
 		func(j journal.Journal, _ *journal.JournalMeta) error {
 			if journalID == j.ID() {
 				journalOk = true
@@ -753,16 +1144,57 @@ func (o *objStore) storeLocal(r io.Reader, meta *FileMeta) (written int64, err e
 			}
 			return j.Delete(meta.ID)
 		}); err != nil {
-		return
+		return err
 	}
 	if !journalOk {
-		err = fmt.Errorf("objstore: journal not found: %v", journalID)
-		return
+		return fmt.Errorf("objstore: journal not found: %v", journalID)
 	}
-	return
+	return nil
+}
+
+// setLocalIfCurrent sets the entry like setLocal does, unless the object has been changed or deleted
+// since meta has been read, i.e. the latest entry of the object has another version. Used to change
+// node-local flags of entries read earlier, so concurrent deletes and updates are not undone.
+func (o *objStore) setLocalIfCurrent(meta *FileMeta) (bool, error) {
+	journalID := journal.ID(o.nodeID)
+	version := (*journal.FileMeta)(meta).Version()
+	var updated bool
+	err := o.journals.UpdateAll(func(journals []journal.Journal) error {
+		var current *journal.FileMeta
+		for _, j := range journals {
+			if m := j.Get(meta.ID); m != nil && (current == nil || m.Supersedes(current)) {
+				current = m
+			}
+		}
+		if current == nil || current.IsDeleted || current.Version() != version {
+			return nil
+		}
+		var journalOk bool
+		for _, j := range journals {
+			if j.ID() == journalID {
+				journalOk = true
+				if err := j.Set(meta.ID, (*journal.FileMeta)(meta)); err != nil {
+					return err
+				}
+			} else if err := j.Delete(meta.ID); err != nil {
+				return err
+			}
+		}
+		if !journalOk {
+			return fmt.Errorf("objstore: journal not found: %v", journalID)
+		}
+		updated = true
+		return nil
+	})
+	return updated, err
 }
 
 func (o *objStore) PutObject(r io.ReadCloser, meta *FileMeta) (int64, error) {
+	if err := o.checkQuota(meta); err != nil {
+		r.Close()
+		return 0, err
+	}
+	meta.Clock = o.clock.Now()
 	switch meta.Consistency {
 	case journal.ConsistencyLocal:
 		written, err := o.storeLocal(r, meta)
@@ -797,7 +1229,8 @@ func (o *objStore) PutObject(r io.ReadCloser, meta *FileMeta) (int64, error) {
 		}
 		defer f.Close()
 
-		if _, err = o.remoteStorage.PutObject(meta.ID, f, (*journal.FileMeta)(meta).Map()); err != nil {
+		remote, key := o.remote(meta)
+		if _, err = remote.PutObject(key, f, (*journal.FileMeta)(meta).Map()); err != nil {
 			err = fmt.Errorf("objstore: remote store failed: %v", err)
 			return written, err
 		}
@@ -814,6 +1247,7 @@ func (o *objStore) DeleteObject(id string) (*FileMeta, error) {
 		if m := j.Get(id); m != nil {
 			m.IsDeleted = true
 			m.Timestamp = time.Now().UnixNano()
+			m.Clock = o.clock.Now()
 			if err := j.Set(id, m); err != nil {
 				return err
 			}
@@ -837,16 +1271,18 @@ func (o *objStore) DeleteObject(id string) (*FileMeta, error) {
 	return meta, nil
 }
 
-func (o *objStore) Diff(list FileMetaList) (added, deleted FileMetaList, err error) {
-	internal, err := o.journals.ExportAll()
+func (o *objStore) Diff(list FileMetaList) (added, deleted FileMetaList, changed FileMetaChangeList, err error) {
+	if o.checkStale() {
+		return nil, nil, nil, ErrResyncPending
+	}
+	// the list is compared with the journal cursors directly, so it has to be sorted
+	external := journal.MakeJournal("", (journal.FileMetaList)(list)).List()
+	diff, err := o.journals.DiffChunk("", external, true, 0)
 	if err != nil {
-		err := fmt.Errorf("objstore: failed to collect journals: %v", err)
-		return nil, nil, err
+		err := fmt.Errorf("objstore: failed to diff journals: %v", err)
+		return nil, nil, nil, err
 	}
-	internalJournal := journal.MakeJournal("", internal)
-	externalJournal := journal.MakeJournal("", (journal.FileMetaList)(list))
-	add, del := externalJournal.Diff(internalJournal)
-	return (FileMetaList)(add), (FileMetaList)(del), nil
+	return (FileMetaList)(diff.Added), (FileMetaList)(diff.Deleted), (FileMetaChangeList)(diff.Changed), nil
 }
 
 func (o *objStore) SetDebug(v bool) {
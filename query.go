@@ -0,0 +1,22 @@
+package objstore
+
+import "sphere.software/objstore/journal"
+
+// Query selects live objects by the prefix of names and exact values of user meta,
+// at least one of the user meta keys must be indexed unless the name prefix is set.
+type Query journal.Query
+
+var ErrNotIndexed = journal.ErrNotIndexed
+
+// SetIndexedMeta sets user meta keys to index for queries, all nodes should index the same keys.
+func (o *objStore) SetIndexedMeta(keys []string) error {
+	return o.journals.SetIndexedMeta(keys)
+}
+
+// QueryObjects lists live objects of the namespace matching the query, starting after the cursor.
+// At most limit objects are listed if limit is positive. Returns the cursor to continue after,
+// if there are more objects to list.
+func (o *objStore) QueryObjects(ns string, q *Query, after string, limit int) (FileMetaList, string, error) {
+	list, next, err := o.journals.Query(ns, (*journal.Query)(q), after, limit)
+	return FileMetaList(list), next, err
+}
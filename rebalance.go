@@ -0,0 +1,372 @@
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sphere.software/objstore/cluster"
+	"sphere.software/objstore/journal"
+)
+
+// RebalanceStatus reports the progress of moving objects to their placement owners
+// after the cluster membership has been changed.
+type RebalanceStatus struct {
+	Running     bool  `json:"running"`
+	Runs        int   `json:"runs"`
+	Nodes       int   `json:"nodes"`
+	StartedAt   int64 `json:"started_at"`
+	FinishedAt  int64 `json:"finished_at"`
+	Scanned     int64 `json:"scanned"`
+	Copied      int64 `json:"copied"`
+	CopiedBytes int64 `json:"copied_bytes"`
+	Dropped     int64 `json:"dropped"`
+	Failed      int64 `json:"failed"`
+	// BandwidthLimit is the limit of bytes per second to copy, zero means no limit.
+	BandwidthLimit int64 `json:"bandwidth_limit"`
+}
+
+type rebalancer struct {
+	mux     *sync.Mutex
+	status  RebalanceStatus
+	limiter *rateLimiter
+}
+
+func newRebalancer() *rebalancer {
+	return &rebalancer{
+		mux: new(sync.Mutex),
+	}
+}
+
+func (r *rebalancer) update(fn func(status *RebalanceStatus)) {
+	r.mux.Lock()
+	fn(&r.status)
+	r.mux.Unlock()
+}
+
+func (r *rebalancer) Status() *RebalanceStatus {
+	r.mux.Lock()
+	status := r.status
+	r.mux.Unlock()
+	return &status
+}
+
+func (r *rebalancer) SetLimit(bytesPerSec int64) {
+	r.mux.Lock()
+	r.status.BandwidthLimit = bytesPerSec
+	if bytesPerSec > 0 {
+		r.limiter = newRateLimiter(bytesPerSec)
+	} else {
+		r.limiter = nil
+	}
+	r.mux.Unlock()
+}
+
+func (r *rebalancer) Limiter() *rateLimiter {
+	r.mux.Lock()
+	limiter := r.limiter
+	r.mux.Unlock()
+	return limiter
+}
+
+const rebalanceBatch = 1000
+
+// watchMembership polls the list of nodes discovered in the private network, once
+// the membership has been changed and remains stable for the settle period, objects
+// are rebalanced across the nodes according to placement.
+func (o *objStore) watchMembership(interval, settle time.Duration) {
+	var members string
+	var changedAt time.Time
+	var pending bool
+	for {
+		time.Sleep(interval)
+		if !o.IsReady() {
+			continue
+		}
+		nodes, err := o.cluster.ListNodes()
+		if err != nil {
+			log.Println("[WARN] list nodes failed:", err)
+			continue
+		}
+		if current := membersDigest(nodes); current != members {
+			if o.debug {
+				log.Println("[INFO] cluster membership changed:", current)
+			}
+			members = current
+			changedAt = time.Now()
+			pending = true
+			continue
+		}
+		if pending && time.Since(changedAt) >= settle {
+			pending = false
+			o.rebalance(nodes, 10*time.Minute)
+		}
+	}
+}
+
+func membersDigest(nodes []*cluster.NodeInfo) string {
+	return strings.Join(nodeIDs(nodes), ",")
+}
+
+// nodeIDs returns a sorted list of unique node IDs.
+func nodeIDs(nodes []*cluster.NodeInfo) []string {
+	seen := make(map[string]bool, len(nodes))
+	ids := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if seen[node.ID] {
+			continue
+		}
+		seen[node.ID] = true
+		ids = append(ids, node.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// rebalance copies objects this node owns according to placement but doesn't have yet,
+// and drops the extra copies of objects that are kept by their owners already.
+func (o *objStore) rebalance(nodes []*cluster.NodeInfo, timeout time.Duration) {
+	o.rebalancer.update(func(status *RebalanceStatus) {
+		status.Running = true
+		status.Runs++
+		status.Nodes = len(nodeIDs(nodes))
+		status.StartedAt = time.Now().UnixNano()
+		status.FinishedAt = 0
+		status.Scanned = 0
+		status.Copied = 0
+		status.CopiedBytes = 0
+		status.Dropped = 0
+		status.Failed = 0
+	})
+	defer o.rebalancer.update(func(status *RebalanceStatus) {
+		status.Running = false
+		status.FinishedAt = time.Now().UnixNano()
+	})
+	if o.debug {
+		log.Println("[INFO] rebalancing objects across nodes:", membersDigest(nodes))
+	}
+	journals, err := o.journals.ListAll()
+	if err != nil {
+		log.Println("[WARN] error listing journals", err)
+		return
+	}
+	for _, journalMeta := range journals {
+		var start string
+		for {
+			var batch journal.FileMetaList
+			err := o.journals.View(journalMeta.ID, func(j journal.Journal, _ *journal.JournalMeta) error {
+				next, err := j.Range(start, rebalanceBatch, func(_ string, meta *journal.FileMeta) error {
+					if meta != nil {
+						batch = append(batch, meta)
+					}
+					return nil
+				})
+				start = next
+				return err
+			})
+			if err != nil {
+				// journal might have been consolidated meanwhile
+				log.Println("[WARN] rebalance journal", journalMeta.ID, "failed:", err)
+				break
+			}
+			for _, meta := range batch {
+				o.rebalanceObject((*FileMeta)(meta), nodes, timeout)
+			}
+			if len(start) == 0 {
+				break
+			}
+		}
+	}
+	if o.debug {
+		log.Printf("[INFO] rebalance done: %+v", *o.rebalancer.Status())
+	}
+}
+
+func (o *objStore) rebalanceObject(meta *FileMeta, nodes []*cluster.NodeInfo, timeout time.Duration) {
+	if meta.IsDeleted {
+		return
+	}
+	o.rebalancer.update(func(status *RebalanceStatus) {
+		status.Scanned++
+	})
+	n := (*journal.FileMeta)(meta).ReplicationFactor()
+	if n == 0 && !(*journal.FileMeta)(meta).IsReplicatedFully() {
+		// kept by the node that has taken the put, moved to the most preferred node
+		// so it stays reachable when the node leaves the cluster
+		n = 1
+	}
+	owners := o.placement.Owners(meta.ID, nodes, n)
+	var isOwner bool
+	for _, node := range owners {
+		if node.ID == o.nodeID {
+			isOwner = true
+			break
+		}
+	}
+	switch {
+	case isOwner && meta.IsSymlink:
+		// this node is a new owner of the object
+		copied, err := o.copyReplica(meta, timeout)
+		if err != nil {
+			log.Println("[WARN] rebalance: unable to replicate object:", (*journal.FileMeta)(meta), err)
+			o.rebalancer.update(func(status *RebalanceStatus) {
+				status.Failed++
+			})
+			return
+		} else if !copied {
+			return
+		}
+		o.rebalancer.update(func(status *RebalanceStatus) {
+			status.Copied++
+			status.CopiedBytes += meta.Size
+		})
+	case !isOwner && !meta.IsSymlink:
+		// this node keeps an extra copy, drop it only when all owners have the object
+		if !o.ownersHold(meta.ID, owners, timeout) {
+			return
+		}
+		dropped, err := o.dropReplica(meta)
+		if err != nil {
+			log.Println("[WARN] rebalance: unable to drop extra copy:", (*journal.FileMeta)(meta), err)
+			o.rebalancer.update(func(status *RebalanceStatus) {
+				status.Failed++
+			})
+			return
+		} else if !dropped {
+			return
+		}
+		o.rebalancer.update(func(status *RebalanceStatus) {
+			status.Dropped++
+		})
+	}
+}
+
+// ownersHold checks that all the specified nodes keep the object body.
+func (o *objStore) ownersHold(id string, owners []*cluster.NodeInfo, timeout time.Duration) bool {
+	ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
+	defer cancelFn()
+	for _, node := range owners {
+		if node.ID == o.nodeID {
+			continue
+		}
+		meta, err := o.cluster.HeadObject(ctx, node.ID, id)
+		if err != nil {
+			if err != cluster.ErrNotFound {
+				log.Println("[WARN] cluster error:", err)
+			}
+			return false
+		} else if meta.IsSymlink || meta.IsDeleted {
+			return false
+		}
+	}
+	return true
+}
+
+// copyReplica stores a copy of the object body locally, unless the object has been changed or deleted
+// since meta has been read. The copy is discarded then, events of the change take care of the object.
+func (o *objStore) copyReplica(meta *FileMeta, timeout time.Duration) (bool, error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
+	defer cancelFn()
+	r, err := o.findBody(ctx, meta)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	var body io.Reader = r
+	if limiter := o.rebalancer.Limiter(); limiter != nil {
+		body = limiter.Reader(r)
+	}
+	if _, err := o.localStorage.Write(meta.ID, body); err != nil {
+		err = fmt.Errorf("objstore: failed to store object: %v", err)
+		return false, err
+	}
+	replica := *meta
+	replica.IsSymlink = false
+	updated, err := o.setLocalIfCurrent(&replica)
+	if err != nil || !updated {
+		if err := o.localStorage.Delete(meta.ID); err != nil {
+			log.Println("[WARN] failed to delete local file:", err)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// dropReplica deletes the local copy of the object, the journal keeps a symlink.
+// Nothing is dropped if the object has been changed or deleted since meta has been read.
+func (o *objStore) dropReplica(meta *FileMeta) (bool, error) {
+	symlink := *meta
+	symlink.IsSymlink = true
+	if updated, err := o.setLocalIfCurrent(&symlink); err != nil || !updated {
+		return false, err
+	}
+	return true, o.localStorage.Delete(meta.ID)
+}
+
+func (o *objStore) RebalanceStatus() *RebalanceStatus {
+	return o.rebalancer.Status()
+}
+
+func (o *objStore) SetRebalanceLimit(bytesPerSec int64) {
+	o.rebalancer.SetLimit(bytesPerSec)
+}
+
+// rateLimiter throttles reads to the specified amount of bytes per second,
+// the limit is shared between all readers being wrapped.
+type rateLimiter struct {
+	mux    *sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{
+		mux:  new(sync.Mutex),
+		rate: float64(bytesPerSec),
+		last: time.Now(),
+	}
+}
+
+func (l *rateLimiter) wait(n int) {
+	l.mux.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		// allow bursts up to one second
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mux.Unlock()
+	time.Sleep(delay)
+}
+
+func (l *rateLimiter) Reader(r io.Reader) io.Reader {
+	return &limitedReader{
+		r: r,
+		l: l,
+	}
+}
+
+type limitedReader struct {
+	r io.Reader
+	l *rateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.l.wait(n)
+	}
+	return n, err
+}
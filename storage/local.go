@@ -16,6 +16,8 @@ type LocalStorage interface {
 	Stat(key string) (os.FileInfo, error)
 	Delete(key string) error
 	Write(key string, body io.Reader) (int64, error)
+	// Link makes the file under dst share the body of the file under src.
+	Link(src, dst string) (int64, error)
 	ListFiles(prefix string) ([]os.FileInfo, error)
 	CheckAccess(prefix string) error
 	DiskStats() (*DiskStats, error)
@@ -47,13 +49,47 @@ func (l *localStorage) Delete(key string) error {
 	return os.Remove(filepath.Join(l.prefix, key))
 }
 
+// Write replaces the file with a new one rather than truncating it, so files linked to it keep their bodies.
+// The file is removed if the body fails to be read, e.g. it fails the digest verification.
 func (l *localStorage) Write(key string, body io.Reader) (int64, error) {
-	f, err := os.OpenFile(filepath.Join(l.prefix, key), os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0600)
+	path := filepath.Join(l.prefix, key)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(f, body)
+	f.Close()
+	if err != nil {
+		// don't leave a partial body behind, e.g. if the body fails verification
+		os.Remove(path)
+		return written, err
+	}
+	return written, nil
+}
+
+// Link hard links dst to src, the body is copied if the filesystem doesn't support hard links.
+func (l *localStorage) Link(src, dst string) (int64, error) {
+	srcPath := filepath.Join(l.prefix, src)
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return 0, err
+	}
+	dstPath := filepath.Join(l.prefix, dst)
+	if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if err := os.Link(srcPath, dstPath); err == nil {
+		return info.Size(), nil
+	}
+	f, err := l.Read(src)
 	if err != nil {
 		return 0, err
 	}
 	defer f.Close()
-	return io.Copy(f, body)
+	return l.Write(dst, f)
 }
 
 func (l *localStorage) ListFiles(path string) ([]os.FileInfo, error) {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"mime"
+	"net/url"
 	"path"
 	"path/filepath"
 	"strings"
@@ -19,6 +20,12 @@ import (
 // it's usually an AWS S3 client pointed to a specific bucket.
 type RemoteStorage interface {
 	PutObject(key string, r io.ReadSeeker, meta map[string]string) (*Spec, error)
+	// PutObjectParts uploads the object by parts using multipart upload, all parts
+	// except the last one must be at least MinPartSize.
+	PutObjectParts(key string, parts []io.ReadSeeker, meta map[string]string) (*Spec, error)
+	// CopyObject copies the object server-side replacing its meta data, the object
+	// may be copied onto itself to update the meta data only.
+	CopyObject(srcKey, dstKey string, meta map[string]string) (*Spec, error)
 	GetObject(key string, version ...string) (*Spec, error)
 	HeadObject(key string, version ...string) (*Spec, error)
 	ListObjects(prefix string, startAfter ...string) ([]*Spec, error)
@@ -28,6 +35,9 @@ type RemoteStorage interface {
 
 var ErrNotFound = errors.New("NoSuchKey: The specified key does not exist.")
 
+// MinPartSize is the minimum size of parts of multipart uploads, except the last part.
+const MinPartSize = 5 * 1024 * 1024
+
 type s3Storage struct {
 	bucket string
 	cli    *s3.S3
@@ -173,6 +183,94 @@ func (s *s3Storage) PutObject(key string, r io.ReadSeeker, meta map[string]strin
 	return spec, err
 }
 
+func (s *s3Storage) PutObjectParts(key string, parts []io.ReadSeeker, meta map[string]string) (*Spec, error) {
+	var ctype string
+	if len(meta["name"]) > 0 {
+		ctype = mime.TypeByExtension(filepath.Ext(meta["name"]))
+	}
+	upload, err := s.cli.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(ctype),
+		Metadata:    aws.StringMap(meta),
+	})
+	if err != nil {
+		return nil, err
+	}
+	completed := make([]*s3.CompletedPart, 0, len(parts))
+	for i, r := range parts {
+		part, err := s.cli.UploadPart(&s3.UploadPartInput{
+			Body:       r,
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(key),
+			PartNumber: aws.Int64(int64(i + 1)),
+			UploadId:   upload.UploadId,
+		})
+		if err != nil {
+			s.cli.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(s.bucket),
+				Key:      aws.String(key),
+				UploadId: upload.UploadId,
+			})
+			return nil, err
+		}
+		completed = append(completed, &s3.CompletedPart{
+			ETag:       part.ETag,
+			PartNumber: aws.Int64(int64(i + 1)),
+		})
+	}
+	obj, err := s.cli.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: completed,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	spec := &Spec{
+		Path:    fullPath(s.bucket, key),
+		Key:     key,
+		ETag:    aws.StringValue(obj.ETag),
+		Version: aws.StringValue(obj.VersionId),
+		Meta:    meta,
+	}
+	return spec, nil
+}
+
+func (s *s3Storage) CopyObject(srcKey, dstKey string, meta map[string]string) (*Spec, error) {
+	var ctype string
+	if len(meta["name"]) > 0 {
+		ctype = mime.TypeByExtension(filepath.Ext(meta["name"]))
+	}
+	obj, err := s.cli.CopyObject(&s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(dstKey),
+		CopySource:        aws.String(url.PathEscape(s.bucket + "/" + srcKey)),
+		ContentType:       aws.String(ctype),
+		Metadata:          aws.StringMap(meta),
+		MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+	})
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "NoSuchKey") {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	spec := &Spec{
+		Path:    fullPath(s.bucket, dstKey),
+		Key:     dstKey,
+		Version: aws.StringValue(obj.VersionId),
+		Meta:    meta,
+	}
+	if obj.CopyObjectResult != nil {
+		spec.ETag = aws.StringValue(obj.CopyObjectResult.ETag)
+	}
+	return spec, nil
+}
+
 func fullPath(bucket, key string) string {
 	return fmt.Sprintf("s3://%s/%s", bucket, key)
 }
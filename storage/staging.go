@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StagingStorage keeps parts of uploads in progress on the local filesystem, each upload
+// has a directory with the info file describing it and a file per part.
+type StagingStorage interface {
+	Create(uploadID string, info []byte) error
+	Info(uploadID string) ([]byte, error)
+	WritePart(uploadID string, n int, body io.Reader) (int64, error)
+	ReadPart(uploadID string, n int) (*os.File, error)
+	Parts(uploadID string) ([]*PartInfo, error)
+	Remove(uploadID string) error
+	// Uploads lists IDs of uploads along with the time parts have been written last.
+	Uploads() (map[string]time.Time, error)
+}
+
+type PartInfo struct {
+	Number int   `json:"number"`
+	Size   int64 `json:"size"`
+}
+
+var ErrNoUpload = errors.New("upload not found")
+
+const (
+	infoFile   = "info"
+	partPrefix = "part-"
+)
+
+type stagingStorage struct {
+	prefix string
+}
+
+func NewStagingStorage(prefix string) StagingStorage {
+	return &stagingStorage{
+		prefix: prefix,
+	}
+}
+
+func (s *stagingStorage) dir(uploadID string) string {
+	return filepath.Join(s.prefix, uploadID)
+}
+
+func (s *stagingStorage) Create(uploadID string, info []byte) error {
+	if err := os.MkdirAll(s.dir(uploadID), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(s.dir(uploadID), infoFile), info, 0600)
+}
+
+func (s *stagingStorage) Info(uploadID string) ([]byte, error) {
+	info, err := ioutil.ReadFile(filepath.Join(s.dir(uploadID), infoFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNoUpload
+	}
+	return info, err
+}
+
+// WritePart stores the body of the part, replacing the previous one. The part becomes
+// visible only once the body is written completely.
+func (s *stagingStorage) WritePart(uploadID string, n int, body io.Reader) (int64, error) {
+	if _, err := os.Stat(s.dir(uploadID)); os.IsNotExist(err) {
+		return 0, ErrNoUpload
+	}
+	f, err := ioutil.TempFile(s.dir(uploadID), "tmp-")
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return written, err
+	}
+	if err := os.Rename(f.Name(), s.partPath(uploadID, n)); err != nil {
+		os.Remove(f.Name())
+		return written, err
+	}
+	return written, nil
+}
+
+func (s *stagingStorage) partPath(uploadID string, n int) string {
+	return filepath.Join(s.dir(uploadID), fmt.Sprintf("%s%05d", partPrefix, n))
+}
+
+func (s *stagingStorage) ReadPart(uploadID string, n int) (*os.File, error) {
+	return os.OpenFile(s.partPath(uploadID, n), os.O_RDONLY, 0600)
+}
+
+// Parts lists parts written completely, in the order of their numbers.
+func (s *stagingStorage) Parts(uploadID string) ([]*PartInfo, error) {
+	infos, err := ioutil.ReadDir(s.dir(uploadID))
+	if os.IsNotExist(err) {
+		return nil, ErrNoUpload
+	} else if err != nil {
+		return nil, err
+	}
+	var parts []*PartInfo
+	for _, info := range infos {
+		if !strings.HasPrefix(info.Name(), partPrefix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(info.Name(), partPrefix))
+		if err != nil {
+			continue
+		}
+		parts = append(parts, &PartInfo{
+			Number: n,
+			Size:   info.Size(),
+		})
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Number < parts[j].Number
+	})
+	return parts, nil
+}
+
+func (s *stagingStorage) Remove(uploadID string) error {
+	return os.RemoveAll(s.dir(uploadID))
+}
+
+func (s *stagingStorage) Uploads() (map[string]time.Time, error) {
+	infos, err := ioutil.ReadDir(s.prefix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	uploads := make(map[string]time.Time, len(infos))
+	for _, info := range infos {
+		if info.IsDir() {
+			uploads[info.Name()] = info.ModTime()
+		}
+	}
+	return uploads, nil
+}
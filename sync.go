@@ -0,0 +1,177 @@
+package objstore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"sphere.software/objstore/cluster"
+	"sphere.software/objstore/journal"
+)
+
+// ChunkDiff is the difference between a chunk of an external journal and the local journals.
+type ChunkDiff journal.ChunkDiff
+
+const (
+	syncChunkSize    = 1000
+	syncChunkMaxDiff = 1000
+)
+
+// syncPeer syncs journals with the peer using the best protocol it supports: incremental changes,
+// chunked diff or the full journal. Upon full resync returns IDs of the local entries the peer lacks.
+func (o *objStore) syncPeer(ctx context.Context, peer string,
+	stale bool, timeout time.Duration) (missing []string, err error) {
+
+	seen, err := o.syncChanges(ctx, peer, stale, timeout)
+	if err == nil {
+		if !stale {
+			return nil, nil
+		}
+		return o.missingFrom(seen)
+	} else if err != ErrNotFound {
+		return nil, err
+	}
+	missing, err = o.syncChunks(ctx, peer, stale, timeout)
+	if err != ErrNotFound {
+		return missing, err
+	}
+	return o.syncFull(ctx, peer, stale, timeout)
+}
+
+// syncChunks compares the journal with the peer's one chunk by chunk, so neither side has
+// to keep the whole journal in memory. Returns ErrNotFound if the peer supports only full sync.
+func (o *objStore) syncChunks(ctx context.Context, peer string,
+	stale bool, timeout time.Duration) (missing []string, err error) {
+
+	var after string
+	for {
+		list, err := o.journals.ExportAfter(after, syncChunkSize)
+		if err != nil {
+			return nil, err
+		}
+		last := len(list) < syncChunkSize
+		diff, err := o.cluster.SyncChunk(ctx, peer, &cluster.SyncChunkRequest{
+			After: after,
+			List:  list,
+			Last:  last,
+		})
+		if err == cluster.ErrNotFound {
+			return nil, ErrNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		ids, err := o.applyDiff(ctx, peer, diff.Added, diff.Deleted, diff.Changed, stale, timeout)
+		if err != nil {
+			return nil, err
+		}
+		missing = append(missing, ids...)
+		switch {
+		case !diff.Done:
+			after = diff.Until
+		case last:
+			return missing, nil
+		default:
+			after = list[len(list)-1].ID
+		}
+	}
+}
+
+// syncFull sends the full journal to peers supporting neither incremental nor chunked sync.
+func (o *objStore) syncFull(ctx context.Context, peer string,
+	stale bool, timeout time.Duration) (missing []string, err error) {
+
+	list, err := o.journals.ExportAll()
+	if err != nil {
+		return nil, err
+	}
+	added, deleted, changed, err := o.cluster.Sync(ctx, peer, list)
+	if err != nil {
+		return nil, err
+	}
+	return o.applyDiff(ctx, peer, added, deleted, changed, stale, timeout)
+}
+
+// applyDiff applies the entries the peer has in newer versions, and announces to the peer the entries
+// it lacks or has outdated. Upon full resync the entries the peer lacks are not announced,
+// their IDs are returned instead.
+func (o *objStore) applyDiff(ctx context.Context, peer string, added, deleted journal.FileMetaList,
+	changed journal.FileMetaChangeList, stale bool, timeout time.Duration) (missing []string, err error) {
+
+	updates := make(journal.FileMetaList, 0, len(added)+len(changed))
+	updates = append(updates, added...)
+	for _, change := range changed {
+		local, remote := change.Prev, change.Next
+		switch {
+		case remote.Supersedes(local):
+			updates = append(updates, remote)
+		case local.Supersedes(remote):
+			// the peer has an outdated version
+			eventType := cluster.EventFileAdded
+			if local.IsDeleted {
+				eventType = cluster.EventFileDeleted
+			}
+			o.announceTo(ctx, peer, &EventAnnounce{
+				Type:     eventType,
+				FileMeta: local,
+			})
+		}
+	}
+	if err := o.applyChanges(updates, timeout); err != nil {
+		return nil, err
+	}
+	for _, meta := range deleted {
+		if stale {
+			missing = append(missing, meta.ID)
+			continue
+		}
+		// the peer is missing our entry, tombstones are announced as added
+		// entries as well, so the peer records them
+		o.announceTo(ctx, peer, &EventAnnounce{
+			Type:     cluster.EventFileAdded,
+			FileMeta: meta,
+		})
+	}
+	return missing, nil
+}
+
+// announceTo sends the announcement to a single node, it's kept as a hint if the node is unreachable.
+func (o *objStore) announceTo(ctx context.Context, nodeID string, ev *EventAnnounce) {
+	if ev.Clock == 0 {
+		ev.Clock = o.clock.Now()
+	}
+	if err := o.cluster.Announce(ctx, nodeID, (*cluster.EventAnnounce)(ev)); err != nil {
+		log.Println("[WARN] announce error:", err)
+		if err := o.hints.Add(nodeID, (*cluster.EventAnnounce)(ev)); err != nil {
+			log.Println("[WARN] failed to store hint:", err)
+		}
+	}
+}
+
+// missingFrom lists IDs of the local entries that are not in the seen list.
+func (o *objStore) missingFrom(seen []string) ([]string, error) {
+	present := make(map[string]bool, len(seen))
+	for _, id := range seen {
+		present[id] = true
+	}
+	var missing []string
+	err := o.journals.ExportEach(func(meta *journal.FileMeta) error {
+		if !present[meta.ID] {
+			missing = append(missing, meta.ID)
+		}
+		return nil
+	})
+	return missing, err
+}
+
+func (o *objStore) DiffChunk(after string, list FileMetaList, last bool) (*ChunkDiff, error) {
+	if o.checkStale() {
+		return nil, ErrResyncPending
+	}
+	diff, err := o.journals.DiffChunk(after, (journal.FileMetaList)(list), last, syncChunkMaxDiff)
+	if err != nil {
+		err = fmt.Errorf("objstore: failed to diff journals: %v", err)
+		return nil, err
+	}
+	return (*ChunkDiff)(diff), nil
+}
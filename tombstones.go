@@ -0,0 +1,155 @@
+package objstore
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"sphere.software/objstore/cluster"
+	"sphere.software/objstore/journal"
+)
+
+// ErrResyncPending is returned when the node has been out of sync longer than
+// the tombstone retention period, and its journal can't be trusted until a full resync.
+var ErrResyncPending = errors.New("objstore: full resync pending")
+
+func (o *objStore) SetTombstoneRetention(d time.Duration) {
+	atomic.StoreInt64(&o.tombstoneRetention, int64(d))
+}
+
+func (o *objStore) retention() time.Duration {
+	return time.Duration(atomic.LoadInt64(&o.tombstoneRetention))
+}
+
+// purgeTombstones periodically deletes entries of objects deleted longer than the retention period ago.
+func (o *objStore) purgeTombstones(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		retention := o.retention()
+		if retention <= 0 || !o.IsReady() {
+			continue
+		}
+		before := journal.PhysicalHLC(time.Now().Add(-retention))
+		purged, err := o.journals.PurgeDeleted(before)
+		if err != nil {
+			log.Println("[WARN] tombstones purge failed:", err)
+			continue
+		}
+		if o.debug && purged > 0 {
+			log.Println("[INFO] purged", purged, "tombstones")
+		}
+	}
+}
+
+// isStale reports whether the last successful sync with peers happened longer than the retention
+// period ago. Peers might have purged tombstones of objects this node still considers alive.
+func (o *objStore) isStale() bool {
+	retention := o.retention()
+	if retention <= 0 {
+		return false
+	}
+	lastSync, err := o.journals.LastSync()
+	if err != nil {
+		log.Println("[WARN] failed to get last sync time:", err)
+		return false
+	} else if lastSync == 0 {
+		// never synced or the state predates sync tracking
+		return false
+	}
+	return time.Since(time.Unix(0, lastSync)) > retention
+}
+
+func (o *objStore) markSynced() {
+	if err := o.journals.SetLastSync(time.Now().UnixNano()); err != nil {
+		log.Println("[WARN] failed to record last sync time:", err)
+	}
+}
+
+// checkStale marks a full resync pending once the node has been out of sync longer than the retention
+// period, so its journal is not served to peers until then. Returns whether a full resync is pending.
+func (o *objStore) checkStale() bool {
+	if o.resyncPending() {
+		return true
+	} else if !o.isStale() {
+		return false
+	}
+	log.Println("[WARN] node has been out of sync longer than tombstone retention, full resync pending")
+	o.setResyncPending(true)
+	return true
+}
+
+func (o *objStore) resyncPending() bool {
+	return atomic.LoadInt32(&o.resync) == 1
+}
+
+func (o *objStore) setResyncPending(v bool) {
+	if v {
+		atomic.StoreInt32(&o.resync, 1)
+		return
+	}
+	atomic.StoreInt32(&o.resync, 0)
+}
+
+// isOutdated reports whether the event has been emitted longer than the retention period ago,
+// such announcements might resurrect objects whose tombstones have been purged already.
+func (o *objStore) isOutdated(ev *EventAnnounce) bool {
+	retention := o.retention()
+	if retention <= 0 || ev.Clock == 0 {
+		return false
+	}
+	return ev.Clock < journal.PhysicalHLC(time.Now().Add(-retention))
+}
+
+// dropMissing deletes the entries that are missing on all peers after a full resync, if they could have
+// been purged by peers: entries older than the retention period, live or not, as peers might have purged
+// their tombstones. Local bodies of such entries are deleted as well. Newer entries, e.g. objects put
+// while the node was partitioned, are kept and announced to peers.
+func (o *objStore) dropMissing(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	before := journal.PhysicalHLC(time.Now().Add(-o.retention()))
+	var dropped int
+	var bodies []string
+	var kept []*journal.FileMeta
+	if err := o.journals.ForEachUpdate(func(j journal.Journal, _ *journal.JournalMeta) error {
+		for _, id := range ids {
+			meta := j.Get(id)
+			if meta == nil {
+				continue
+			} else if meta.Version() >= before {
+				kept = append(kept, meta)
+				continue
+			}
+			if err := j.Delete(id); err != nil {
+				return err
+			}
+			dropped++
+			if !meta.IsDeleted && !meta.IsSymlink {
+				bodies = append(bodies, id)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, id := range bodies {
+		if err := o.localStorage.Delete(id); err != nil && !os.IsNotExist(err) {
+			log.Println("[WARN] failed to delete local file:", err)
+		}
+	}
+	if dropped > 0 {
+		log.Println("[WARN] full resync: dropped", dropped, "outdated entries missing on peers")
+	}
+	// the events are queued once the journal transaction is committed
+	for _, meta := range kept {
+		// tombstones are announced as added entries as well, so peers record them
+		o.EmitEventAnnounce(&EventAnnounce{
+			Type:     cluster.EventFileAdded,
+			FileMeta: meta,
+		})
+	}
+	return nil
+}
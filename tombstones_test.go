@@ -0,0 +1,69 @@
+package objstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+
+	"sphere.software/objstore/cluster"
+	"sphere.software/objstore/journal"
+	"sphere.software/objstore/storage"
+)
+
+func TestDropMissing(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "objstore")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "state.db"), 0600, nil)
+	assert.NoError(err)
+	defer db.Close()
+	queue, err := cluster.NewEventQueue(db, "outbound")
+	assert.NoError(err)
+	defer queue.Close()
+
+	nodeID := GenerateID()
+	o := &objStore{
+		nodeID:             nodeID,
+		tombstoneRetention: int64(time.Hour),
+		localStorage:       storage.NewLocalStorage(dir),
+		journals:           journal.NewJournalManager(db),
+		clock:              journal.NewClock(),
+		outboundQueue:      queue,
+	}
+	assert.NoError(o.journals.Create(journal.ID(nodeID)))
+
+	old := journal.PhysicalHLC(time.Now().Add(-2 * time.Hour))
+	live := &FileMeta{ID: GenerateID(), Clock: old}
+	deleted := &FileMeta{ID: GenerateID(), Clock: old, IsDeleted: true}
+	recent := &FileMeta{ID: GenerateID(), Clock: o.clock.Now()}
+	for _, meta := range []*FileMeta{live, deleted, recent} {
+		_, err := o.storeLocal(strings.NewReader("body"), meta)
+		assert.NoError(err)
+	}
+
+	assert.NoError(o.dropMissing([]string{live.ID, deleted.ID, recent.ID}))
+	// the old live entry is dropped along with its body, as peers might have purged its tombstone
+	_, err = o.HeadObject(live.ID)
+	assert.Equal(ErrNotFound, err)
+	_, err = o.localStorage.Stat(live.ID)
+	assert.True(os.IsNotExist(err))
+	_, err = o.HeadObject(deleted.ID)
+	assert.Equal(ErrNotFound, err)
+	_, err = o.HeadObject(recent.ID)
+	assert.NoError(err)
+
+	// only the recent entry is announced
+	assert.Equal(1, queue.Stats().Depth)
+	ev, err := queue.Pop()
+	assert.NoError(err)
+	assert.Equal(cluster.EventFileAdded, ev.Event.Type)
+	assert.Equal(recent.ID, ev.Event.FileMeta.ID)
+}
@@ -0,0 +1,267 @@
+package objstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"sphere.software/objstore/cluster"
+	"sphere.software/objstore/journal"
+	"sphere.software/objstore/storage"
+)
+
+// Upload is a session of a resumable upload. Parts are staged on the local disk of the node
+// the upload has been initiated on, so all parts must be uploaded to the same node.
+type Upload struct {
+	ID        string    `json:"upload_id"`
+	Meta      *FileMeta `json:"meta"`
+	CreatedAt int64     `json:"created_at"`
+	// Parts lists parts uploaded completely so far.
+	Parts []*storage.PartInfo `json:"parts"`
+}
+
+const (
+	// maxUploadParts limits part numbers, like in S3 multipart uploads.
+	maxUploadParts = 10000
+	// uploadsDir is the directory of the local storage where parts of uploads are staged.
+	uploadsDir = "_uploads"
+	// uploadTTL is how long uploads having no new parts are kept.
+	uploadTTL = 7 * 24 * time.Hour
+)
+
+var (
+	ErrIncompleteUpload = errors.New("objstore: upload has missing parts")
+	ErrUploadCompleting = errors.New("objstore: upload is being completed")
+)
+
+// InitiateUpload starts an upload session of the object, meta is stored along until the upload is completed.
+func (o *objStore) InitiateUpload(meta *FileMeta) (*Upload, error) {
+	upload := &Upload{
+		ID:        GenerateID(),
+		Meta:      meta,
+		CreatedAt: time.Now().UnixNano(),
+	}
+	info, err := json.Marshal(upload)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.staging.Create(upload.ID, info); err != nil {
+		err = fmt.Errorf("objstore: failed to stage upload: %v", err)
+		return nil, err
+	}
+	return upload, nil
+}
+
+// GetUpload gets the upload session along with parts uploaded so far.
+func (o *objStore) GetUpload(uploadID string) (*Upload, error) {
+	if !CheckID(uploadID) {
+		return nil, ErrNotFound
+	}
+	info, err := o.staging.Info(uploadID)
+	if err == storage.ErrNoUpload {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	upload := new(Upload)
+	if err := json.Unmarshal(info, upload); err != nil {
+		err = fmt.Errorf("objstore: corrupted upload %s: %v", uploadID, err)
+		return nil, err
+	}
+	if upload.Parts, err = o.staging.Parts(uploadID); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// UploadPart stores the body of the part numbered n, starting from 1. Parts may be uploaded
+// in any order and uploaded again, e.g. after a dropped connection.
+func (o *objStore) UploadPart(uploadID string, n int, r io.Reader) (int64, error) {
+	if n < 1 || n > maxUploadParts {
+		return 0, fmt.Errorf("objstore: part number must be within 1..%d", maxUploadParts)
+	} else if !CheckID(uploadID) {
+		return 0, ErrNotFound
+	} else if o.isCompleting(uploadID) {
+		return 0, ErrUploadCompleting
+	}
+	written, err := o.staging.WritePart(uploadID, n, r)
+	if err == storage.ErrNoUpload {
+		return 0, ErrNotFound
+	}
+	return written, err
+}
+
+// CompleteUpload assembles parts into the object and stores it like PutObject does, parts must be
+// numbered sequentially starting from 1. Parts are uploaded to the remote storage as parts of
+// a multipart upload, if they are large enough, otherwise the assembled object is uploaded.
+// Concurrent completions of the same upload fail with ErrUploadCompleting, so it's stored once.
+func (o *objStore) CompleteUpload(uploadID string) (*FileMeta, error) {
+	if !o.beginComplete(uploadID) {
+		return nil, ErrUploadCompleting
+	}
+	defer o.endComplete(uploadID)
+	upload, err := o.GetUpload(uploadID)
+	if err != nil {
+		return nil, err
+	} else if len(upload.Parts) == 0 {
+		return nil, ErrIncompleteUpload
+	}
+	meta := upload.Meta
+	meta.Size = 0
+	for i, part := range upload.Parts {
+		if part.Number != i+1 {
+			return nil, ErrIncompleteUpload
+		}
+		meta.Size += part.Size
+	}
+	if err := o.checkQuota(meta); err != nil {
+		return nil, err
+	}
+	switch meta.Consistency {
+	case journal.ConsistencyLocal, journal.ConsistencyS3, journal.ConsistencyFull:
+	default:
+		return nil, fmt.Errorf("objstore: unknown consistency %v", meta.Consistency)
+	}
+	meta.Clock = o.clock.Now()
+	files, err := o.openParts(uploadID, upload.Parts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	readers := make([]io.Reader, 0, len(files))
+	for _, f := range files {
+		readers = append(readers, f)
+	}
+	if _, err := o.storeLocal(io.MultiReader(readers...), meta); err != nil {
+		err = fmt.Errorf("objstore: local store failed: %v", err)
+		return nil, err
+	}
+	o.EmitEventAnnounce(&EventAnnounce{
+		Type:     cluster.EventFileAdded,
+		FileMeta: (*journal.FileMeta)(meta),
+	})
+	defer func() {
+		if err := o.staging.Remove(uploadID); err != nil {
+			log.Println("[WARN] failed to remove staged upload:", err)
+		}
+	}()
+	if meta.Consistency == journal.ConsistencyLocal {
+		return meta, nil
+	}
+	if err := o.putRemoteParts(meta, files); err != nil {
+		err = fmt.Errorf("objstore: remote store failed: %v", err)
+		return meta, err
+	}
+	return meta, nil
+}
+
+// beginComplete marks the upload as being completed, reports false if it's being completed already.
+func (o *objStore) beginComplete(uploadID string) bool {
+	o.uploadsMux.Lock()
+	defer o.uploadsMux.Unlock()
+	if o.completing[uploadID] {
+		return false
+	}
+	o.completing[uploadID] = true
+	return true
+}
+
+// endComplete unmarks the upload once it's either completed and removed, or failed to complete.
+func (o *objStore) endComplete(uploadID string) {
+	o.uploadsMux.Lock()
+	delete(o.completing, uploadID)
+	o.uploadsMux.Unlock()
+}
+
+func (o *objStore) isCompleting(uploadID string) bool {
+	o.uploadsMux.Lock()
+	defer o.uploadsMux.Unlock()
+	return o.completing[uploadID]
+}
+
+func (o *objStore) openParts(uploadID string, parts []*storage.PartInfo) ([]*os.File, error) {
+	files := make([]*os.File, 0, len(parts))
+	for _, part := range parts {
+		f, err := o.staging.ReadPart(uploadID, part.Number)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			err = fmt.Errorf("objstore: staged part missing: %v", err)
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// putRemoteParts uploads staged parts to the remote storage as parts of a multipart upload, unless
+// there is a single part or some of parts are too small, then the assembled object is uploaded.
+func (o *objStore) putRemoteParts(meta *FileMeta, files []*os.File) error {
+	remote, key := o.remote(meta)
+	multipart := len(files) > 1
+	parts := make([]io.ReadSeeker, 0, len(files))
+	for i, f := range files {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if info, err := f.Stat(); err != nil {
+			return err
+		} else if i < len(files)-1 && info.Size() < storage.MinPartSize {
+			multipart = false
+		}
+		parts = append(parts, f)
+	}
+	if multipart {
+		_, err := remote.PutObjectParts(key, parts, (*journal.FileMeta)(meta).Map())
+		return err
+	}
+	f, err := o.localStorage.Read(meta.ID)
+	if err != nil {
+		err = fmt.Errorf("objstore: local store missing file: %v", err)
+		return err
+	}
+	defer f.Close()
+	_, err = remote.PutObject(key, f, (*journal.FileMeta)(meta).Map())
+	return err
+}
+
+// AbortUpload discards the upload session along with parts uploaded so far.
+func (o *objStore) AbortUpload(uploadID string) error {
+	if _, err := o.GetUpload(uploadID); err != nil {
+		return err
+	} else if o.isCompleting(uploadID) {
+		return ErrUploadCompleting
+	}
+	return o.staging.Remove(uploadID)
+}
+
+// expireUploads periodically discards uploads that have got no new parts for uploadTTL.
+func (o *objStore) expireUploads(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		uploads, err := o.staging.Uploads()
+		if err != nil {
+			log.Println("[WARN] failed to list uploads:", err)
+			continue
+		}
+		for uploadID, ts := range uploads {
+			if time.Since(ts) < uploadTTL || o.isCompleting(uploadID) {
+				continue
+			}
+			if err := o.staging.Remove(uploadID); err != nil {
+				log.Println("[WARN] failed to remove expired upload:", err)
+			} else if o.debug {
+				log.Println("[INFO] upload expired:", uploadID)
+			}
+		}
+	}
+}